@@ -0,0 +1,146 @@
+package anchors
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// Manifest records the anchors (i.e. header IDs) of every article. It's
+// written out after each build so that the next build can check that no
+// anchor that a reader might have linked to has disappeared.
+//
+// A Manifest is safe for concurrent use.
+type Manifest struct {
+	// Articles maps article slugs to a sorted list of their anchors.
+	Articles map[string][]string `json:"articles"`
+
+	mu sync.Mutex
+}
+
+// NewManifest initializes an empty manifest.
+func NewManifest() *Manifest {
+	return &Manifest{Articles: make(map[string][]string)}
+}
+
+// Load reads a manifest from the given path. A manifest that doesn't exist
+// yet is treated as an empty one.
+func Load(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return NewManifest(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := NewManifest()
+	err = json.Unmarshal(data, manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	if manifest.Articles == nil {
+		manifest.Articles = make(map[string][]string)
+	}
+
+	return manifest, nil
+}
+
+// Clone produces a copy of the manifest.
+func (m *Manifest) Clone() *Manifest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clone := NewManifest()
+	for slug, anchors := range m.Articles {
+		clone.Articles[slug] = append([]string(nil), anchors...)
+	}
+	return clone
+}
+
+// Delete removes the given article from the manifest.
+func (m *Manifest) Delete(slug string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.Articles, slug)
+}
+
+// Get returns the anchors of the given article.
+func (m *Manifest) Get(slug string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.Articles[slug]
+}
+
+// Set replaces the anchors of the given article.
+func (m *Manifest) Set(slug string, anchors []string) {
+	sorted := append([]string(nil), anchors...)
+	sort.Strings(sorted)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Articles[slug] = sorted
+}
+
+// Slugs returns the slugs of every article in the manifest in sorted order.
+func (m *Manifest) Slugs() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var slugs []string
+	for slug := range m.Articles {
+		slugs = append(slugs, slug)
+	}
+	sort.Strings(slugs)
+	return slugs
+}
+
+// Write writes the manifest out to the given path. Output is indented and
+// ordered so that changes to it are easy to review.
+func (m *Manifest) Write(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// encoding/json sorts map keys, so output is stable.
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Matches the opening tag of a header that has an ID.
+var headerRE = regexp.MustCompile(`<h[1-6][^>]*\sid="([^"]+)"`)
+
+// Extract finds the anchors of every header in rendered HTML.
+func Extract(html string) []string {
+	var anchors []string
+	for _, matches := range headerRE.FindAllStringSubmatch(html, -1) {
+		anchors = append(anchors, matches[1])
+	}
+	return anchors
+}
+
+// Missing finds anchors that are in previous but not in current.
+func Missing(previous, current []string) []string {
+	present := make(map[string]bool)
+	for _, anchor := range current {
+		present[anchor] = true
+	}
+
+	var missing []string
+	for _, anchor := range previous {
+		if !present[anchor] {
+			missing = append(missing, anchor)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,72 @@
+package anchors
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestExtract(t *testing.T) {
+	assert.Equal(t, []string{"intro", "walk-away-test"}, Extract(`
+<h2 id="intro"><a href="#intro">Intro</a></h2>
+<p id="not-a-header">Text.</p>
+<h3 id="walk-away-test"><a href="#walk-away-test">The walk away test</a></h3>
+<h3>No ID</h3>
+`))
+}
+
+func TestManifestLoadAndWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "anchors")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "anchors.json")
+
+	// A manifest that doesn't exist yet is empty
+	manifest, err := Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{}, manifest.Articles)
+
+	manifest.Set("article", []string{"b", "a"})
+	assert.Equal(t, []string{"a", "b"}, manifest.Get("article"))
+
+	err = manifest.Write(path)
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `{
+  "articles": {
+    "article": [
+      "a",
+      "b"
+    ]
+  }
+}
+`, string(data))
+
+	manifest, err = Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, manifest.Get("article"))
+
+	// Clones don't share state with the original
+	clone := manifest.Clone()
+	clone.Set("article", []string{"c"})
+	assert.Equal(t, []string{"a", "b"}, manifest.Get("article"))
+
+	clone.Set("another", nil)
+	assert.Equal(t, []string{"another", "article"}, clone.Slugs())
+
+	clone.Delete("article")
+	assert.Equal(t, []string{"another"}, clone.Slugs())
+	assert.Equal(t, []string{"article"}, manifest.Slugs())
+}
+
+func TestMissing(t *testing.T) {
+	assert.Equal(t, []string{"b"}, Missing([]string{"a", "b"}, []string{"a", "c"}))
+	assert.Nil(t, Missing([]string{"a"}, []string{"a", "c"}))
+	assert.Nil(t, Missing(nil, []string{"a"}))
+}
@@ -1,24 +1,39 @@
 package assets
 
 import (
+	"bytes"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"os"
 	"path"
 	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/brandur/singularity/sourcemap"
 	"github.com/yosssi/gcss"
 )
 
+// Generated is a stylesheet that's produced by the build rather than read
+// from a file in the source directory.
+type Generated struct {
+	// Data is the generated file's contents.
+	Data []byte
+
+	// Name is the name given to the generated file in the compiled output.
+	Name string
+}
+
 // CompileJavascripts compiles a set of JS files into a single large file by
-// appending them all to each other. Files are appended in alphabetical order
-// so we depend on the fact that there aren't too many interdependencies
-// between files. A common requirement can be given an underscore prefix to be
-// loaded first.
-func CompileJavascripts(inPath, outPath string) error {
+// appending them all to each other in the order that they're given. Each file
+// is wrapped in a function so that its top-level declarations don't leak into
+// the others.
+//
+// A source map is written next to the output with a ".map" suffix, which ties
+// each line of the output back to the line of the file that it came from. The
+// banner and wrapper added around each file aren't mapped. The output doesn't
+// refer to the map, since where it ends up being served from is up to the
+// caller.
+func CompileJavascripts(inPaths []string, outPath string) error {
 	start := time.Now()
 	defer func() {
 		log.Debugf("Compiled script assets in %v.", time.Now().Sub(start))
@@ -26,53 +41,41 @@ func CompileJavascripts(inPath, outPath string) error {
 
 	log.Debugf("Building: %v", outPath)
 
-	javascriptInfos, err := ioutil.ReadDir(inPath)
-	if err != nil {
-		return err
-	}
+	b := newCompilation(outPath)
 
-	outFile, err := os.Create(outPath)
-	if err != nil {
-		return err
-	}
-	defer outFile.Close()
+	for _, javascriptPath := range inPaths {
+		name := path.Base(javascriptPath)
+		log.Debugf("Including: %v", name)
 
-	for _, javascriptInfo := range javascriptInfos {
-		if isHidden(javascriptInfo.Name()) {
-			continue
-		}
-
-		log.Debugf("Including: %v", javascriptInfo.Name())
-
-		inFile, err := os.Open(path.Join(inPath, javascriptInfo.Name()))
+		data, err := ioutil.ReadFile(javascriptPath)
 		if err != nil {
 			return err
 		}
 
-		outFile.WriteString("/* " + javascriptInfo.Name() + " */\n\n")
-		outFile.WriteString("(function() {\n\n")
-
-		_, err = io.Copy(outFile, inFile)
-		if err != nil {
-			return err
-		}
-
-		outFile.WriteString("\n\n")
-		outFile.WriteString("}).call(this);\n\n")
+		b.WriteString("/* " + name + " */\n\n")
+		b.WriteString("(function() {\n\n")
+		b.writeSource(javascriptPath, string(data))
+		b.WriteString("\n\n")
+		b.WriteString("}).call(this);\n\n")
 	}
 
-	return nil
+	return b.save(outPath)
 }
 
 // CompileStylesheets compiles a set of stylesheet files into a single large
-// file by appending them all to each other. Files are appended in alphabetical
-// order so we depend on the fact that there aren't too many interdependencies
-// between files. CSS reset in particular is given an underscore prefix so that
-// it gets to load first.
+// file by appending them all to each other in the order that they're given.
 //
 // If a file has a ".sass" suffix, we attempt to render it as GCSS. This isn't
 // a perfect symmetry, but works well enough for these cases.
-func CompileStylesheets(inPath, outPath string) error {
+//
+// Any generated stylesheets are appended after the files in the order that
+// they're given.
+//
+// A source map is written next to the output with a ".map" suffix like it is
+// for scripts. GCSS doesn't say which line of a file each rule came from, so
+// everything compiled from a ".sass" file is only mapped to the start of it.
+// Generated stylesheets are included in the map under their names.
+func CompileStylesheets(inPaths []string, outPath string, generated ...*Generated) error {
 	start := time.Now()
 	defer func() {
 		log.Debugf("Compiled stylesheet assets in %v.", time.Now().Sub(start))
@@ -80,48 +83,104 @@ func CompileStylesheets(inPath, outPath string) error {
 
 	log.Debugf("Building: %v", outPath)
 
-	stylesheetInfos, err := ioutil.ReadDir(inPath)
+	b := newCompilation(outPath)
+
+	for _, stylesheetPath := range inPaths {
+		name := path.Base(stylesheetPath)
+		log.Debugf("Including: %v", name)
+
+		data, err := ioutil.ReadFile(stylesheetPath)
+		if err != nil {
+			return err
+		}
+
+		b.WriteString("/* " + name + " */\n\n")
+
+		if strings.HasSuffix(name, ".sass") {
+			var compiled bytes.Buffer
+			_, err := gcss.Compile(&compiled, bytes.NewReader(data))
+			if err != nil {
+				return fmt.Errorf("Error compiling %v: %v", name, err)
+			}
+			b.writeCompiled(stylesheetPath, string(data), compiled.String())
+		} else {
+			b.writeSource(stylesheetPath, string(data))
+		}
+
+		b.WriteString("\n\n")
+	}
+
+	for _, file := range generated {
+		log.Debugf("Including generated: %v", file.Name)
+
+		b.WriteString("/* " + file.Name + " */\n\n")
+		b.writeSource(file.Name, string(file.Data))
+		b.WriteString("\n\n")
+	}
+
+	return b.save(outPath)
+}
+
+// A compiled asset that's built up by appending files to it, along with a
+// source map tying its lines back to the files. Anything written with
+// WriteString rather than one of the other functions isn't mapped.
+type compilation struct {
+	bytes.Buffer
+	sourceMap *sourcemap.Map
+}
+
+func newCompilation(outPath string) *compilation {
+	return &compilation{sourceMap: sourcemap.New(path.Base(outPath))}
+}
+
+// Writes the compiled asset to outPath and its source map next to it.
+func (b *compilation) save(outPath string) error {
+	err := ioutil.WriteFile(outPath, b.Bytes(), 0644)
 	if err != nil {
 		return err
 	}
 
-	outFile, err := os.Create(outPath)
+	data, err := b.sourceMap.Encode()
 	if err != nil {
 		return err
 	}
-	defer outFile.Close()
 
-	for _, stylesheetInfo := range stylesheetInfos {
-		if isHidden(stylesheetInfo.Name()) {
-			continue
-		}
+	return ioutil.WriteFile(outPath+".map", data, 0644)
+}
 
-		log.Debugf("Including: %v", stylesheetInfo.Name())
+// Appends output compiled from a source, mapping each of its lines to the
+// start of the source.
+func (b *compilation) writeCompiled(name, source, compiled string) {
+	b.sourceMap.AddSource(name, source)
+	b.writeMapped(compiled, func(int) int { return 0 })
+}
 
-		inFile, err := os.Open(path.Join(inPath, stylesheetInfo.Name()))
-		if err != nil {
-			return err
-		}
+// Appends a source verbatim, mapping each of its lines to the same line of
+// the source.
+func (b *compilation) writeSource(name, source string) {
+	b.sourceMap.AddSource(name, source)
+	b.writeMapped(source, func(line int) int { return line })
+}
 
-		outFile.WriteString("/* " + stylesheetInfo.Name() + " */\n\n")
+// Appends the most recently added source's output, mapping each of its
+// non-empty lines to the source line that sourceLine gives for it.
+func (b *compilation) writeMapped(output string, sourceLine func(int) int) {
+	name := b.sourceMap.Sources[len(b.sourceMap.Sources)-1]
+	line := bytes.Count(b.Bytes(), []byte("\n"))
 
-		if strings.HasSuffix(stylesheetInfo.Name(), ".sass") {
-			_, err := gcss.Compile(outFile, inFile)
-			if err != nil {
-				return fmt.Errorf("Error compiling %v: %v",
-					stylesheetInfo.Name(), err)
-			}
-		} else {
-			_, err := io.Copy(outFile, inFile)
-			if err != nil {
-				return err
-			}
+	for i, text := range strings.Split(output, "\n") {
+		if text == "" {
+			continue
 		}
 
-		outFile.WriteString("\n\n")
+		b.sourceMap.Add(&sourcemap.Mapping{
+			GeneratedLine: line + i,
+			Source:        name,
+			SourceLine:    sourceLine(i),
+		})
 	}
 
-	return nil
+	b.WriteString(output)
 }
 
 // Detects a hidden file, i.e. one that starts with a dot.
@@ -2,24 +2,21 @@ package assets
 
 import (
 	"io/ioutil"
+	"strings"
 	"testing"
 
+	"github.com/brandur/singularity/sourcemap"
 	assert "github.com/stretchr/testify/require"
 )
 
 func TestCompileJavascripts(t *testing.T) {
 	dir, err := ioutil.TempDir("", "javascripts")
 
-	file0 := dir + "/.hidden"
 	file1 := dir + "/file1.js"
 	file2 := dir + "/file2.js"
 	file3 := dir + "/file3.js"
 	out := dir + "/app.js"
 
-	// This file is hidden and doesn't show up in output.
-	err = ioutil.WriteFile(file0, []byte(`hidden`), 0755)
-	assert.NoError(t, err)
-
 	err = ioutil.WriteFile(file1, []byte(`function() { return "file1" }`), 0755)
 	assert.NoError(t, err)
 
@@ -29,7 +26,7 @@ func TestCompileJavascripts(t *testing.T) {
 	err = ioutil.WriteFile(file3, []byte(`function() { return "file3" }`), 0755)
 	assert.NoError(t, err)
 
-	err = CompileJavascripts(dir, out)
+	err = CompileJavascripts([]string{file1, file2, file3}, out)
 	assert.NoError(t, err)
 
 	actual, err := ioutil.ReadFile(out)
@@ -61,21 +58,54 @@ function() { return "file3" }
 
 `
 	assert.Equal(t, expected, string(actual))
+
+	// Each file's line is mapped back to it, skipping over the banner and
+	// wrapper around it.
+	sourceMap := mustReadSourceMap(t, out+".map")
+	assert.Equal(t, "app.js", sourceMap.File)
+	assert.Equal(t, []string{file1, file2, file3}, sourceMap.Sources)
+	assert.Equal(t, `function() { return "file2" }`, sourceMap.SourcesContent[1])
+	assert.Equal(t, []*sourcemap.Mapping{
+		{GeneratedLine: 4, Source: file1, SourceLine: 0},
+		{GeneratedLine: 12, Source: file2, SourceLine: 0},
+		{GeneratedLine: 20, Source: file3, SourceLine: 0},
+	}, sourceMap.Mappings)
+}
+
+func TestCompileJavascriptsOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "javascripts")
+	assert.NoError(t, err)
+
+	file1 := dir + "/file1.js"
+	file2 := dir + "/file2.js"
+	out := dir + "/app.js"
+
+	err = ioutil.WriteFile(file1, []byte(`function() { return "file1" }`), 0755)
+	assert.NoError(t, err)
+
+	err = ioutil.WriteFile(file2, []byte(`function() { return "file2" }`), 0755)
+	assert.NoError(t, err)
+
+	// Files are appended in the order given rather than alphabetically.
+	err = CompileJavascripts([]string{file2, file1}, out)
+	assert.NoError(t, err)
+
+	actual, err := ioutil.ReadFile(out)
+	assert.NoError(t, err)
+	assert.True(t, strings.Index(string(actual), "file2") < strings.Index(string(actual), "file1"))
+
+	sourceMap := mustReadSourceMap(t, out+".map")
+	assert.Equal(t, []string{file2, file1}, sourceMap.Sources)
 }
 
 func TestCompileStylesheets(t *testing.T) {
 	dir, err := ioutil.TempDir("", "stylesheets")
 
-	file0 := dir + "/.hidden"
 	file1 := dir + "/file1.sass"
 	file2 := dir + "/file2.sass"
 	file3 := dir + "/file3.css"
 	out := dir + "/app.css"
 
-	// This file is hidden and doesn't show up in output.
-	err = ioutil.WriteFile(file0, []byte("hidden"), 0755)
-	assert.NoError(t, err)
-
 	// The syntax of the first and second files is GCSS and the third is in
 	// CSS.
 	err = ioutil.WriteFile(file1, []byte("p\n  margin: 10px"), 0755)
@@ -87,7 +117,8 @@ func TestCompileStylesheets(t *testing.T) {
 	err = ioutil.WriteFile(file3, []byte("p {\n  border: 10px;\n}"), 0755)
 	assert.NoError(t, err)
 
-	err = CompileStylesheets(dir, out)
+	err = CompileStylesheets([]string{file1, file2, file3}, out,
+		&Generated{Name: "generated.css", Data: []byte("p { color: red; }")})
 	assert.NoError(t, err)
 
 	actual, err := ioutil.ReadFile(out)
@@ -109,11 +140,41 @@ p {
   border: 10px;
 }
 
+/* generated.css */
+
+p { color: red; }
+
 `
 	assert.Equal(t, expected, string(actual))
+
+	// Files compiled from GCSS are only mapped to their start, while CSS is
+	// mapped line by line.
+	sourceMap := mustReadSourceMap(t, out+".map")
+	assert.Equal(t, []string{file1, file2, file3, "generated.css"}, sourceMap.Sources)
+	assert.Equal(t, []*sourcemap.Mapping{
+		{GeneratedLine: 2, Source: file1, SourceLine: 0},
+		{GeneratedLine: 6, Source: file2, SourceLine: 0},
+		{GeneratedLine: 10, Source: file3, SourceLine: 0},
+		{GeneratedLine: 11, Source: file3, SourceLine: 1},
+		{GeneratedLine: 12, Source: file3, SourceLine: 2},
+		{GeneratedLine: 16, Source: "generated.css", SourceLine: 0},
+	}, sourceMap.Mappings)
 }
 
 func TestIsHidden(t *testing.T) {
 	assert.Equal(t, true, isHidden(".gitkeep"))
 	assert.Equal(t, false, isHidden("article"))
 }
+
+//
+// Helpers
+//
+
+func mustReadSourceMap(t *testing.T, path string) *sourcemap.Map {
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+
+	sourceMap, err := sourcemap.Decode(data)
+	assert.NoError(t, err)
+	return sourceMap
+}
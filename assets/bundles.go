@@ -0,0 +1,202 @@
+package assets
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Bundle is a named set of scripts and stylesheets that are each compiled
+// into a single asset named after it, like "app.js" and "app.css" for a
+// bundle named "app". Layouts include the bundles that they need by name.
+type Bundle struct {
+	// Generated are the names of stylesheets produced by the build, like
+	// "fonts.css", which are appended to the bundle's stylesheets.
+	Generated []string `yaml:"generated"`
+
+	// Javascripts are the bundle's scripts in the order that they're
+	// appended. In the manifest they're paths relative to the directory of
+	// scripts, which can be glob patterns. Once loaded they're the paths of
+	// the files that those matched, with a file that's matched more than once
+	// only included the first time.
+	Javascripts []string `yaml:"javascripts"`
+
+	// Name is the name of the bundle, which is its key in the manifest.
+	Name string `yaml:"-"`
+
+	// Requires are the names of other bundles that have to be loaded before
+	// this one wherever it's included.
+	Requires []string `yaml:"requires"`
+
+	// Stylesheets are the bundle's stylesheets in the order that they're
+	// appended, given in the same way as Javascripts.
+	Stylesheets []string `yaml:"stylesheets"`
+}
+
+// HasJavascripts is whether the bundle compiles to a script.
+func (b *Bundle) HasJavascripts() bool {
+	return len(b.Javascripts) > 0
+}
+
+// HasStylesheets is whether the bundle compiles to a stylesheet.
+func (b *Bundle) HasStylesheets() bool {
+	return len(b.Stylesheets) > 0 || len(b.Generated) > 0
+}
+
+// LoadBundles loads the manifest of bundles at path, expanding the scripts
+// and stylesheets of each relative to javascriptsDir and stylesheetsDir.
+//
+// A path that doesn't exist or a pattern that doesn't match any files is an
+// error, as is a bundle that requires one that doesn't exist or bundles that
+// require each other in a cycle. Hidden files and directories are never
+// matched.
+func LoadBundles(path, javascriptsDir, stylesheetsDir string) (map[string]*Bundle, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var bundles map[string]*Bundle
+	err = yaml.UnmarshalStrict(data, &bundles)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %v: %v", path, err)
+	}
+
+	var names []string
+	for name, bundle := range bundles {
+		// An empty bundle in YAML is null
+		if bundle == nil {
+			bundle = &Bundle{}
+			bundles[name] = bundle
+		}
+
+		bundle.Name = name
+		names = append(names, name)
+	}
+
+	// Sorted so that the first error found is always the same one
+	sort.Strings(names)
+
+	for _, name := range names {
+		bundle := bundles[name]
+
+		bundle.Javascripts, err = expandInputs(javascriptsDir, bundle.Javascripts)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading bundle %q: %v", name, err)
+		}
+
+		bundle.Stylesheets, err = expandInputs(stylesheetsDir, bundle.Stylesheets)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading bundle %q: %v", name, err)
+		}
+	}
+
+	for _, name := range names {
+		_, err := ResolveBundles(bundles, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return bundles, nil
+}
+
+// ResolveBundles finds every bundle that needs to be loaded to include the
+// named ones, in the order that they should be loaded in. A bundle always
+// comes after the ones that it requires, and each only appears once.
+func ResolveBundles(bundles map[string]*Bundle, names ...string) ([]*Bundle, error) {
+	var resolved []*Bundle
+	visited := make(map[string]bool)
+
+	// chain is the bundles that led to this one being required
+	var visit func(name string, chain []string) error
+	visit = func(name string, chain []string) error {
+		for i, required := range chain {
+			if required == name {
+				return fmt.Errorf("Bundles require each other in a cycle: %v",
+					strings.Join(append(chain[i:], name), " -> "))
+			}
+		}
+
+		if visited[name] {
+			return nil
+		}
+
+		bundle, ok := bundles[name]
+		if !ok {
+			if len(chain) > 0 {
+				return fmt.Errorf("Bundle %q requires unknown bundle %q", chain[len(chain)-1], name)
+			}
+			return fmt.Errorf("Unknown bundle %q", name)
+		}
+
+		for _, required := range bundle.Requires {
+			err := visit(required, append(chain, name))
+			if err != nil {
+				return err
+			}
+		}
+
+		visited[name] = true
+		resolved = append(resolved, bundle)
+		return nil
+	}
+
+	for _, name := range names {
+		err := visit(name, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return resolved, nil
+}
+
+// Expands paths and glob patterns relative to dir into the paths of the
+// files that they match, in order.
+func expandInputs(dir string, patterns []string) ([]string, error) {
+	var paths []string
+	included := make(map[string]bool)
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("Bad pattern %q: %v", pattern, err)
+		}
+
+		var found bool
+		for _, match := range matches {
+			if isHidden(filepath.Base(match)) {
+				continue
+			}
+
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if info.IsDir() {
+				continue
+			}
+
+			found = true
+			if !included[match] {
+				included[match] = true
+				paths = append(paths, match)
+			}
+		}
+
+		if !found {
+			if strings.ContainsAny(pattern, "*?[") {
+				return nil, fmt.Errorf("%v doesn't match any files in %v", pattern, dir)
+			}
+			return nil, fmt.Errorf("%v doesn't exist in %v", pattern, dir)
+		}
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,149 @@
+package assets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestLoadBundles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundles")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	javascriptsDir := filepath.Join(dir, "javascripts")
+	stylesheetsDir := filepath.Join(dir, "stylesheets")
+	writeFiles(t, javascriptsDir, ".hidden.js", "a.js", "b.js", "optional/c.js")
+	writeFiles(t, stylesheetsDir, "_reset.sass", "main.sass", "print.css")
+
+	manifest := writeManifest(t, dir, `
+app:
+  stylesheets:
+    - _reset.sass
+    - "*.sass"
+  generated: [fonts.css]
+article:
+  requires: [app]
+  javascripts:
+    - b.js
+    - "*"
+    - optional/c.js
+empty:
+`)
+
+	bundles, err := LoadBundles(manifest, javascriptsDir, stylesheetsDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(bundles))
+
+	// Files are in the order given, only included once, and patterns never
+	// match hidden files or directories.
+	assert.Equal(t, &Bundle{
+		Generated: []string{"fonts.css"},
+		Name:      "app",
+		Stylesheets: []string{
+			filepath.Join(stylesheetsDir, "_reset.sass"),
+			filepath.Join(stylesheetsDir, "main.sass"),
+		},
+	}, bundles["app"])
+	assert.Equal(t, &Bundle{
+		Javascripts: []string{
+			filepath.Join(javascriptsDir, "b.js"),
+			filepath.Join(javascriptsDir, "a.js"),
+			filepath.Join(javascriptsDir, "optional/c.js"),
+		},
+		Name:     "article",
+		Requires: []string{"app"},
+	}, bundles["article"])
+	assert.Equal(t, &Bundle{Name: "empty"}, bundles["empty"])
+
+	assert.True(t, bundles["app"].HasStylesheets())
+	assert.False(t, bundles["app"].HasJavascripts())
+	assert.False(t, bundles["empty"].HasStylesheets())
+}
+
+func TestLoadBundlesErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundles")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	javascriptsDir := filepath.Join(dir, "javascripts")
+	writeFiles(t, javascriptsDir, ".hidden.js", "a.js")
+
+	load := func(data string) error {
+		_, err := LoadBundles(writeManifest(t, dir, data), javascriptsDir, dir)
+		return err
+	}
+
+	assert.Equal(t, `Error loading bundle "app": missing.js doesn't exist in `+javascriptsDir,
+		load("app:\n  javascripts: [a.js, missing.js]").Error())
+
+	assert.Equal(t, `Error loading bundle "app": *.coffee doesn't match any files in `+javascriptsDir,
+		load("app:\n  javascripts: [\"*.coffee\"]").Error())
+
+	assert.Equal(t, `Error loading bundle "app": .hidden.js doesn't exist in `+javascriptsDir,
+		load("app:\n  javascripts: [.hidden.js]").Error())
+
+	assert.Equal(t, `Bundle "app" requires unknown bundle "base"`,
+		load("app:\n  requires: [base]").Error())
+
+	assert.Equal(t, `Bundles require each other in a cycle: a -> b -> c -> a`,
+		load("a:\n  requires: [b]\nb:\n  requires: [c]\nc:\n  requires: [a]").Error())
+
+	assert.Contains(t, load("app:\n  scripts: [a.js]").Error(), "field scripts not found")
+}
+
+func TestResolveBundles(t *testing.T) {
+	bundles := map[string]*Bundle{
+		"a": {Name: "a"},
+		"b": {Name: "b", Requires: []string{"a"}},
+		"c": {Name: "c", Requires: []string{"b", "a"}},
+		"d": {Name: "d", Requires: []string{"a"}},
+	}
+
+	resolved, err := ResolveBundles(bundles, "c", "d", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, bundleNames(resolved))
+
+	resolved, err = ResolveBundles(bundles)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(resolved))
+
+	_, err = ResolveBundles(bundles, "e")
+	assert.Equal(t, `Unknown bundle "e"`, err.Error())
+
+	bundles["a"].Requires = []string{"a"}
+	_, err = ResolveBundles(bundles, "c")
+	assert.Equal(t, `Bundles require each other in a cycle: a -> a`, err.Error())
+}
+
+//
+// Helpers
+//
+
+func bundleNames(bundles []*Bundle) []string {
+	var names []string
+	for _, bundle := range bundles {
+		names = append(names, bundle.Name)
+	}
+	return names
+}
+
+func writeFiles(t *testing.T, dir string, names ...string) {
+	for _, name := range names {
+		err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		assert.NoError(t, err)
+
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644)
+		assert.NoError(t, err)
+	}
+}
+
+func writeManifest(t *testing.T, dir, data string) string {
+	path := filepath.Join(dir, "bundles.yaml")
+	err := ioutil.WriteFile(path, []byte(data), 0644)
+	assert.NoError(t, err)
+	return path
+}
@@ -0,0 +1,137 @@
+package assets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Number of hex characters of an asset's content hash that are put in its
+// fingerprinted name.
+const hashLength = 10
+
+// Manifest maps the names of assets to the fingerprinted names that they're
+// served under, which contain a hash of their contents. A fingerprinted
+// asset's name changes whenever it does, so it can be cached forever.
+//
+// A Manifest is safe for concurrent use.
+type Manifest struct {
+	// Assets maps the names of assets relative to the assets directory, like
+	// "app.css" or "fonts/cardo/latin.woff2", to their fingerprinted names,
+	// like "app.1a2b3c4d5e.css".
+	Assets map[string]string `json:"assets"`
+
+	// URLPrefix is the URL under which the assets directory is served, like
+	// "/assets/".
+	URLPrefix string `json:"-"`
+
+	mu sync.Mutex
+}
+
+// NewManifest initializes an empty manifest for assets served under
+// urlPrefix.
+func NewManifest(urlPrefix string) *Manifest {
+	return &Manifest{Assets: make(map[string]string), URLPrefix: urlPrefix}
+}
+
+// Add records an asset with the given contents and returns its fingerprinted
+// name.
+func (m *Manifest) Add(name string, data []byte) string {
+	fingerprinted := FingerprintedName(name, data)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Assets[name] = fingerprinted
+	return fingerprinted
+}
+
+// URL gets the URL of the fingerprinted version of an asset. An asset that's
+// not in the manifest is an error.
+func (m *Manifest) URL(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fingerprinted, ok := m.Assets[name]
+	if !ok {
+		return "", fmt.Errorf("Unknown asset %q", name)
+	}
+	return m.URLPrefix + fingerprinted, nil
+}
+
+// URLs maps the URL of every asset to the URL of its fingerprinted version,
+// like "/assets/app.css" to "/assets/app.1a2b3c4d5e.css".
+func (m *Manifest) URLs() map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	urls := make(map[string]string)
+	for name, fingerprinted := range m.Assets {
+		urls[m.URLPrefix+name] = m.URLPrefix + fingerprinted
+	}
+	return urls
+}
+
+// Write writes the manifest out to the given path as JSON.
+func (m *Manifest) Write(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// FingerprintedName gets the name that an asset with the given contents is
+// served under, which has a hash of the contents inserted before its
+// extension, like "app.1a2b3c4d5e.css" for "app.css".
+func FingerprintedName(name string, data []byte) string {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])[:hashLength]
+
+	extension := path.Ext(name)
+	return name[0:len(name)-len(extension)] + "." + hash + extension
+}
+
+// Matches a url() in a stylesheet, capturing the URL within it.
+var stylesheetURLRE = regexp.MustCompile(`url\(\s*(?:"([^"]*)"|'([^']*)'|([^)'"\s]*))\s*\)`)
+
+// ReplaceStylesheetURLs replaces the URLs of assets in the url()s of a
+// stylesheet with the URLs of their fingerprinted versions from urls, which
+// is produced by Manifest.URLs. A URL under urlPrefix that isn't in urls is an
+// error because it would be broken on the built site.
+func ReplaceStylesheetURLs(css string, urlPrefix string, urls map[string]string) (string, error) {
+	var err error
+	replaced := stylesheetURLRE.ReplaceAllStringFunc(css, func(match string) string {
+		if err != nil {
+			return match
+		}
+
+		matches := stylesheetURLRE.FindStringSubmatch(match)
+		url := matches[1] + matches[2] + matches[3]
+		if !strings.HasPrefix(url, urlPrefix) {
+			return match
+		}
+
+		fingerprinted, ok := urls[url]
+		if !ok {
+			err = fmt.Errorf("Stylesheet refers to unknown asset %v", url)
+			return match
+		}
+		return fmt.Sprintf(`url("%s")`, fingerprinted)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return replaced, nil
+}
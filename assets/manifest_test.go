@@ -0,0 +1,71 @@
+package assets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestFingerprintedName(t *testing.T) {
+	assert.Equal(t, "app.62368a1a29.css", FingerprintedName("app.css", []byte("body {}")))
+	assert.Equal(t, "fonts/cardo/latin.62368a1a29.woff2",
+		FingerprintedName("fonts/cardo/latin.woff2", []byte("body {}")))
+
+	// The name changes along with the contents
+	assert.NotEqual(t, FingerprintedName("app.css", []byte("body {}")),
+		FingerprintedName("app.css", []byte("html {}")))
+}
+
+func TestManifest(t *testing.T) {
+	manifest := NewManifest("/assets/")
+	assert.Equal(t, "app.62368a1a29.css", manifest.Add("app.css", []byte("body {}")))
+
+	url, err := manifest.URL("app.css")
+	assert.NoError(t, err)
+	assert.Equal(t, "/assets/app.62368a1a29.css", url)
+
+	_, err = manifest.URL("app.js")
+	assert.Equal(t, `Unknown asset "app.js"`, err.Error())
+
+	assert.Equal(t, map[string]string{
+		"/assets/app.css": "/assets/app.62368a1a29.css",
+	}, manifest.URLs())
+
+	dir, err := ioutil.TempDir("", "assets")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "manifest.json")
+	err = manifest.Write(path)
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `{
+  "assets": {
+    "app.css": "app.62368a1a29.css"
+  }
+}
+`, string(data))
+}
+
+func TestReplaceStylesheetURLs(t *testing.T) {
+	urls := map[string]string{
+		"/assets/ring.png":                "/assets/ring.1a2b3c4d5e.png",
+		"/assets/fonts/cardo/latin.woff2": "/assets/fonts/cardo/latin.5e4d3c2b1a.woff2",
+	}
+
+	css, err := ReplaceStylesheetURLs(`.ring { background: url("/assets/ring.png") }
+@font-face { src: local('Cardo'), url(/assets/fonts/cardo/latin.woff2) format('woff2') }
+.other { background: url('https://example.com/ring.png') }`, "/assets/", urls)
+	assert.NoError(t, err)
+	assert.Equal(t, `.ring { background: url("/assets/ring.1a2b3c4d5e.png") }
+@font-face { src: local('Cardo'), url("/assets/fonts/cardo/latin.5e4d3c2b1a.woff2") format('woff2') }
+.other { background: url('https://example.com/ring.png') }`, css)
+
+	_, err = ReplaceStylesheetURLs(`.blot { background: url("/assets/blot.png") }`, "/assets/", urls)
+	assert.Equal(t, "Stylesheet refers to unknown asset /assets/blot.png", err.Error())
+}
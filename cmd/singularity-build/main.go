@@ -2,18 +2,30 @@ package main
 
 import (
 	"bufio"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/brandur/singularity"
+	"github.com/brandur/singularity/anchors"
 	"github.com/brandur/singularity/assets"
+	"github.com/brandur/singularity/feeds"
+	"github.com/brandur/singularity/fonts"
+	"github.com/brandur/singularity/frontmatter"
+	"github.com/brandur/singularity/highlight"
+	"github.com/brandur/singularity/images"
 	"github.com/brandur/singularity/markdown"
+	"github.com/brandur/singularity/minify"
 	"github.com/brandur/singularity/pool"
+	"github.com/brandur/singularity/sourcemap"
 	"github.com/brandur/singularity/templatehelpers"
 	"github.com/brandur/singularity/toc"
 	"github.com/joeshaw/envdecode"
@@ -22,24 +34,319 @@ import (
 
 // Conf contains configuration information for the command.
 type Conf struct {
+	// AbsoluteURL is the absolute URL at which the site is hosted. It's used
+	// to build links for content that's consumed away from the site like
+	// feeds.
+	AbsoluteURL string `env:"ABSOLUTE_URL,default=https://singularity.brandur.org"`
+
 	// Concurrency is how main background Goroutines will be used to build all
 	// site resources (e.g. articles, pages, etc.).
 	Concurrency int `env:"CONCURRENCY,default=10"`
 
+	// Drafts is whether to include articles marked as drafts in the build.
+	// This is useful for previewing work locally, but should never be
+	// enabled for a build that's going to be deployed.
+	Drafts bool `env:"DRAFTS,default=false"`
+
 	// GoogleAnalyticsID is the account identifier for Google Analytics to use.
 	GoogleAnalyticsID string `env:"GOOGLE_ANALYTICS_ID"`
 
-	// LocalFonts starts using locally downloaded versions of Google Fonts.
-	// This is not ideal for real deployment because you won't be able to
-	// leverage Google's CDN and the caching that goes with it, and may not get
-	// the font format for requesting browsers, but good for airplane rides
-	// where you otherwise wouldn't have the fonts.
+	// ImageWidths are widths in pixels at which variants of images in
+	// content/images/originals are generated in addition to their 1x and 2x
+	// versions, separated by semicolons (e.g. "480;960").
+	ImageWidths []int `env:"IMAGE_WIDTHS"`
+
+	// LocalFonts serves the fonts in content/fonts from the site itself
+	// instead of loading them from the Google Fonts CDN. This is the only
+	// option for a font that's not on Google Fonts, and good for airplane
+	// rides where you otherwise wouldn't have the fonts, but misses out on
+	// Google's CDN and the caching that goes with it.
 	LocalFonts bool `env:"LOCAL_FONTS,default=false"`
 
+	// Production minifies scripts and stylesheets. It should be enabled for
+	// builds that are going to be deployed, but is off by default so that
+	// the bundles of development builds are easy to read and debug.
+	Production bool `env:"PRODUCTION,default=false"`
+
+	// RetinaJS includes the bundle of Retina.JS on every page and marks
+	// images for it to swap in their high-DPI versions. This isn't needed for
+	// browsers that support srcset, which images are given at build time.
+	RetinaJS bool `env:"RETINA_JS,default=false"`
+
 	// Verbose is whether the program will print debug output as it's running.
 	Verbose bool `env:"VERBOSE,default=false"`
 }
 
+// Article represents an article to be rendered along with the metadata
+// parsed from its front matter.
+type Article struct {
+	// Aliases are paths that the article used to be published at, each of
+	// which redirects to it. Fragments are carried along so that links to
+	// its sections still land on them.
+	Aliases []string `toml:"aliases" yaml:"aliases"`
+
+	// AnchorAliases maps header IDs that have been removed or renamed to the
+	// IDs of the headers that replaced them so that links to the old IDs
+	// still land in the right place.
+	AnchorAliases map[string]string `toml:"anchor_aliases" yaml:"anchor_aliases"`
+
+	// Content is the Markdown content of the article with its front matter
+	// removed.
+	Content string `toml:"-" yaml:"-"`
+
+	// Description is a short summary of the article suitable for use in
+	// metadata like a page's meta description.
+	Description string `toml:"description" yaml:"description"`
+
+	// File is the path to the article's source file.
+	File string `toml:"-" yaml:"-"`
+
+	// Draft indicates that the article is not yet ready for publication. Drafts
+	// are only rendered when the Drafts configuration is enabled.
+	Draft bool `toml:"draft" yaml:"draft"`
+
+	// Layout is the name of the view in the layouts directory used to render
+	// the article. Defaults to "article".
+	Layout string `toml:"layout" yaml:"layout"`
+
+	// PublishedAt is when the article was first published. Required.
+	PublishedAt time.Time `toml:"published_at" yaml:"published_at"`
+
+	// Slug is a unique identifier for the article that's derived from the
+	// name of its source file.
+	Slug string `toml:"-" yaml:"-"`
+
+	// Subtitle is a secondary title that's displayed under the article's
+	// title.
+	Subtitle string `toml:"subtitle" yaml:"subtitle"`
+
+	// Title is the article's title. Required.
+	Title string `toml:"title" yaml:"title"`
+
+	// UpdatedAt is when the article was last updated in a meaningful way. It's
+	// optional and nil if the article has never been updated.
+	UpdatedAt *time.Time `toml:"updated_at" yaml:"updated_at"`
+
+	// contentLine is the line of the source file on which Content starts.
+	// It's used to translate line numbers in rendering errors back to the
+	// source file.
+	contentLine int
+}
+
+// Backlink is a link to an article from another one.
+type Backlink struct {
+	// Article is the article that the link is in.
+	Article *Article
+
+	// Context is an excerpt of the text around the link.
+	Context string
+
+	// Section is the header of the section of Article that the link is in,
+	// or nil if it comes before the article's first header.
+	Section *markdown.Header
+}
+
+// URL is the path to the section of the linking article that the link is in.
+func (b *Backlink) URL() string {
+	if b.Section == nil {
+		return b.Article.URL()
+	}
+	return b.Article.URL() + "#" + b.Section.ID
+}
+
+// feedEncoder is a feed that can be written out as a document.
+type feedEncoder interface {
+	Encode(w io.Writer, indent string) error
+}
+
+// articleYear holds a collection of articles grouped by the year in which
+// they were published.
+type articleYear struct {
+	Year     int
+	Articles []*Article
+}
+
+// LastUpdated is the last time the article changed, which is when it was
+// updated if it ever was, and otherwise when it was published.
+func (a *Article) LastUpdated() time.Time {
+	if a.UpdatedAt != nil {
+		return *a.UpdatedAt
+	}
+	return a.PublishedAt
+}
+
+// URL is the path at which the article is published.
+func (a *Article) URL() string {
+	return "/articles/" + a.Slug
+}
+
+// checkAliases checks that each of the article's aliases is a path within the
+// site and that none of them is already claimed by another article or page of
+// the site. Aliases are cleaned so that different ways of writing the same
+// path like "/x/" and "/x" are the same alias. Claimed paths are added to
+// claimed, mapped to what claimed them.
+func (a *Article) checkAliases(claimed map[string]string) error {
+	for i, alias := range a.Aliases {
+		if !strings.HasPrefix(alias, "/") {
+			return fmt.Errorf("%v: alias %q should be a path starting with /", a.File, alias)
+		}
+
+		for _, segment := range strings.Split(alias, "/") {
+			if segment == ".." {
+				return fmt.Errorf("%v: alias %q shouldn't contain ..", a.File, alias)
+			}
+		}
+
+		alias = path.Clean(alias)
+		a.Aliases[i] = alias
+
+		if owner, ok := claimed[alias]; ok {
+			return fmt.Errorf("%v: alias %q is already used by %v", a.File, alias, owner)
+		}
+		claimed[alias] = a.File
+	}
+	return nil
+}
+
+// checkAnchors checks the anchors of the article's rendered content against
+// those from a previous build and returns the anchors that the article now
+// has, including any aliases. Anchors that have disappeared without an alias
+// are an error, as are aliases that don't point to an existing anchor.
+func (a *Article) checkAnchors(rendered string, previous []string) ([]string, error) {
+	current := anchors.Extract(rendered)
+
+	present := make(map[string]bool)
+	for _, anchor := range current {
+		present[anchor] = true
+	}
+
+	var oldIDs []string
+	for oldID := range a.AnchorAliases {
+		oldIDs = append(oldIDs, oldID)
+	}
+	sort.Strings(oldIDs)
+
+	for _, oldID := range oldIDs {
+		newID := a.AnchorAliases[oldID]
+
+		if present[oldID] {
+			return nil, fmt.Errorf("%v: anchor alias %q is still an anchor in the article",
+				a.File, oldID)
+		}
+
+		if !present[newID] {
+			return nil, fmt.Errorf("%v: anchor alias %q points to %q, which isn't an anchor in the article",
+				a.File, oldID, newID)
+		}
+	}
+
+	current = append(current, oldIDs...)
+
+	if a.Draft {
+		return current, nil
+	}
+
+	missing := anchors.Missing(previous, current)
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%v: anchor(s) %v disappeared since the last build "+
+			"(add anchor_aliases to the front matter mapping each one to its replacement)",
+			a.File, strings.Join(missing, ", "))
+	}
+
+	return current, nil
+}
+
+// linkTarget finds the headers in the article's content so that other
+// articles can link to it and them. Errors are reported in the same way as
+// they are by render.
+func (a *Article) linkTarget(options *markdown.RenderOptions) (*markdown.LinkTarget, error) {
+	headers, err := markdown.Headers(a.Content, options)
+	if err != nil {
+		return nil, a.sourceError(err)
+	}
+
+	target := &markdown.LinkTarget{
+		Headers: make(map[string]string),
+		Title:   a.Title,
+		URL:     a.URL(),
+	}
+	for _, header := range headers {
+		target.Headers[header.ID] = header.Text
+	}
+
+	// Old IDs still work as anchors, so they can be linked to as well.
+	for oldID, newID := range a.AnchorAliases {
+		if text, ok := target.Headers[newID]; ok {
+			target.Headers[oldID] = text
+		}
+	}
+
+	return target, nil
+}
+
+// links finds the links in the article's content. Errors are reported in the
+// same way as they are by render.
+func (a *Article) links(options *markdown.RenderOptions) ([]*markdown.Link, error) {
+	links, err := markdown.Links(a.Content, options)
+	if err != nil {
+		return nil, a.sourceError(err)
+	}
+
+	return links, nil
+}
+
+// render renders the article's content to HTML. Errors name the article's
+// source file and the line within it where the problem occurred if it's
+// known.
+func (a *Article) render(options *markdown.RenderOptions) (string, error) {
+	rendered, err := markdown.Render(a.Content, options)
+	if err != nil {
+		return "", a.sourceError(err)
+	}
+
+	return rendered, nil
+}
+
+// sourceError adds the article's source file to an error from rendering its
+// content, along with the line in the file if the error has one.
+func (a *Article) sourceError(err error) error {
+	if markdownErr, ok := err.(*markdown.Error); ok && markdownErr.Line > 0 {
+		return fmt.Errorf("%v:%v: %v", a.File,
+			a.contentLine+markdownErr.Line-1, markdownErr.Message)
+	}
+	return fmt.Errorf("%v: %v", a.File, err)
+}
+
+// validate checks that the article's metadata contains all required keys.
+func (a *Article) validate() []string {
+	var missing []string
+
+	if a.PublishedAt.IsZero() {
+		missing = append(missing, "published_at")
+	}
+
+	if a.Title == "" {
+		missing = append(missing, "title")
+	}
+
+	return missing
+}
+
+//
+// Constants
+//
+
+const (
+	// authorName is the name attributed as the author of feeds.
+	authorName = "Brandur Leach"
+
+	// siteTitle is the title of the site used in the index and feeds.
+	siteTitle = "Singularity"
+
+	// siteDescription is a short description of the site.
+	siteDescription = "Articles on writing software resistant to time and entropy."
+)
+
 //
 // Variables
 //
@@ -48,6 +355,18 @@ type Conf struct {
 // very many places and can probably be refactored as a local if desired.
 var conf Conf
 
+// Records the fingerprinted names of assets as they're built. Everything
+// that refers to an asset looks up its name here.
+var assetManifest = assets.NewManifest("/assets/")
+
+// URLs of the fonts that every page preloads. They're known once fonts have
+// been fingerprinted.
+var fontPreloads []string
+
+// URL of the Google Fonts stylesheet that every page loads fonts from when
+// they aren't served locally.
+var googleFontsURL string
+
 //
 // Main
 //
@@ -65,47 +384,178 @@ func main() {
 
 	singularity.InitLog(conf.Verbose)
 
-	// This is where we stored "versioned" assets like compiled JS and CSS.
-	// These assets have a release number that we can increment and by
-	// extension quickly invalidate.
-	versionedAssetsDir := path.Join(singularity.TargetDir, "assets",
-		singularity.Release)
-
 	err = singularity.CreateOutputDirs(singularity.TargetDir)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	fontFaces, err := fonts.Load(path.Join(singularity.ContentDir, "fonts"), "/assets/fonts")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	bundles, err := assets.LoadBundles(singularity.BundlesManifest,
+		path.Join(singularity.ContentDir, "javascripts"),
+		path.Join(singularity.ContentDir, "stylesheets"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Images and fonts are fingerprinted before anything else is built
+	// because everything that refers to them needs to know the names they're
+	// served under. Articles also need to know which variants of images
+	// exist to render them.
+	imageVariants := make(map[string][]*markdown.ImageVariant)
+
 	var tasks []*pool.Task
 
+	tasks = append(tasks, tasksForImages(imageVariants)...)
+
 	tasks = append(tasks, pool.NewTask(func() error {
-		return linkFonts()
+		return linkFonts(fontFaces)
 	}))
 
 	tasks = append(tasks, pool.NewTask(func() error {
 		return linkImages()
 	}))
 
+	if !runTasks(tasks) {
+		os.Exit(1)
+	}
+
+	// Scripts and stylesheets are next, because every page refers to them
+	// and stylesheets refer to images and fonts.
+	tasks = nil
+
+	// Styles for syntax highlighted code and the @font-face rules of fonts
+	// are generated, and bundles include them by name. Fonts from Google's
+	// CDN come with rules of their own.
+	var fontsStylesheet string
+	if conf.LocalFonts {
+		fontsStylesheet = fonts.Stylesheet(fontFaces)
+	} else {
+		googleFontsURL = fonts.GoogleFontsURL(fontFaces)
+	}
+
+	generated := []*assets.Generated{
+		{Name: "fonts.css", Data: []byte(fontsStylesheet)},
+		{Name: "highlight.css", Data: []byte(highlight.Stylesheet())},
+	}
+
+	for _, bundle := range bundles {
+		bundle := bundle
+
+		if bundle.HasJavascripts() {
+			tasks = append(tasks, pool.NewTask(func() error {
+				return compileJavascripts(bundle)
+			}))
+		}
+
+		if bundle.HasStylesheets() {
+			tasks = append(tasks, pool.NewTask(func() error {
+				return compileStylesheets(bundle, generated)
+			}))
+		}
+	}
+
+	if !runTasks(tasks) {
+		os.Exit(1)
+	}
+
+	templatehelpers.Assets = assetManifest
+	templatehelpers.Bundles = bundles
+
+	if conf.LocalFonts {
+		assetURLs := assetManifest.URLs()
+		for _, url := range fonts.Preloads(fontFaces) {
+			fontPreloads = append(fontPreloads, assetURLs[url])
+		}
+	}
+
+	// Articles are loaded in a first pass so that pages which list them (the
+	// index and archive) have the metadata of all of them available before
+	// any rendering starts.
+	articles, drafts, err := loadArticles()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Anchors from the last build are checked against those in this one to
+	// make sure that none that a reader may have linked to have disappeared.
+	// Drafts that aren't part of this build keep their previous anchors.
+	previousAnchors, err := anchors.Load(singularity.AnchorsManifest)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = moveAnchors(previousAnchors, articles, drafts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	currentAnchors := previousAnchors.Clone()
+
+	// The headers of every article are found before any are rendered so that
+	// links between articles can be checked and given the title of what
+	// they point to.
+	//
+	// Links in headers change the IDs that they're given, so headers are
+	// found twice: first with links given only the titles of articles, and
+	// then again so that links to headers are given theirs.
+	titleTargets := make(map[string]*markdown.LinkTarget)
+	for _, article := range articles {
+		titleTargets[article.Slug] = &markdown.LinkTarget{Title: article.Title, URL: article.URL()}
+	}
+
+	headerTargets := make(map[string]*markdown.LinkTarget)
+	if !runTasks(tasksForLinkTargets(articles, imageVariants, titleTargets, headerTargets)) {
+		os.Exit(1)
+	}
+
+	linkTargets := make(map[string]*markdown.LinkTarget)
+	if !runTasks(tasksForLinkTargets(articles, imageVariants, headerTargets, linkTargets)) {
+		os.Exit(1)
+	}
+
+	// Links between articles are gathered before any are rendered as well
+	// so that each article can list the others that link to it.
+	backlinks := make(map[string][]*Backlink)
+	if !runTasks(tasksForBacklinks(articles, imageVariants, linkTargets, backlinks)) {
+		os.Exit(1)
+	}
+	sortBacklinks(backlinks)
+
+	tasks = nil
+
+	tasks = append(tasks, tasksForArticles(articles, imageVariants, linkTargets, backlinks,
+		previousAnchors, currentAnchors)...)
+
+	tasks = append(tasks, tasksForAliases(articles)...)
+
+	tasks = append(tasks, pool.NewTask(func() error {
+		return compileArchive(articles)
+	}))
+
 	tasks = append(tasks, pool.NewTask(func() error {
-		return assets.CompileJavascripts(
-			path.Join(singularity.ContentDir, "javascripts"),
-			path.Join(versionedAssetsDir, "app.js"))
+		return compileFeeds(articles, imageVariants, linkTargets)
 	}))
 
 	tasks = append(tasks, pool.NewTask(func() error {
-		return assets.CompileStylesheets(
-			path.Join(singularity.ContentDir, "stylesheets"),
-			path.Join(versionedAssetsDir, "app.css"))
+		return compileIndex(articles)
 	}))
 
-	articleTasks, err := tasksForArticles()
+	if !runTasks(tasks) {
+		os.Exit(1)
+	}
+
+	err = currentAnchors.Write(singularity.AnchorsManifest)
 	if err != nil {
 		log.Fatal(err)
 	}
-	tasks = append(tasks, articleTasks...)
 
-	if !runTasks(tasks) {
-		os.Exit(1)
+	err = assetManifest.Write(path.Join(singularity.TargetDir, "assets", "manifest.json"))
+	if err != nil {
+		log.Fatal(err)
 	}
 }
 
@@ -116,23 +566,31 @@ func main() {
 // They are normally run concurrently.
 //
 
-func linkFonts() error {
+func linkFonts(faces []*fonts.Face) error {
 	start := time.Now()
 	defer func() {
 		log.Debugf("Linked font assets in %v.", time.Now().Sub(start))
 	}()
 
-	source, err := filepath.Abs(path.Join(singularity.ContentDir, "fonts"))
-	if err != nil {
-		return err
+	// Fonts used to be linked as a whole directory, which would now have
+	// their fingerprinted versions linked right back into it.
+	dir := path.Join(singularity.TargetDir, "assets", "fonts")
+	info, err := os.Lstat(dir)
+	if err == nil && info.Mode()&os.ModeSymlink != 0 {
+		err = os.Remove(dir)
+		if err != nil {
+			return err
+		}
 	}
 
-	dest, err := filepath.Abs(path.Join(singularity.TargetDir, "assets", "fonts"))
-	if err != nil {
-		return err
+	for _, face := range faces {
+		err := linkAsset(strings.TrimPrefix(face.URL, assetManifest.URLPrefix), face.Path)
+		if err != nil {
+			return err
+		}
 	}
 
-	return ensureSymlink(source, dest)
+	return nil
 }
 
 func linkImages() error {
@@ -147,63 +605,340 @@ func linkImages() error {
 	}
 
 	for _, asset := range assets {
-		// we use absolute paths for source and destination because not doing
-		// so can result in some weird symbolic link inception
-		source, err := filepath.Abs(singularity.ContentDir + "/images/" + asset.Name())
-		if err != nil {
-			return err
+		// Directories like the one containing originals aren't served.
+		if asset.IsDir() {
+			continue
 		}
 
-		dest, err := filepath.Abs(singularity.TargetDir + "/assets/" + asset.Name())
+		err = linkAsset(asset.Name(), singularity.ContentDir+"/images/"+asset.Name())
 		if err != nil {
 			return err
 		}
+	}
+
+	return nil
+}
+
+// Generates the variants of a high resolution image, which are cached, and
+// links them into the built site.
+func processImage(source string) ([]*markdown.ImageVariant, error) {
+	start := time.Now()
+	defer func() {
+		log.Debugf("Processed image %v in %v.", path.Base(source), time.Now().Sub(start))
+	}()
+
+	variants, err := images.Process(source, singularity.ImageCacheDir, conf.ImageWidths)
+	if err != nil {
+		return nil, err
+	}
+
+	var imageVariants []*markdown.ImageVariant
+	for _, variant := range variants {
+		// Hand-made images in content/images are linked into the same place,
+		// so a variant with the same name would be ambiguous.
+		_, err := os.Stat(path.Join(singularity.ContentDir, "images", variant.Name))
+		if err == nil {
+			return nil, fmt.Errorf("%v: variant %v conflicts with an image of the same name in %v",
+				source, variant.Name, path.Join(singularity.ContentDir, "images"))
+		}
 
-		err = ensureSymlink(source, dest)
+		err = linkAsset(variant.Name, variant.Path)
 		if err != nil {
-			return err
+			return nil, err
 		}
+
+		imageVariants = append(imageVariants, &markdown.ImageVariant{
+			Density: variant.Density,
+			Height:  variant.Height,
+			URL:     "/assets/" + variant.Name,
+			Width:   variant.Width,
+		})
 	}
 
-	return nil
+	return imageVariants, nil
+}
+
+func compileArchive(articles []*Article) error {
+	start := time.Now()
+	defer func() {
+		log.Debugf("Compiled archive in %v.", time.Now().Sub(start))
+	}()
+
+	locals := getLocals("Archive", map[string]interface{}{
+		"ArticlesByYear": groupArticlesByYear(articles),
+	})
+
+	return renderView(singularity.MainLayout,
+		path.Join(singularity.LayoutsDir, "archive"),
+		path.Join(singularity.TargetDir, "archive", "index.html"), locals)
 }
 
-func compileArticle(articleFile string) error {
-	name := trimExtension(articleFile)
-	log.Debugf("Rendering article: %v", name)
+// Compiles a page at an old path of an article that redirects to it,
+// keeping any fragment so that links to a section still land on it.
+func compileAlias(article *Article, alias string) error {
+	locals := getLocals(article.Title, map[string]interface{}{
+		"Article": article,
+	})
+
+	dir := path.Join(singularity.TargetDir, alias)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	return renderView(singularity.MainLayout,
+		path.Join(singularity.LayoutsDir, "redirect"),
+		path.Join(dir, "index.html"), locals)
+}
+
+func compileArticle(article *Article, imageVariants map[string][]*markdown.ImageVariant,
+	linkTargets map[string]*markdown.LinkTarget, backlinks []*Backlink,
+	previousAnchors, currentAnchors *anchors.Manifest) error {
+
+	log.Debugf("Rendering article: %v", article.Slug)
+
+	options := &markdown.RenderOptions{
+		AnchorAliases: article.AnchorAliases,
+		AssetURLs:     assetManifest.URLs(),
+		ImageDir:      singularity.ContentDir + "/images",
+		ImageURL:      "/assets/",
+		ImageVariants: imageVariants,
+		LinkTargets:   linkTargets,
+
+		// Feeds render the same content, so warnings are only logged from
+		// here to avoid repeating them.
+		Warn: func(message string) {
+			log.Warnf("%v: %v", article.File, message)
+		},
+	}
+
+	if conf.RetinaJS {
+		options.Enable = append(options.Enable, markdown.TransformRetinaImages)
+	}
+
+	rendered, err := article.render(options)
+	if err != nil {
+		return err
+	}
 
-	source, err :=
-		ioutil.ReadFile(path.Join(singularity.ContentDir, "articles", articleFile))
+	articleAnchors, err := article.checkAnchors(rendered, previousAnchors.Get(article.Slug))
 	if err != nil {
 		return err
 	}
-	rendered := markdown.Render(string(source), nil)
+
+	// Drafts aren't published, so their anchors are free to change.
+	if !article.Draft {
+		currentAnchors.Set(article.Slug, articleAnchors)
+	}
 
 	tocContent, err := toc.Render(rendered)
 	if err != nil {
 		return err
 	}
 
-	locals := getLocals(name, map[string]interface{}{
-		"Content": rendered,
-		"TOC":     tocContent,
+	locals := getLocals(article.Title, map[string]interface{}{
+		"Article":     article,
+		"Backlinks":   backlinks,
+		"Content":     rendered,
+		"Description": article.Description,
+		"TOC":         tocContent,
+	})
+
+	// Each article gets its own directory with an index file so that it'll be
+	// served locally from a directory-level request. See the deploy target in
+	// the Makefile for how these are uploaded to S3.
+	dir := path.Join(singularity.TargetDir, "articles", article.Slug)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	return renderView(singularity.MainLayout,
+		path.Join(singularity.LayoutsDir, article.Layout),
+		path.Join(dir, "index.html"), locals)
+}
+
+// Compiles an Atom feed and a JSON Feed containing the full content of every
+// article. Content is rendered specially so that its images and links have
+// absolute URLs which will work from within a feed reader.
+func compileFeeds(articles []*Article, imageVariants map[string][]*markdown.ImageVariant,
+	linkTargets map[string]*markdown.LinkTarget) error {
+
+	start := time.Now()
+	defer func() {
+		log.Debugf("Compiled feeds in %v.", time.Now().Sub(start))
+	}()
+
+	atomFeed := &feeds.AtomFeed{
+		Author:   &feeds.AtomAuthor{Name: authorName, URI: conf.AbsoluteURL},
+		ID:       conf.AbsoluteURL + "/articles.atom",
+		Subtitle: siteDescription,
+		Title:    siteTitle,
+		XMLLang:  "en",
+
+		Links: []*feeds.AtomLink{
+			{Href: conf.AbsoluteURL + "/articles.atom", Rel: "self", Type: "application/atom+xml"},
+			{Href: conf.AbsoluteURL + "/", Rel: "alternate", Type: "text/html"},
+		},
+	}
+
+	jsonFeed := &feeds.JSONFeed{
+		Authors:     []*feeds.JSONFeedAuthor{{Name: authorName, URL: conf.AbsoluteURL}},
+		Description: siteDescription,
+		FeedURL:     conf.AbsoluteURL + "/articles.json",
+		HomePageURL: conf.AbsoluteURL + "/",
+		Items:       []*feeds.JSONFeedItem{},
+		Language:    "en",
+		Title:       siteTitle,
+	}
+
+	assetURLs := assetManifest.URLs()
+
+	for _, article := range articles {
+		url := conf.AbsoluteURL + article.URL()
+
+		content, err := article.render(&markdown.RenderOptions{
+			AbsoluteURLs:  true,
+			AssetURLs:     assetURLs,
+			BaseURL:       url,
+			ImageDir:      singularity.ContentDir + "/images",
+			ImageURL:      "/assets/",
+			ImageVariants: imageVariants,
+			LinkTargets:   linkTargets,
+			NoHeaderLinks: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		if article.LastUpdated().After(atomFeed.Updated) {
+			atomFeed.Updated = article.LastUpdated()
+		}
+
+		atomFeed.Entries = append(atomFeed.Entries, &feeds.AtomEntry{
+			Content:   &feeds.AtomContent{Content: content, Type: "html"},
+			ID:        url,
+			Link:      &feeds.AtomLink{Href: url, Rel: "alternate"},
+			Published: article.PublishedAt,
+			Summary:   article.Description,
+			Title:     article.Title,
+			Updated:   article.LastUpdated(),
+		})
+
+		jsonFeed.Items = append(jsonFeed.Items, &feeds.JSONFeedItem{
+			ContentHTML:   content,
+			DateModified:  article.UpdatedAt,
+			DatePublished: article.PublishedAt,
+			ID:            url,
+			Summary:       article.Description,
+			Title:         article.Title,
+			URL:           url,
+		})
+	}
+
+	err := writeFeed(path.Join(singularity.TargetDir, "articles.atom"), atomFeed)
+	if err != nil {
+		return err
+	}
+
+	return writeFeed(path.Join(singularity.TargetDir, "articles.json"), jsonFeed)
+}
+
+func compileIndex(articles []*Article) error {
+	start := time.Now()
+	defer func() {
+		log.Debugf("Compiled index in %v.", time.Now().Sub(start))
+	}()
+
+	// The index is at the path that an article may have been published at
+	// before there were others, so links to that article's sections are
+	// sent on to it.
+	var redirectURL string
+	for _, article := range articles {
+		for _, alias := range article.Aliases {
+			if alias == "/" {
+				redirectURL = article.URL()
+			}
+		}
+	}
+
+	locals := getLocals(siteTitle, map[string]interface{}{
+		"Articles":    articles,
+		"RedirectURL": redirectURL,
 	})
 
 	// Give index files an .html extension so that they'll be served locally
 	// from directory-level requests instead of a directory listing.
-	out := name
-	if name == "index" {
-		out = name + ".html"
+	return renderView(singularity.MainLayout,
+		path.Join(singularity.LayoutsDir, "index"),
+		path.Join(singularity.TargetDir, "index.html"), locals)
+}
+
+// Compiles the scripts of a bundle into a single fingerprinted asset named
+// after it. The asset is minified for production.
+func compileJavascripts(bundle *assets.Bundle) error {
+	name := bundle.Name + ".js"
+
+	err := assets.CompileJavascripts(bundle.Javascripts,
+		path.Join(singularity.TargetDir, "assets", name))
+	if err != nil {
+		return err
 	}
 
-	err = renderView(singularity.MainLayout,
-		path.Join(singularity.LayoutsDir, "article"),
-		path.Join(singularity.TargetDir, out), locals)
+	var replace func(js string, sourceMap *sourcemap.Map) (string, *sourcemap.Map, error)
+	if conf.Production {
+		replace = func(js string, sourceMap *sourcemap.Map) (string, *sourcemap.Map, error) {
+			return minifyAsset(name, js, sourceMap, minify.JSWithSourceMap)
+		}
+	}
+
+	return fingerprintAsset(name, "//# sourceMappingURL=%v\n", replace)
+}
+
+// Compiles the stylesheets of a bundle, along with the generated ones that it
+// includes, into a single fingerprinted asset named after it. Images and
+// fonts that they refer to are replaced with their fingerprinted versions,
+// and the asset is minified for production.
+func compileStylesheets(bundle *assets.Bundle, generated []*assets.Generated) error {
+	name := bundle.Name + ".css"
+
+	var included []*assets.Generated
+	for _, generatedName := range bundle.Generated {
+		var found *assets.Generated
+		for _, file := range generated {
+			if file.Name == generatedName {
+				found = file
+				break
+			}
+		}
+
+		if found == nil {
+			return fmt.Errorf("Bundle %q includes unknown generated stylesheet %q",
+				bundle.Name, generatedName)
+		}
+		included = append(included, found)
+	}
+
+	err := assets.CompileStylesheets(bundle.Stylesheets,
+		path.Join(singularity.TargetDir, "assets", name), included...)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	// Replacing URLs doesn't move anything onto a different line, so the
+	// source map still holds for the result.
+	return fingerprintAsset(name, "/*# sourceMappingURL=%v */\n",
+		func(css string, sourceMap *sourcemap.Map) (string, *sourcemap.Map, error) {
+			css, err := assets.ReplaceStylesheetURLs(css, assetManifest.URLPrefix, assetManifest.URLs())
+			if err != nil {
+				return "", nil, err
+			}
+
+			if conf.Production {
+				return minifyAsset(name, css, sourceMap, minify.CSSWithSourceMap)
+			}
+			return css, sourceMap, nil
+		})
 }
 
 //
@@ -213,27 +948,182 @@ func compileArticle(articleFile string) error {
 // resources.
 //
 
-func tasksForArticles() ([]*pool.Task, error) {
-	files, err := ioutil.ReadDir(path.Join(singularity.ContentDir, "articles"))
-	if err != nil {
-		return nil, err
+func tasksForArticles(articles []*Article, imageVariants map[string][]*markdown.ImageVariant,
+	linkTargets map[string]*markdown.LinkTarget, backlinks map[string][]*Backlink,
+	previousAnchors, currentAnchors *anchors.Manifest) []*pool.Task {
+
+	var tasks []*pool.Task
+	for _, article := range articles {
+		// be careful with closures in loops
+		article := article
+
+		tasks = append(tasks, pool.NewTask(func() error {
+			return compileArticle(article, imageVariants, linkTargets, backlinks[article.Slug],
+				previousAnchors, currentAnchors)
+		}))
 	}
 
+	return tasks
+}
+
+// Produces a task for each alias of every article that compiles a page
+// redirecting to it. The index handles an alias of "/" itself.
+func tasksForAliases(articles []*Article) []*pool.Task {
 	var tasks []*pool.Task
-	for _, fileInfo := range files {
+	for _, article := range articles {
+		for _, alias := range article.Aliases {
+			if alias == "/" {
+				continue
+			}
+
+			// be careful with closures in loops
+			article := article
+			alias := alias
+
+			tasks = append(tasks, pool.NewTask(func() error {
+				return compileAlias(article, alias)
+			}))
+		}
+	}
+
+	return tasks
+}
+
+// Produces a task for each article that finds its links to other articles.
+// Each link is added to backlinks under the slug of the article that it
+// points to as the tasks run. Only the first link from each section of an
+// article to another article is kept.
+func tasksForBacklinks(articles []*Article, imageVariants map[string][]*markdown.ImageVariant,
+	linkTargets map[string]*markdown.LinkTarget, backlinks map[string][]*Backlink) []*pool.Task {
+
+	slugsByURL := make(map[string]string)
+	for slug, target := range linkTargets {
+		slugsByURL[target.URL] = slug
+	}
+
+	var mu sync.Mutex
+	var tasks []*pool.Task
+	for _, article := range articles {
 		// be careful with closures in loops
-		name := fileInfo.Name()
+		article := article
+
+		tasks = append(tasks, pool.NewTask(func() error {
+			links, err := article.links(&markdown.RenderOptions{
+				ImageDir:      singularity.ContentDir + "/images",
+				ImageURL:      "/assets/",
+				ImageVariants: imageVariants,
+				LinkTargets:   linkTargets,
+			})
+			if err != nil {
+				return err
+			}
+
+			var targets []string
+			found := make(map[string][]*Backlink)
+			seen := make(map[string]bool)
+
+			for _, link := range links {
+				slug, ok := slugsByURL[articleURL(link.URL)]
+				if !ok || slug == article.Slug {
+					continue
+				}
+
+				backlink := &Backlink{Article: article, Context: link.Context, Section: link.Header}
+
+				key := slug + " " + backlink.URL()
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+
+				if _, ok := found[slug]; !ok {
+					targets = append(targets, slug)
+				}
+				found[slug] = append(found[slug], backlink)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, slug := range targets {
+				backlinks[slug] = append(backlinks[slug], found[slug]...)
+			}
+			return nil
+		}))
+	}
+
+	return tasks
+}
+
+// Produces a task for each high resolution image in content/images/originals
+// that generates its variants. The variants of each image are added to
+// imageVariants keyed by the URL of the image's 1x version as the tasks run.
+func tasksForImages(imageVariants map[string][]*markdown.ImageVariant) []*pool.Task {
+	sources, err := ioutil.ReadDir(singularity.ImageOriginalsDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return []*pool.Task{pool.NewTask(func() error { return err })}
+	}
 
-		if isHidden(name) {
+	var mu sync.Mutex
+	var tasks []*pool.Task
+	for _, source := range sources {
+		if isHidden(source.Name()) || !images.IsSource(source.Name()) {
 			continue
 		}
 
+		// be careful with closures in loops
+		source := source
+
+		tasks = append(tasks, pool.NewTask(func() error {
+			variants, err := processImage(path.Join(singularity.ImageOriginalsDir, source.Name()))
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			imageVariants[variants[0].URL] = variants
+			return nil
+		}))
+	}
+
+	return tasks
+}
+
+// Produces a task for each article that finds its headers so that other
+// articles can link to them. Links in the articles are resolved against
+// targets, and each article's link target is added to linkTargets keyed by
+// its slug as the tasks run.
+func tasksForLinkTargets(articles []*Article, imageVariants map[string][]*markdown.ImageVariant,
+	targets, linkTargets map[string]*markdown.LinkTarget) []*pool.Task {
+
+	var mu sync.Mutex
+	var tasks []*pool.Task
+	for _, article := range articles {
+		// be careful with closures in loops
+		article := article
+
 		tasks = append(tasks, pool.NewTask(func() error {
-			return compileArticle(name)
+			target, err := article.linkTarget(&markdown.RenderOptions{
+				ImageDir:      singularity.ContentDir + "/images",
+				ImageURL:      "/assets/",
+				ImageVariants: imageVariants,
+				LinkTargets:   targets,
+			})
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			linkTargets[article.Slug] = target
+			return nil
 		}))
 	}
 
-	return tasks, nil
+	return tasks
 }
 
 //
@@ -242,6 +1132,16 @@ func tasksForArticles() ([]*pool.Task, error) {
 // Any other functions. Try to keep them alphabetized.
 //
 
+// Gets the path of the article that a link points to from its URL by
+// removing any fragment, trailing slash, or absolute URL of the site.
+func articleURL(url string) string {
+	if i := strings.Index(url, "#"); i != -1 {
+		url = url[:i]
+	}
+	url = strings.TrimPrefix(url, conf.AbsoluteURL)
+	return strings.TrimSuffix(url, "/")
+}
+
 func ensureSymlink(source, dest string) error {
 	log.Debugf("Checking symbolic link (%v): %v -> %v",
 		path.Base(source), source, dest)
@@ -286,13 +1186,84 @@ create:
 	return os.Symlink(source, dest)
 }
 
+// Gives a bundle that's been built into the assets directory under its plain
+// name, along with the source map next to it, fingerprinted names instead and
+// records both in the manifest. The bundle is ended with a comment pointing
+// to its map, which is produced by filling in commentFormat with the map's
+// name.
+//
+// If replace is given, the bundle's contents are first passed through it. It
+// returns the new contents along with a source map for them.
+func fingerprintAsset(name, commentFormat string,
+	replace func(data string, sourceMap *sourcemap.Map) (string, *sourcemap.Map, error)) error {
+
+	source := path.Join(singularity.TargetDir, "assets", name)
+
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		return err
+	}
+
+	mapData, err := ioutil.ReadFile(source + ".map")
+	if err != nil {
+		return err
+	}
+
+	sourceMap, err := sourcemap.Decode(mapData)
+	if err != nil {
+		return fmt.Errorf("%v.map: %v", name, err)
+	}
+
+	if replace != nil {
+		replaced, replacedMap, err := replace(string(data), sourceMap)
+		if err != nil {
+			return fmt.Errorf("%v: %v", name, err)
+		}
+		data, sourceMap = []byte(replaced), replacedMap
+	}
+
+	mapData, err = sourceMap.Encode()
+	if err != nil {
+		return fmt.Errorf("%v.map: %v", name, err)
+	}
+
+	mapFingerprinted := assetManifest.Add(name+".map", mapData)
+	err = ioutil.WriteFile(path.Join(singularity.TargetDir, "assets", mapFingerprinted), mapData, 0644)
+	if err != nil {
+		return err
+	}
+
+	// The map is served from the same directory as the bundle, so its name
+	// alone is enough to find it.
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	data = append(data, fmt.Sprintf(commentFormat, mapFingerprinted)...)
+
+	fingerprinted := assetManifest.Add(name, data)
+	err = ioutil.WriteFile(path.Join(singularity.TargetDir, "assets", fingerprinted), data, 0644)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(source + ".map")
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(source)
+}
+
 // Gets a map of local values for use while rendering a template and includes
 // a few "special" values that are globally relevant to all templates.
 func getLocals(title string, locals map[string]interface{}) map[string]interface{} {
 	defaults := map[string]interface{}{
+		"FontPreloads":      fontPreloads,
 		"GoogleAnalyticsID": conf.GoogleAnalyticsID,
-		"LocalFonts":        conf.LocalFonts,
-		"Release":           singularity.Release,
+		"GoogleFontsURL":    googleFontsURL,
+		"RetinaJS":          conf.RetinaJS,
+		"SiteDescription":   siteDescription,
+		"SiteTitle":         siteTitle,
 		"Title":             title,
 		"ViewportWidth":     "device-width",
 	}
@@ -304,10 +1275,208 @@ func getLocals(title string, locals map[string]interface{}) map[string]interface
 	return defaults
 }
 
+// Groups articles by the year in which they were published. Articles are
+// expected to already be sorted in reverse-chronological order, and the
+// groups are returned in the same order.
+func groupArticlesByYear(articles []*Article) []*articleYear {
+	var years []*articleYear
+	var year *articleYear
+
+	for _, article := range articles {
+		if year == nil || year.Year != article.PublishedAt.Year() {
+			year = &articleYear{Year: article.PublishedAt.Year()}
+			years = append(years, year)
+		}
+
+		year.Articles = append(year.Articles, article)
+	}
+
+	return years
+}
+
 func isHidden(file string) bool {
 	return strings.HasPrefix(file, ".")
 }
 
+// Reads an article from the given file and parses its front matter. Errors
+// for malformed or incomplete front matter name the file and line where the
+// problem occurred.
+func loadArticle(file string) (*Article, error) {
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var article Article
+	content, contentLine, err := frontmatter.Decode(file, string(source), &article)
+	if err != nil {
+		return nil, err
+	}
+
+	// Missing keys are reported at the first one's line if it's there but
+	// empty, and otherwise at the end of the front matter where it belongs.
+	missing := article.validate()
+	if len(missing) > 0 {
+		return nil, &frontmatter.Error{
+			File:    file,
+			Line:    frontmatter.KeyLine(string(source), missing[0]),
+			Message: "Front matter missing required key(s): " + strings.Join(missing, ", "),
+		}
+	}
+
+	article.Content = content
+	article.File = file
+	article.Slug = trimExtension(path.Base(file))
+	article.contentLine = contentLine
+
+	if article.Layout == "" {
+		article.Layout = "article"
+	}
+
+	return &article, nil
+}
+
+// Links a file into the assets directory under a fingerprinted version of
+// name, which is its path within the directory, and records it in the
+// manifest.
+func linkAsset(name, source string) error {
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		return err
+	}
+
+	fingerprinted := assetManifest.Add(name, data)
+
+	// we use absolute paths for source and destination because not doing
+	// so can result in some weird symbolic link inception
+	source, err = filepath.Abs(source)
+	if err != nil {
+		return err
+	}
+
+	dest, err := filepath.Abs(path.Join(singularity.TargetDir, "assets", fingerprinted))
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(path.Dir(dest), 0755)
+	if err != nil {
+		return err
+	}
+
+	return ensureSymlink(source, dest)
+}
+
+// Loads every article in the articles directory and returns them sorted in
+// reverse-chronological order. Drafts are omitted unless they've been enabled
+// in configuration, and the slugs of those that were are returned separately.
+func loadArticles() ([]*Article, []string, error) {
+	start := time.Now()
+	defer func() {
+		log.Debugf("Loaded articles in %v.", time.Now().Sub(start))
+	}()
+
+	dir := path.Join(singularity.ContentDir, "articles")
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var articles []*Article
+	var drafts []string
+	for _, fileInfo := range files {
+		if isHidden(fileInfo.Name()) {
+			continue
+		}
+
+		article, err := loadArticle(path.Join(dir, fileInfo.Name()))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if article.Draft && !conf.Drafts {
+			log.Debugf("Skipping draft: %v", article.Slug)
+			drafts = append(drafts, article.Slug)
+			continue
+		}
+
+		articles = append(articles, article)
+	}
+
+	// Pages that the build generates can't be aliases, except for the index,
+	// which redirects links with fragments that aren't its own.
+	claimed := map[string]string{"/archive": "the archive"}
+	for _, article := range articles {
+		claimed[article.URL()] = article.File
+	}
+	for _, article := range articles {
+		err := article.checkAliases(claimed)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	sortArticles(articles)
+	return articles, drafts, nil
+}
+
+// Minifies an asset and reports how much smaller it got. The source map of
+// the minified asset is composed with sourceMap so that it still points back
+// to the original sources.
+func minifyAsset(name, data string, sourceMap *sourcemap.Map,
+	minifier func(source, name string) (string, *sourcemap.Map, error)) (string, *sourcemap.Map, error) {
+
+	minified, minifiedMap, err := minifier(data, name)
+	if err != nil {
+		return "", nil, err
+	}
+
+	log.Infof("Minified %v from %v to %v bytes.", name, len(data), len(minified))
+	return minified, sourcemap.Compose(minifiedMap, sourceMap), nil
+}
+
+// Checks that every article in an anchors manifest from the last build is
+// still being built, because links to its anchors would otherwise break.
+// Drafts are exempt. So are articles that have moved to a new slug, as long as
+// the article that they moved to has their old URL as an alias, and in that
+// case their anchors are moved to it in the manifest so that they're checked
+// against its new ones.
+func moveAnchors(manifest *anchors.Manifest, articles []*Article, drafts []string) error {
+	present := make(map[string]bool)
+	for _, slug := range drafts {
+		present[slug] = true
+	}
+
+	aliased := make(map[string]*Article)
+	for _, article := range articles {
+		present[article.Slug] = true
+		for _, alias := range article.Aliases {
+			aliased[alias] = article
+		}
+	}
+
+	for _, slug := range manifest.Slugs() {
+		if present[slug] {
+			continue
+		}
+
+		url := (&Article{Slug: slug}).URL()
+		article, ok := aliased[url]
+		if !ok {
+			return fmt.Errorf("article %q has anchors in %v but is no longer built "+
+				"(add %q to the aliases of the article that replaced it)",
+				slug, singularity.AnchorsManifest, url)
+		}
+
+		current := manifest.Get(article.Slug)
+		manifest.Set(article.Slug, append(anchors.Missing(manifest.Get(slug), current), current...))
+		manifest.Delete(slug)
+	}
+
+	return nil
+}
+
 func renderView(layout, view, target string, locals map[string]interface{}) error {
 	log.Debugf("Rendering: %v", target)
 
@@ -357,6 +1526,47 @@ func runTasks(tasks []*pool.Task) bool {
 	return !p.HasErrors()
 }
 
+// Sorts articles in reverse-chronological order of publication. Articles
+// published at the same time are ordered by slug so that output is stable.
+func sortArticles(articles []*Article) {
+	sort.Slice(articles, func(i, j int) bool {
+		if articles[i].PublishedAt.Equal(articles[j].PublishedAt) {
+			return articles[i].Slug < articles[j].Slug
+		}
+		return articles[i].PublishedAt.After(articles[j].PublishedAt)
+	})
+}
+
+// Sorts the backlinks of each article so that those from the same article are
+// together, in the same order as articles, and otherwise in the order that
+// they appear.
+func sortBacklinks(backlinks map[string][]*Backlink) {
+	for _, links := range backlinks {
+		sort.SliceStable(links, func(i, j int) bool {
+			a, b := links[i].Article, links[j].Article
+			if a.PublishedAt.Equal(b.PublishedAt) {
+				return a.Slug < b.Slug
+			}
+			return a.PublishedAt.After(b.PublishedAt)
+		})
+	}
+}
+
 func trimExtension(file string) string {
 	return strings.TrimSuffix(file, filepath.Ext(file))
 }
+
+func writeFeed(target string, feed feedEncoder) error {
+	log.Debugf("Rendering: %v", target)
+
+	file, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	defer writer.Flush()
+
+	return feed.Encode(writer, "  ")
+}
@@ -5,13 +5,197 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/brandur/singularity"
+	"github.com/brandur/singularity/anchors"
+	"github.com/brandur/singularity/markdown"
 	"github.com/brandur/singularity/pool"
 	assert "github.com/stretchr/testify/require"
 )
 
+func TestArticleLastUpdated(t *testing.T) {
+	publishedAt := time.Date(2017, 10, 1, 0, 0, 0, 0, time.UTC)
+	updatedAt := time.Date(2017, 10, 15, 0, 0, 0, 0, time.UTC)
+
+	article := &Article{PublishedAt: publishedAt}
+	assert.Equal(t, publishedAt, article.LastUpdated())
+
+	article.UpdatedAt = &updatedAt
+	assert.Equal(t, updatedAt, article.LastUpdated())
+}
+
+func TestArticleCheckAliases(t *testing.T) {
+	claimed := map[string]string{"/archive": "the archive"}
+
+	article := &Article{Aliases: []string{"/", "/manifesto"}, File: "a.md"}
+	assert.NoError(t, article.checkAliases(claimed))
+	assert.Equal(t, "a.md", claimed["/manifesto"])
+
+	article = &Article{Aliases: []string{"/manifesto"}, File: "b.md"}
+	assert.Equal(t, `b.md: alias "/manifesto" is already used by a.md`,
+		article.checkAliases(claimed).Error())
+
+	article = &Article{Aliases: []string{"/archive"}, File: "b.md"}
+	assert.Equal(t, `b.md: alias "/archive" is already used by the archive`,
+		article.checkAliases(claimed).Error())
+
+	article = &Article{Aliases: []string{"manifesto"}, File: "b.md"}
+	assert.Equal(t, `b.md: alias "manifesto" should be a path starting with /`,
+		article.checkAliases(claimed).Error())
+
+	// Aliases are compared once they're cleaned
+	article = &Article{Aliases: []string{"/manifesto/"}, File: "b.md"}
+	assert.Equal(t, `b.md: alias "/manifesto" is already used by a.md`,
+		article.checkAliases(claimed).Error())
+
+	article = &Article{Aliases: []string{"/old//manifesto/"}, File: "b.md"}
+	assert.NoError(t, article.checkAliases(claimed))
+	assert.Equal(t, []string{"/old/manifesto"}, article.Aliases)
+
+	// Aliases can't lead out of the site
+	article = &Article{Aliases: []string{"/../../etc"}, File: "b.md"}
+	assert.Equal(t, `b.md: alias "/../../etc" shouldn't contain ..`,
+		article.checkAliases(claimed).Error())
+}
+
+func TestArticleCheckAnchors(t *testing.T) {
+	rendered := `<h2 id="intro"><a href="#intro">Intro</a></h2>
+<h2 id="walk-away-test"><a href="#walk-away-test">The walk away test</a></h2>`
+
+	article := &Article{File: "article.md"}
+
+	current, err := article.checkAnchors(rendered, []string{"intro"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"intro", "walk-away-test"}, current)
+
+	_, err = article.checkAnchors(rendered, []string{"intro", "walk-away"})
+	assert.Equal(t, "article.md: anchor(s) walk-away disappeared since the last build "+
+		"(add anchor_aliases to the front matter mapping each one to its replacement)",
+		err.Error())
+
+	// An alias keeps an old anchor alive
+	article.AnchorAliases = map[string]string{"walk-away": "walk-away-test"}
+	current, err = article.checkAnchors(rendered, []string{"intro", "walk-away"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"intro", "walk-away-test", "walk-away"}, current)
+
+	// Drafts can change freely
+	article.AnchorAliases = nil
+	article.Draft = true
+	_, err = article.checkAnchors(rendered, []string{"intro", "walk-away"})
+	assert.NoError(t, err)
+	article.Draft = false
+
+	article.AnchorAliases = map[string]string{"walk-away": "nonexistent"}
+	_, err = article.checkAnchors(rendered, nil)
+	assert.Equal(t, `article.md: anchor alias "walk-away" points to "nonexistent", `+
+		`which isn't an anchor in the article`, err.Error())
+
+	article.AnchorAliases = map[string]string{"intro": "walk-away-test"}
+	_, err = article.checkAnchors(rendered, nil)
+	assert.Equal(t, `article.md: anchor alias "intro" is still an anchor in the article`,
+		err.Error())
+}
+
+func TestArticleLinkTarget(t *testing.T) {
+	article := &Article{
+		AnchorAliases: map[string]string{"walk-away": "walk-away-test"},
+		Content:       "Intro.\n\n## The *Walk Away* Test (#walk-away-test)\n\n## Conclusion",
+		File:          "article.md",
+		Slug:          "article",
+		Title:         "An Article",
+		contentLine:   5,
+	}
+
+	target, err := article.linkTarget(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &markdown.LinkTarget{
+		Headers: map[string]string{
+			"conclusion":     "Conclusion",
+			"walk-away":      "The Walk Away Test",
+			"walk-away-test": "The Walk Away Test",
+		},
+		Title: "An Article",
+		URL:   "/articles/article",
+	}, target)
+
+	article.Content = "Intro.\n\n!fig"
+	_, err = article.linkTarget(nil)
+	assert.Equal(t, `article.md:7: Directive !fig is missing required attribute "src"`, err.Error())
+}
+
+func TestBacklinkURL(t *testing.T) {
+	backlink := &Backlink{Article: &Article{Slug: "article"}}
+	assert.Equal(t, "/articles/article", backlink.URL())
+
+	backlink.Section = &markdown.Header{ID: "section"}
+	assert.Equal(t, "/articles/article#section", backlink.URL())
+}
+
+func TestMoveAnchors(t *testing.T) {
+	manifest := anchors.NewManifest()
+	manifest.Set("current", []string{"a"})
+	manifest.Set("draft", []string{"b"})
+	manifest.Set("old", []string{"a", "c"})
+
+	current := &Article{Slug: "current", Aliases: []string{"/articles/old"}}
+
+	// An article that moved has its anchors checked against where it went
+	assert.NoError(t, moveAnchors(manifest, []*Article{current}, []string{"draft"}))
+	assert.Equal(t, []string{"current", "draft"}, manifest.Slugs())
+	assert.Equal(t, []string{"a", "c"}, manifest.Get("current"))
+
+	manifest.Set("removed", []string{"d"})
+	assert.Equal(t, `article "removed" has anchors in `+singularity.AnchorsManifest+
+		` but is no longer built (add "/articles/removed" to the aliases of the article that replaced it)`,
+		moveAnchors(manifest, []*Article{current}, []string{"draft"}).Error())
+}
+
+func TestTasksForBacklinks(t *testing.T) {
+	conf.AbsoluteURL = "https://example.com"
+	conf.Concurrency = 3
+
+	target := &Article{Slug: "target", Title: "Target", Content: "## Section"}
+	linking := &Article{
+		Slug:  "linking",
+		Title: "Linking",
+		Content: "See [[target]] and [[linking]].\n\n" +
+			"## Section\n\nSee [[target#section]] and [again](https://example.com/articles/target/).",
+		PublishedAt: time.Date(2017, 10, 1, 0, 0, 0, 0, time.UTC),
+	}
+	older := &Article{
+		Slug:        "older",
+		Content:     "See [[target]].",
+		PublishedAt: time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+	articles := []*Article{linking, older, target}
+
+	titleTargets := make(map[string]*markdown.LinkTarget)
+	for _, article := range articles {
+		titleTargets[article.Slug] = &markdown.LinkTarget{Title: article.Title, URL: article.URL()}
+	}
+
+	linkTargets := make(map[string]*markdown.LinkTarget)
+	assert.True(t, runTasks(tasksForLinkTargets(articles, nil, titleTargets, linkTargets)))
+
+	backlinks := make(map[string][]*Backlink)
+	assert.True(t, runTasks(tasksForBacklinks(articles, nil, linkTargets, backlinks)))
+	sortBacklinks(backlinks)
+
+	// Links to an article from itself aren't included, and neither are more
+	// than one from the same section
+	assert.Equal(t, []string{"target"}, keys(backlinks))
+	assert.Equal(t, []*Backlink{
+		{Article: linking, Context: "See Target and Linking."},
+		{Article: linking, Context: "See Section and again.",
+			Section: &markdown.Header{ID: "section", Level: 2, Text: "Section"}},
+		{Article: older, Context: "See Target."},
+	}, backlinks["target"])
+}
+
 func TestEnsureSymlink(t *testing.T) {
 	dir, err := ioutil.TempDir("", "symlink")
 	assert.NoError(t, err)
@@ -68,15 +252,93 @@ func TestGetLocals(t *testing.T) {
 	})
 
 	assert.Equal(t, "Bar", locals["Foo"])
-	assert.Equal(t, singularity.Release, locals["Release"])
+	assert.Equal(t, siteTitle, locals["SiteTitle"])
+	assert.Equal(t, siteDescription, locals["SiteDescription"])
 	assert.Equal(t, "Title", locals["Title"])
 }
 
+func TestGroupArticlesByYear(t *testing.T) {
+	article1 := &Article{PublishedAt: time.Date(2017, 10, 1, 0, 0, 0, 0, time.UTC)}
+	article2 := &Article{PublishedAt: time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)}
+	article3 := &Article{PublishedAt: time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)}
+
+	years := groupArticlesByYear([]*Article{article1, article2, article3})
+	assert.Equal(t, 2, len(years))
+	assert.Equal(t, 2017, years[0].Year)
+	assert.Equal(t, []*Article{article1, article2}, years[0].Articles)
+	assert.Equal(t, 2015, years[1].Year)
+	assert.Equal(t, []*Article{article3}, years[1].Articles)
+
+	assert.Equal(t, 0, len(groupArticlesByYear(nil)))
+}
+
 func TestIsHidden(t *testing.T) {
 	assert.Equal(t, true, isHidden(".gitkeep"))
 	assert.Equal(t, false, isHidden("article"))
 }
 
+func TestLoadArticle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "articles")
+	assert.NoError(t, err)
+
+	//
+	// Success case
+	//
+
+	file := path.Join(dir, "hello-world.md")
+	err = ioutil.WriteFile(file, []byte(`---
+title: Hello, world
+published_at: 2017-10-01T00:00:00Z
+---
+
+Content.
+`), 0755)
+	assert.NoError(t, err)
+
+	article, err := loadArticle(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "\nContent.\n", article.Content)
+	assert.Equal(t, "article", article.Layout)
+	assert.Equal(t, "hello-world", article.Slug)
+	assert.Equal(t, "Hello, world", article.Title)
+
+	//
+	// Missing required keys
+	//
+
+	err = ioutil.WriteFile(file, []byte(`---
+subtitle: No title here
+---
+`), 0755)
+	assert.NoError(t, err)
+
+	_, err = loadArticle(file)
+	assert.Equal(t, file+":3: Front matter missing required key(s): published_at, title",
+		err.Error())
+
+	// A key that's there but empty is reported where it is
+	err = ioutil.WriteFile(file, []byte(`---
+title: Hello, world
+published_at: 0001-01-01T00:00:00Z
+---
+`), 0755)
+	assert.NoError(t, err)
+
+	_, err = loadArticle(file)
+	assert.Equal(t, file+":3: Front matter missing required key(s): published_at",
+		err.Error())
+}
+
+func TestSortArticles(t *testing.T) {
+	article1 := &Article{Slug: "a", PublishedAt: time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)}
+	article2 := &Article{Slug: "b", PublishedAt: time.Date(2017, 10, 1, 0, 0, 0, 0, time.UTC)}
+	article3 := &Article{Slug: "c", PublishedAt: time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)}
+
+	articles := []*Article{article1, article2, article3}
+	sortArticles(articles)
+	assert.Equal(t, []*Article{article2, article1, article3}, articles)
+}
+
 func TestRunTasks(t *testing.T) {
 	conf.Concurrency = 3
 
@@ -123,3 +385,16 @@ func TestRunTasks(t *testing.T) {
 	}
 	assert.Equal(t, false, runTasks(tasks))
 }
+
+//
+// Helpers
+//
+
+func keys(m map[string][]*Backlink) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,536 @@
+// Package diagram converts ASCII line art to SVG in the style of svgbob, so
+// that diagrams can live in Markdown as plain text and still be rendered
+// cleanly:
+//
+//	.--------.      +--------+
+//	| Client |----->| Server |
+//	'--------'      +--------+
+//
+// Lines are drawn with "-", "_", "|", "/", and "\". Corners and junctions are
+// drawn with "+", or rounded with "." and "," above a line and "'" and "`"
+// below one. Arrowheads are ">", "<", "^", and "v", and "*" and "o" are
+// filled and open dots. Anything else is text, as is any of those characters
+// when it doesn't connect to the rest of the drawing or sits right next to a
+// letter or number.
+package diagram
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Size of a character cell in the SVG. Cells are twice as tall as they are
+// wide so that diagonal lines meet the corners of cells.
+const (
+	cellHeight = 16
+	cellWidth  = 8
+)
+
+// Size of text in the SVG, which is about right for a monospace font to fill
+// a cell.
+const fontSize = 14
+
+// Radius of the circle drawn for "*" and "o".
+const dotRadius = 3
+
+// Render converts ASCII line art to an SVG element.
+func Render(source string) string {
+	g := newGrid(source)
+	g.classify()
+
+	var lines []*segment
+	var paths, circles, shapes []string
+	var texts []string
+
+	for y, row := range g.cells {
+		for x := 0; x < len(row); x++ {
+			if !g.art[y][x] {
+				if row[x] == ' ' {
+					continue
+				}
+
+				// Words separated by single spaces are kept together as
+				// one piece of text.
+				end := x
+				for end+1 < len(row) && !g.art[y][end+1] &&
+					(row[end+1] != ' ' || (end+2 < len(row) && row[end+2] != ' ' && !g.art[y][end+2])) {
+					end++
+				}
+
+				texts = append(texts, fmt.Sprintf(`<text x="%v" y="%v">%s</text>`,
+					x*cellWidth, y*cellHeight+cellHeight*3/4, html.EscapeString(string(row[x:end+1]))))
+				x = end
+				continue
+			}
+
+			c := cell{x, y}
+			connected := g.connections(x, y)
+
+			switch row[x] {
+			case '-':
+				lines = append(lines, &segment{c.edge(left), c.edge(right)})
+
+			case '_':
+				lines = append(lines, &segment{c.edge(downLeft), c.edge(downRight)})
+
+			case '|':
+				lines = append(lines, &segment{c.edge(up), c.edge(down)})
+
+			case '/':
+				lines = append(lines, &segment{c.edge(downLeft), c.edge(upRight)})
+
+			case '\\':
+				lines = append(lines, &segment{c.edge(upLeft), c.edge(downRight)})
+
+			case '.', ',', '\'', '`':
+				// A corner between two lines is rounded off. Anything else
+				// is a junction like "+".
+				if len(connected) == 2 && connected[0].opposite() != connected[1] {
+					from, to := c.edge(connected[0]), c.edge(connected[1])
+					center := c.center()
+					paths = append(paths, fmt.Sprintf(`<path d="M%v,%v Q%v,%v %v,%v"></path>`,
+						format(from.x), format(from.y), format(center.x), format(center.y),
+						format(to.x), format(to.y)))
+					continue
+				}
+				lines = append(lines, c.spokes(connected, 0)...)
+
+			case '+':
+				lines = append(lines, c.spokes(connected, 0)...)
+
+			case '*':
+				lines = append(lines, c.spokes(connected, 0)...)
+				center := c.center()
+				shapes = append(shapes, fmt.Sprintf(`<circle cx="%v" cy="%v" r="%v"></circle>`,
+					format(center.x), format(center.y), dotRadius))
+
+			case 'o':
+				// Lines stop at the edge of the circle so that it stays
+				// open.
+				lines = append(lines, c.spokes(connected, dotRadius)...)
+				center := c.center()
+				circles = append(circles, fmt.Sprintf(`<circle cx="%v" cy="%v" r="%v"></circle>`,
+					format(center.x), format(center.y), dotRadius))
+
+			case '>', '<', '^', 'v', 'V':
+				tip, line := c.arrow(row[x])
+				if line != nil {
+					lines = append(lines, line)
+				}
+				shapes = append(shapes, fmt.Sprintf(`<polygon points="%s"></polygon>`, tip))
+			}
+		}
+	}
+
+	width := g.width() * cellWidth
+	height := len(g.cells) * cellHeight
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%v" height="%v" viewBox="0 0 %v %v">`,
+		width, height, width, height)
+
+	if len(lines) > 0 || len(paths) > 0 || len(circles) > 0 {
+		b.WriteString(`<g fill="none" stroke="currentColor" stroke-width="1.5" ` +
+			`stroke-linecap="round" stroke-linejoin="round">`)
+		for _, line := range mergeSegments(lines) {
+			fmt.Fprintf(&b, `<line x1="%v" y1="%v" x2="%v" y2="%v"></line>`,
+				format(line.from.x), format(line.from.y), format(line.to.x), format(line.to.y))
+		}
+		b.WriteString(strings.Join(paths, ""))
+		b.WriteString(strings.Join(circles, ""))
+		b.WriteString(`</g>`)
+	}
+
+	if len(shapes) > 0 {
+		b.WriteString(`<g fill="currentColor">`)
+		b.WriteString(strings.Join(shapes, ""))
+		b.WriteString(`</g>`)
+	}
+
+	if len(texts) > 0 {
+		fmt.Fprintf(&b, `<g fill="currentColor" font-family="monospace" font-size="%v">`, fontSize)
+		b.WriteString(strings.Join(texts, ""))
+		b.WriteString(`</g>`)
+	}
+
+	b.WriteString(`</svg>`)
+	return b.String()
+}
+
+//
+// Grid
+//
+
+// A direction from a cell to one of its neighbors.
+type direction int
+
+const (
+	up direction = iota
+	upRight
+	right
+	downRight
+	down
+	downLeft
+	left
+	upLeft
+)
+
+var directions = []direction{up, upRight, right, downRight, down, downLeft, left, upLeft}
+
+// Offsets of the neighbor in each direction, indexed by direction.
+var directionOffsets = []struct{ dx, dy int }{
+	{0, -1}, {1, -1}, {1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1},
+}
+
+func (d direction) opposite() direction {
+	return (d + 4) % 8
+}
+
+// The directions in which each drawing character can connect to its
+// neighbors.
+var connectors = map[rune][]direction{
+	'-':  {left, right},
+	'_':  {left, right},
+	'|':  {up, down},
+	'/':  {upRight, downLeft},
+	'\\': {upLeft, downRight},
+	'+':  directions,
+	'*':  directions,
+	'o':  directions,
+	'.':  {left, right, down, downLeft, downRight},
+	',':  {left, right, down, downLeft, downRight},
+	'\'': {left, right, up, upLeft, upRight},
+	'`':  {left, right, up, upLeft, upRight},
+	'>':  {left},
+	'<':  {right},
+	'^':  {down},
+	'v':  {up},
+	'V':  {up},
+}
+
+// Drawing characters that are also common in prose, which are taken as text
+// when they follow on from other text like in "etc..." or "it's".
+var textual = map[rune]bool{
+	'.':  true,
+	',':  true,
+	'\'': true,
+	'`':  true,
+	'_':  true,
+	'o':  true,
+	'v':  true,
+	'V':  true,
+}
+
+// A grid of characters along with which of them are part of the drawing.
+type grid struct {
+	art   [][]bool
+	cells [][]rune
+}
+
+func newGrid(source string) *grid {
+	lines := strings.Split(strings.TrimRight(source, " \t\n"), "\n")
+
+	// Tabs are expanded to the next multiple of eight columns.
+	for i, line := range lines {
+		var b bytes.Buffer
+		column := 0
+		for _, r := range strings.TrimRight(line, " \t") {
+			if r == '\t' {
+				spaces := 8 - column%8
+				b.WriteString(strings.Repeat(" ", spaces))
+				column += spaces
+				continue
+			}
+			b.WriteRune(r)
+			column++
+		}
+		lines[i] = b.String()
+	}
+
+	// Indentation common to every line is removed.
+	indent := -1
+	for _, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" {
+			continue
+		}
+		if n := len(line) - len(trimmed); indent == -1 || n < indent {
+			indent = n
+		}
+	}
+
+	g := &grid{}
+	for _, line := range lines {
+		if len(line) >= indent && indent > 0 {
+			line = line[indent:]
+		}
+		g.cells = append(g.cells, []rune(line))
+		g.art = append(g.art, make([]bool, len([]rune(line))))
+	}
+	return g
+}
+
+func (g *grid) at(x, y int) rune {
+	if y < 0 || y >= len(g.cells) || x < 0 || x >= len(g.cells[y]) {
+		return ' '
+	}
+	return g.cells[y][x]
+}
+
+func (g *grid) isArt(x, y int) bool {
+	if y < 0 || y >= len(g.cells) || x < 0 || x >= len(g.cells[y]) {
+		return false
+	}
+	return g.art[y][x]
+}
+
+func (g *grid) isText(x, y int) bool {
+	return g.at(x, y) != ' ' && !g.isArt(x, y)
+}
+
+// Decides which characters are part of the drawing. Every drawing character
+// starts out as part of it, and then any that don't connect to another part
+// of the drawing or that look like they're part of a word are taken as text
+// until nothing changes.
+//
+// A character right next to a letter or number is only kept when it connects
+// up or down, so the edges of a box stay part of it even when a label runs
+// up against them like in "|a |", but "key-value" and "C++" are text.
+func (g *grid) classify() {
+	for y, row := range g.cells {
+		for x, r := range row {
+			_, ok := connectors[r]
+			g.art[y][x] = ok
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for y, row := range g.cells {
+			for x, r := range row {
+				if !g.art[y][x] {
+					continue
+				}
+
+				connections := g.connections(x, y)
+				besideWord := isWordCharacter(g.at(x-1, y)) || isWordCharacter(g.at(x+1, y))
+
+				if len(connections) == 0 ||
+					(besideWord && !connectsVertically(connections)) ||
+					(textual[r] && (g.isText(x-1, y) || g.isText(x+1, y))) {
+					g.art[y][x] = false
+					changed = true
+				}
+			}
+		}
+	}
+}
+
+// Gets the directions in which a drawing character connects to its
+// neighbors, which is wherever both it and the neighbor can connect toward
+// each other.
+func (g *grid) connections(x, y int) []direction {
+	var connected []direction
+	for _, d := range connectors[g.at(x, y)] {
+		offset := directionOffsets[d]
+		nx, ny := x+offset.dx, y+offset.dy
+		if !g.isArt(nx, ny) {
+			continue
+		}
+
+		for _, other := range connectors[g.at(nx, ny)] {
+			if other == d.opposite() {
+				connected = append(connected, d)
+				break
+			}
+		}
+	}
+	return connected
+}
+
+// Checks whether a drawing character's connections include one straight up
+// or down.
+func connectsVertically(connections []direction) bool {
+	for _, d := range connections {
+		if d == up || d == down {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *grid) width() int {
+	width := 0
+	for _, row := range g.cells {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	return width
+}
+
+// Checks whether a character is a letter or number that isn't also a drawing
+// character, like the "o" in "-o-".
+func isWordCharacter(r rune) bool {
+	if _, ok := connectors[r]; ok {
+		return false
+	}
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+//
+// Geometry
+//
+
+type point struct {
+	x, y float64
+}
+
+// A straight line between two points.
+type segment struct {
+	from, to point
+}
+
+// A cell in the grid.
+type cell struct {
+	x, y int
+}
+
+func (c cell) center() point {
+	return point{float64(c.x*cellWidth) + cellWidth/2, float64(c.y*cellHeight) + cellHeight/2}
+}
+
+// Gets the point on the cell's edge in the given direction. Diagonals go to
+// the cell's corners.
+func (c cell) edge(d direction) point {
+	offset := directionOffsets[d]
+	center := c.center()
+	return point{
+		center.x + float64(offset.dx*cellWidth)/2,
+		center.y + float64(offset.dy*cellHeight)/2,
+	}
+}
+
+// Gets an arrowhead's points along with the line leading up to it, if any.
+func (c cell) arrow(r rune) (string, *segment) {
+	center := c.center()
+	top, bottom := center.y-cellHeight/2, center.y+cellHeight/2
+	leftEdge, rightEdge := center.x-cellWidth/2, center.x+cellWidth/2
+
+	var points []point
+	var line *segment
+
+	switch r {
+	case '>':
+		points = []point{{rightEdge, center.y}, {leftEdge, center.y - 4}, {leftEdge, center.y + 4}}
+	case '<':
+		points = []point{{leftEdge, center.y}, {rightEdge, center.y - 4}, {rightEdge, center.y + 4}}
+	case '^':
+		points = []point{{center.x, top}, {center.x - 4, top + 8}, {center.x + 4, top + 8}}
+		line = &segment{point{center.x, top + 8}, point{center.x, bottom}}
+	default:
+		points = []point{{center.x, bottom}, {center.x - 4, bottom - 8}, {center.x + 4, bottom - 8}}
+		line = &segment{point{center.x, top}, point{center.x, bottom - 8}}
+	}
+
+	formatted := make([]string, len(points))
+	for i, p := range points {
+		formatted[i] = format(p.x) + "," + format(p.y)
+	}
+	return strings.Join(formatted, " "), line
+}
+
+// Gets lines from the cell's center out to its edges in the given
+// directions, starting the given distance out from the center.
+func (c cell) spokes(connected []direction, start float64) []*segment {
+	var segments []*segment
+	center := c.center()
+	for _, d := range connected {
+		to := c.edge(d)
+		from := center
+		if start > 0 {
+			length := math.Hypot(to.x-center.x, to.y-center.y)
+			from = point{
+				center.x + (to.x-center.x)*start/length,
+				center.y + (to.y-center.y)*start/length,
+			}
+		}
+		segments = append(segments, &segment{from, to})
+	}
+	return segments
+}
+
+// Joins segments that lie on the same line and touch or overlap, so that
+// something like a box's side is drawn as one line instead of one for each
+// character.
+func mergeSegments(segments []*segment) []*segment {
+	type key struct {
+		slope, intercept float64
+		vertical         bool
+	}
+
+	var keys []key
+	groups := make(map[key][]*segment)
+
+	for _, s := range segments {
+		// Segments are normalized to run left to right, or top to bottom
+		// when vertical.
+		if s.from.x > s.to.x || (s.from.x == s.to.x && s.from.y > s.to.y) {
+			s = &segment{s.to, s.from}
+		}
+
+		var k key
+		if s.from.x == s.to.x {
+			k = key{intercept: s.from.x, vertical: true}
+		} else {
+			k.slope = (s.to.y - s.from.y) / (s.to.x - s.from.x)
+			k.intercept = s.from.y - k.slope*s.from.x
+		}
+
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], s)
+	}
+
+	var merged []*segment
+	for _, k := range keys {
+		group := groups[k]
+
+		position := func(p point) float64 {
+			if k.vertical {
+				return p.y
+			}
+			return p.x
+		}
+
+		sort.SliceStable(group, func(i, j int) bool {
+			return position(group[i].from) < position(group[j].from)
+		})
+
+		current := *group[0]
+		for _, s := range group[1:] {
+			if position(s.from) <= position(current.to) {
+				if position(s.to) > position(current.to) {
+					current.to = s.to
+				}
+				continue
+			}
+			merged = append(merged, &segment{current.from, current.to})
+			current = *s
+		}
+		merged = append(merged, &segment{current.from, current.to})
+	}
+	return merged
+}
+
+// Formats a coordinate without any unnecessary decimals.
+func format(f float64) string {
+	return strconv.FormatFloat(math.Floor(f*100+0.5)/100, 'f', -1, 64)
+}
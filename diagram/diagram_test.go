@@ -0,0 +1,94 @@
+package diagram
+
+import (
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	rendered := Render("+--+\n|  |\n+--+\n")
+	assert.Equal(t, `<svg xmlns="http://www.w3.org/2000/svg" width="32" height="48" viewBox="0 0 32 48">`+
+		`<g fill="none" stroke="currentColor" stroke-width="1.5" stroke-linecap="round" stroke-linejoin="round">`+
+		`<line x1="4" y1="8" x2="28" y2="8"></line>`+
+		`<line x1="4" y1="8" x2="4" y2="40"></line>`+
+		`<line x1="28" y1="8" x2="28" y2="40"></line>`+
+		`<line x1="4" y1="40" x2="28" y2="40"></line>`+
+		`</g></svg>`, rendered)
+}
+
+func TestRenderShapes(t *testing.T) {
+	testCases := []struct {
+		art      string
+		expected []string
+	}{
+		// Rounded corners
+		{".-\n|", []string{`<path d="M8,8 Q4,8 4,16"></path>`, `<line x1="8" y1="8" x2="16" y2="8"></line>`}},
+		{"|\n'-", []string{`<path d="M8,24 Q4,24 4,16"></path>`}},
+
+		// Diagonals, which meet the corners of cells
+		{"+\n \\", []string{`<line x1="4" y1="8" x2="16" y2="32"></line>`}},
+		{" /\n/", []string{`<line x1="0" y1="32" x2="16" y2="0"></line>`}},
+
+		// Arrowheads
+		{"<-", []string{`<polygon points="0,8 8,4 8,12"></polygon>`}},
+		{"^\n|", []string{`<polygon points="4,0 0,8 8,8"></polygon>`, `<line x1="4" y1="8" x2="4" y2="32"></line>`}},
+		{"|\nv", []string{`<polygon points="4,32 0,24 8,24"></polygon>`, `<line x1="4" y1="0" x2="4" y2="24"></line>`}},
+
+		// Dots, with lines stopping at the edge of open ones
+		{"*-", []string{`<circle cx="4" cy="8" r="3"></circle>`, `<line x1="4" y1="8" x2="16" y2="8"></line>`}},
+		{"o-", []string{`<circle cx="4" cy="8" r="3"></circle>`, `<line x1="7" y1="8" x2="16" y2="8"></line>`}},
+	}
+
+	for _, testCase := range testCases {
+		rendered := Render(testCase.art)
+		for _, expected := range testCase.expected {
+			assert.Contains(t, rendered, expected, testCase.art)
+		}
+	}
+}
+
+func TestRenderLabelAgainstBorder(t *testing.T) {
+	// A label that touches a box's edges doesn't take them with it
+	rendered := Render("+--+\n|a |\n| b|\n+--+\n")
+	assert.Contains(t, rendered, `<text x="8" y="28">a</text>`)
+	assert.Contains(t, rendered, `<text x="16" y="44">b</text>`)
+	assert.Contains(t, rendered, `<line x1="4" y1="8" x2="4" y2="56"></line>`)
+	assert.Contains(t, rendered, `<line x1="28" y1="8" x2="28" y2="56"></line>`)
+	assert.NotContains(t, rendered, "|")
+}
+
+func TestRenderText(t *testing.T) {
+	testCases := []struct {
+		art      string
+		expected []string
+	}{
+		// Words separated by single spaces stay together
+		{"Client  Server", []string{`<text x="0" y="12">Client</text>`, `<text x="64" y="12">Server</text>`}},
+
+		// Drawing characters in words and on their own are text
+		{"key-value", []string{`<text x="0" y="12">key-value</text>`}},
+		{"C++ and a+b", []string{`<text x="0" y="12">C++ and a+b</text>`}},
+		{"a - b | c", []string{`<text x="0" y="12">a - b | c</text>`}},
+		{"too vivid v2", []string{`<text x="0" y="12">too vivid v2</text>`}},
+		{"etc... it's <b>", []string{`<text x="0" y="12">etc... it&#39;s &lt;b&gt;</text>`}},
+	}
+
+	for _, testCase := range testCases {
+		rendered := Render(testCase.art)
+		for _, expected := range testCase.expected {
+			assert.Contains(t, rendered, expected, testCase.art)
+		}
+		assert.NotContains(t, rendered, "<line", testCase.art)
+	}
+}
+
+func TestRenderWhitespace(t *testing.T) {
+	// Common indentation and trailing space are removed, and tabs are
+	// expanded
+	assert.Equal(t, Render("--\n      --"), Render("  --\n  \t--\n\n"))
+	assert.Contains(t, Render("--\n\t--"), `width="80"`)
+
+	assert.Equal(t, `<svg xmlns="http://www.w3.org/2000/svg" width="0" height="16" viewBox="0 0 0 16"></svg>`,
+		Render(""))
+}
@@ -0,0 +1,79 @@
+package feeds
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+// AtomNamespace is the XML namespace of Atom 1.0 documents.
+const AtomNamespace = "http://www.w3.org/2005/Atom"
+
+// AtomFeed is the top-level element of an Atom 1.0 document as described by
+// RFC 4287.
+type AtomFeed struct {
+	XMLName xml.Name `xml:"feed"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	XMLLang string   `xml:"xml:lang,attr,omitempty"`
+
+	Author   *AtomAuthor  `xml:"author,omitempty"`
+	Entries  []*AtomEntry `xml:"entry"`
+	ID       string       `xml:"id"`
+	Links    []*AtomLink  `xml:"link"`
+	Subtitle string       `xml:"subtitle,omitempty"`
+	Title    string       `xml:"title"`
+	Updated  time.Time    `xml:"updated"`
+}
+
+// AtomAuthor is the author of a feed or entry.
+type AtomAuthor struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+// AtomContent is the content of an entry. Type is normally "html", in which
+// case the content is escaped HTML.
+type AtomContent struct {
+	Content string `xml:",chardata"`
+	Type    string `xml:"type,attr"`
+}
+
+// AtomEntry is a single item in a feed.
+type AtomEntry struct {
+	Content   *AtomContent `xml:"content"`
+	ID        string       `xml:"id"`
+	Link      *AtomLink    `xml:"link"`
+	Published time.Time    `xml:"published"`
+	Summary   string       `xml:"summary,omitempty"`
+	Title     string       `xml:"title"`
+	Updated   time.Time    `xml:"updated"`
+}
+
+// AtomLink is a link to a resource related to a feed or entry.
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+// Encode writes the feed to the given writer as an XML document.
+func (f *AtomFeed) Encode(w io.Writer, indent string) error {
+	if f.XMLNS == "" {
+		f.XMLNS = AtomNamespace
+	}
+
+	_, err := w.Write([]byte(xml.Header))
+	if err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", indent)
+	err = encoder.Encode(f)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write([]byte("\n"))
+	return err
+}
@@ -0,0 +1,85 @@
+package feeds
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+var testTime = time.Date(2017, 10, 1, 0, 0, 0, 0, time.UTC)
+
+func TestAtomFeedEncode(t *testing.T) {
+	feed := &AtomFeed{
+		Author: &AtomAuthor{Name: "Author"},
+		ID:     "https://example.com/articles.atom",
+		Links: []*AtomLink{
+			{Href: "https://example.com/articles.atom", Rel: "self"},
+		},
+		Title:   "Feed",
+		Updated: testTime,
+		Entries: []*AtomEntry{
+			{
+				Content:   &AtomContent{Content: "<p>Hello.</p>", Type: "html"},
+				ID:        "https://example.com/articles/hello",
+				Link:      &AtomLink{Href: "https://example.com/articles/hello"},
+				Published: testTime,
+				Title:     "Hello",
+				Updated:   testTime,
+			},
+		},
+	}
+
+	var b bytes.Buffer
+	err := feed.Encode(&b, "  ")
+	assert.NoError(t, err)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <author>
+    <name>Author</name>
+  </author>
+  <entry>
+    <content type="html">&lt;p&gt;Hello.&lt;/p&gt;</content>
+    <id>https://example.com/articles/hello</id>
+    <link href="https://example.com/articles/hello"></link>
+    <published>2017-10-01T00:00:00Z</published>
+    <title>Hello</title>
+    <updated>2017-10-01T00:00:00Z</updated>
+  </entry>
+  <id>https://example.com/articles.atom</id>
+  <link href="https://example.com/articles.atom" rel="self"></link>
+  <title>Feed</title>
+  <updated>2017-10-01T00:00:00Z</updated>
+</feed>
+`, b.String())
+}
+
+func TestJSONFeedEncode(t *testing.T) {
+	feed := &JSONFeed{
+		Title: "Feed",
+		Items: []*JSONFeedItem{
+			{
+				ContentHTML:   "<p>Hello.</p>",
+				DatePublished: testTime,
+				ID:            "https://example.com/articles/hello",
+			},
+		},
+	}
+
+	var b bytes.Buffer
+	err := feed.Encode(&b, "  ")
+	assert.NoError(t, err)
+	assert.Equal(t, `{
+  "version": "https://jsonfeed.org/version/1.1",
+  "items": [
+    {
+      "content_html": "<p>Hello.</p>",
+      "date_published": "2017-10-01T00:00:00Z",
+      "id": "https://example.com/articles/hello"
+    }
+  ],
+  "title": "Feed"
+}
+`, b.String())
+}
@@ -0,0 +1,56 @@
+package feeds
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// JSONFeedVersion is the URL identifying the version of the JSON Feed
+// specification that documents conform to.
+const JSONFeedVersion = "https://jsonfeed.org/version/1.1"
+
+// JSONFeed is the top-level object of a JSON Feed 1.1 document as described
+// at https://jsonfeed.org/version/1.1.
+type JSONFeed struct {
+	Version string `json:"version"`
+
+	Authors     []*JSONFeedAuthor `json:"authors,omitempty"`
+	Description string            `json:"description,omitempty"`
+	FeedURL     string            `json:"feed_url,omitempty"`
+	HomePageURL string            `json:"home_page_url,omitempty"`
+	Items       []*JSONFeedItem   `json:"items"`
+	Language    string            `json:"language,omitempty"`
+	Title       string            `json:"title"`
+}
+
+// JSONFeedAuthor is the author of a feed or item.
+type JSONFeedAuthor struct {
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
+
+// JSONFeedItem is a single item in a feed.
+type JSONFeedItem struct {
+	ContentHTML   string     `json:"content_html"`
+	DateModified  *time.Time `json:"date_modified,omitempty"`
+	DatePublished time.Time  `json:"date_published"`
+	ID            string     `json:"id"`
+	Summary       string     `json:"summary,omitempty"`
+	Title         string     `json:"title,omitempty"`
+	URL           string     `json:"url,omitempty"`
+}
+
+// Encode writes the feed to the given writer as a JSON document.
+func (f *JSONFeed) Encode(w io.Writer, indent string) error {
+	if f.Version == "" {
+		f.Version = JSONFeedVersion
+	}
+
+	// Content is HTML, so leave its angle brackets unescaped to keep the
+	// document readable.
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", indent)
+	return encoder.Encode(f)
+}
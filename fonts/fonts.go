@@ -0,0 +1,303 @@
+package fonts
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigFile is the name of the file in each family's directory that
+// describes its fonts.
+const ConfigFile = "font.yaml"
+
+// Config describes a font family. It's read from ConfigFile in the family's
+// directory:
+//
+//	family: Cardo
+//	local:
+//	  regular: [Cardo, Cardo-Regular]
+//	preload: [latin]
+//	subsets:
+//	  latin: U+0000-00FF, U+0131, U+0152-0153
+//	  greek: U+0370-03FF
+type Config struct {
+	// Family is the name that stylesheets use for the font in font-family.
+	// Required.
+	Family string `yaml:"family"`
+
+	// Local maps variants like "regular" or "700italic" to the names that
+	// the font may already be installed under on a reader's system, which
+	// are tried before it's downloaded.
+	Local map[string][]string `yaml:"local"`
+
+	// Preload lists the subsets that pages should start downloading right
+	// away, which are usually the ones that nearly all text is in.
+	Preload []string `yaml:"preload"`
+
+	// Subsets maps the names of the family's subsets to the range of
+	// Unicode characters that each covers, in the syntax of unicode-range.
+	Subsets map[string]string `yaml:"subsets"`
+
+	// Weight is the weight of font files that don't name one. Defaults to
+	// 400.
+	Weight int `yaml:"weight"`
+}
+
+// Face is a single font file, which is a subset of a family at one weight
+// and style.
+type Face struct {
+	// Family is the name of the font's family.
+	Family string
+
+	// Local is the names that the font may already be installed under.
+	Local []string
+
+	// Path is the font's file.
+	Path string
+
+	// Preload is whether pages should start downloading the font right away.
+	Preload bool
+
+	// Style is the font's style, either "normal" or "italic".
+	Style string
+
+	// Subset is the name of the subset that the font contains.
+	Subset string
+
+	// UnicodeRange is the range of characters in the subset.
+	UnicodeRange string
+
+	// URL is where the font is served.
+	URL string
+
+	// Weight is the font's weight, like 400 for regular or 700 for bold.
+	Weight int
+}
+
+// GoogleFontsURL gets the URL of a stylesheet from Google Fonts that loads
+// every family and variant among the fonts from Google's CDN, for when they
+// aren't being served locally.
+func GoogleFontsURL(faces []*Face) string {
+	var families []string
+	variants := make(map[string][]string)
+
+	for _, face := range faces {
+		variant := strconv.Itoa(face.Weight)
+		if face.Style == "italic" {
+			variant += "italic"
+		}
+
+		if _, ok := variants[face.Family]; !ok {
+			families = append(families, face.Family)
+		}
+		if !containsString(variants[face.Family], variant) {
+			variants[face.Family] = append(variants[face.Family], variant)
+		}
+	}
+
+	if len(families) == 0 {
+		return ""
+	}
+
+	specs := make([]string, len(families))
+	for i, family := range families {
+		specs[i] = strings.Replace(family, " ", "+", -1) + ":" + strings.Join(variants[family], ",")
+	}
+
+	return "https://fonts.googleapis.com/css?family=" + strings.Join(specs, "|")
+}
+
+// Load finds the fonts in dir, which has a directory for each family
+// containing WOFF2 files and a ConfigFile. Fonts are served from a directory
+// of the same name under urlPrefix.
+//
+// Font files are named after their subset, like "latin.woff2", with a variant
+// like "latin.italic.woff2" or "latin.700italic.woff2" for other weights and
+// styles. A font in a subset that isn't in its family's config is an error.
+func Load(dir, urlPrefix string) ([]*Face, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var faces []*Face
+	for _, info := range infos {
+		if !info.IsDir() || isHidden(info.Name()) {
+			continue
+		}
+
+		familyFaces, err := loadFamily(filepath.Join(dir, info.Name()),
+			path.Join(urlPrefix, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		faces = append(faces, familyFaces...)
+	}
+
+	return faces, nil
+}
+
+// Preloads gets the URLs of the fonts that pages should start downloading
+// right away.
+func Preloads(faces []*Face) []string {
+	var urls []string
+	for _, face := range faces {
+		if face.Preload {
+			urls = append(urls, face.URL)
+		}
+	}
+	return urls
+}
+
+// Stylesheet generates an @font-face rule for each font.
+func Stylesheet(faces []*Face) string {
+	var b bytes.Buffer
+	for _, face := range faces {
+		var sources []string
+		for _, name := range face.Local {
+			sources = append(sources, fmt.Sprintf("local('%s')", name))
+		}
+		sources = append(sources, fmt.Sprintf("url(%s) format('woff2')", face.URL))
+
+		fmt.Fprintf(&b, "/* %s %s */\n", strings.ToLower(face.Family), face.Subset)
+		fmt.Fprintf(&b, "@font-face {\n")
+		fmt.Fprintf(&b, "  font-family: '%s';\n", face.Family)
+		fmt.Fprintf(&b, "  font-style: %s;\n", face.Style)
+		fmt.Fprintf(&b, "  font-weight: %d;\n", face.Weight)
+		fmt.Fprintf(&b, "  src: %s;\n", strings.Join(sources, ", "))
+		fmt.Fprintf(&b, "  unicode-range: %s;\n", face.UnicodeRange)
+		fmt.Fprintf(&b, "}\n")
+	}
+	return b.String()
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Detects a hidden file, i.e. one that starts with a dot.
+func isHidden(file string) bool {
+	return strings.HasPrefix(file, ".")
+}
+
+// Loads the fonts of a single family. Fonts are sorted by weight, style, and
+// subset so that the generated stylesheet is stable between builds.
+func loadFamily(dir, urlPrefix string) ([]*Face, error) {
+	configPath := filepath.Join(dir, ConfigFile)
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	err = yaml.UnmarshalStrict(data, &config)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %v: %v", configPath, err)
+	}
+
+	if config.Family == "" {
+		return nil, fmt.Errorf("%v is missing required key \"family\"", configPath)
+	}
+
+	if config.Weight == 0 {
+		config.Weight = 400
+	}
+
+	preload := make(map[string]bool)
+	for _, subset := range config.Preload {
+		if _, ok := config.Subsets[subset]; !ok {
+			return nil, fmt.Errorf("%v preloads unknown subset %q", configPath, subset)
+		}
+		preload[subset] = true
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.woff2"))
+	if err != nil {
+		return nil, err
+	}
+
+	var faces []*Face
+	for _, fontPath := range paths {
+		name := filepath.Base(fontPath)
+		parts := strings.SplitN(strings.TrimSuffix(name, ".woff2"), ".", 2)
+
+		subset := parts[0]
+		unicodeRange, ok := config.Subsets[subset]
+		if !ok {
+			return nil, fmt.Errorf("Font %v is in subset %q, which isn't in %v",
+				fontPath, subset, configPath)
+		}
+
+		variant := "regular"
+		if len(parts) == 2 {
+			variant = parts[1]
+		}
+
+		weight, style, err := parseVariant(variant, config.Weight)
+		if err != nil {
+			return nil, fmt.Errorf("Font %v: %v", fontPath, err)
+		}
+
+		faces = append(faces, &Face{
+			Family:       config.Family,
+			Local:        config.Local[variant],
+			Path:         fontPath,
+			Preload:      preload[subset],
+			Style:        style,
+			Subset:       subset,
+			UnicodeRange: unicodeRange,
+			URL:          path.Join(urlPrefix, name),
+			Weight:       weight,
+		})
+	}
+
+	sort.Slice(faces, func(i, j int) bool {
+		if faces[i].Weight != faces[j].Weight {
+			return faces[i].Weight < faces[j].Weight
+		}
+		if faces[i].Style != faces[j].Style {
+			return faces[i].Style > faces[j].Style
+		}
+		return faces[i].Subset < faces[j].Subset
+	})
+
+	return faces, nil
+}
+
+// Parses a variant in the style of Google Fonts, like "regular", "italic",
+// "700", or "700italic", into a weight and style.
+func parseVariant(variant string, defaultWeight int) (int, string, error) {
+	switch variant {
+	case "regular":
+		return defaultWeight, "normal", nil
+	case "italic":
+		return defaultWeight, "italic", nil
+	}
+
+	style := "normal"
+	number := variant
+	if strings.HasSuffix(variant, "italic") {
+		style = "italic"
+		number = strings.TrimSuffix(variant, "italic")
+	}
+
+	weight, err := strconv.Atoi(number)
+	if err != nil || weight < 1 || weight > 1000 {
+		return 0, "", fmt.Errorf("Unknown variant %q (expected one like \"regular\", \"italic\", \"700\", or \"700italic\")",
+			variant)
+	}
+
+	return weight, style, nil
+}
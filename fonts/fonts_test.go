@@ -0,0 +1,130 @@
+package fonts
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestGoogleFontsURL(t *testing.T) {
+	assert.Equal(t, "https://fonts.googleapis.com/css?family=Cardo:400,700italic|Open+Sans:400",
+		GoogleFontsURL([]*Face{
+			{Family: "Cardo", Style: "normal", Subset: "greek", Weight: 400},
+			{Family: "Cardo", Style: "normal", Subset: "latin", Weight: 400},
+			{Family: "Cardo", Style: "italic", Subset: "latin", Weight: 700},
+			{Family: "Open Sans", Style: "normal", Subset: "latin", Weight: 400},
+		}))
+
+	assert.Equal(t, "", GoogleFontsURL(nil))
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeFamily(t, `
+family: Cardo
+local:
+  regular: [Cardo, Cardo-Regular]
+preload: [latin]
+subsets:
+  greek: U+0370-03FF
+  latin: U+0000-00FF
+`, "latin.700italic.woff2", "latin.woff2", "greek.woff2", "latin.italic.woff2")
+	defer os.RemoveAll(dir)
+
+	faces, err := Load(dir, "/assets/fonts")
+	assert.NoError(t, err)
+
+	familyDir := filepath.Join(dir, "cardo")
+	assert.Equal(t, []*Face{
+		{Family: "Cardo", Local: []string{"Cardo", "Cardo-Regular"}, Style: "normal",
+			Subset: "greek", UnicodeRange: "U+0370-03FF", URL: "/assets/fonts/cardo/greek.woff2",
+			Path: filepath.Join(familyDir, "greek.woff2"), Weight: 400},
+		{Family: "Cardo", Local: []string{"Cardo", "Cardo-Regular"}, Preload: true, Style: "normal",
+			Subset: "latin", UnicodeRange: "U+0000-00FF", URL: "/assets/fonts/cardo/latin.woff2",
+			Path: filepath.Join(familyDir, "latin.woff2"), Weight: 400},
+		{Family: "Cardo", Preload: true, Style: "italic",
+			Subset: "latin", UnicodeRange: "U+0000-00FF", URL: "/assets/fonts/cardo/latin.italic.woff2",
+			Path: filepath.Join(familyDir, "latin.italic.woff2"), Weight: 400},
+		{Family: "Cardo", Preload: true, Style: "italic",
+			Subset: "latin", UnicodeRange: "U+0000-00FF", URL: "/assets/fonts/cardo/latin.700italic.woff2",
+			Path: filepath.Join(familyDir, "latin.700italic.woff2"), Weight: 700},
+	}, faces)
+
+	assert.Equal(t, []string{
+		"/assets/fonts/cardo/latin.woff2",
+		"/assets/fonts/cardo/latin.italic.woff2",
+		"/assets/fonts/cardo/latin.700italic.woff2",
+	}, Preloads(faces))
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := writeFamily(t, "subsets: {latin: U+0000-00FF}", "latin.woff2")
+	defer os.RemoveAll(dir)
+	_, err := Load(dir, "/assets/fonts")
+	assert.Equal(t, filepath.Join(dir, "cardo", ConfigFile)+` is missing required key "family"`, err.Error())
+
+	dir = writeFamily(t, "family: Cardo\nsubsets: {latin: U+0000-00FF}", "greek.woff2")
+	defer os.RemoveAll(dir)
+	_, err = Load(dir, "/assets/fonts")
+	assert.Equal(t, "Font "+filepath.Join(dir, "cardo", "greek.woff2")+
+		` is in subset "greek", which isn't in `+filepath.Join(dir, "cardo", ConfigFile), err.Error())
+
+	dir = writeFamily(t, "family: Cardo\nsubsets: {latin: U+0000-00FF}", "latin.bold.woff2")
+	defer os.RemoveAll(dir)
+	_, err = Load(dir, "/assets/fonts")
+	assert.Equal(t, "Font "+filepath.Join(dir, "cardo", "latin.bold.woff2")+
+		`: Unknown variant "bold" (expected one like "regular", "italic", "700", or "700italic")`, err.Error())
+
+	dir = writeFamily(t, "family: Cardo\npreload: [greek]\nsubsets: {latin: U+0000-00FF}", "latin.woff2")
+	defer os.RemoveAll(dir)
+	_, err = Load(dir, "/assets/fonts")
+	assert.Equal(t, filepath.Join(dir, "cardo", ConfigFile)+` preloads unknown subset "greek"`, err.Error())
+}
+
+func TestStylesheet(t *testing.T) {
+	assert.Equal(t, `/* cardo latin */
+@font-face {
+  font-family: 'Cardo';
+  font-style: normal;
+  font-weight: 400;
+  src: local('Cardo'), local('Cardo-Regular'), url(/assets/fonts/cardo/latin.woff2) format('woff2');
+  unicode-range: U+0000-00FF;
+}
+/* cardo latin */
+@font-face {
+  font-family: 'Cardo';
+  font-style: italic;
+  font-weight: 700;
+  src: url(/assets/fonts/cardo/latin.700italic.woff2) format('woff2');
+  unicode-range: U+0000-00FF;
+}
+`, Stylesheet([]*Face{
+		{Family: "Cardo", Local: []string{"Cardo", "Cardo-Regular"}, Style: "normal",
+			Subset: "latin", UnicodeRange: "U+0000-00FF", URL: "/assets/fonts/cardo/latin.woff2", Weight: 400},
+		{Family: "Cardo", Style: "italic",
+			Subset: "latin", UnicodeRange: "U+0000-00FF", URL: "/assets/fonts/cardo/latin.700italic.woff2", Weight: 700},
+	}))
+}
+
+//
+// Helpers
+//
+
+// Writes a family named "cardo" with the given config and (empty) font files
+// to a temporary directory, which is returned.
+func writeFamily(t *testing.T, config string, files ...string) string {
+	dir, err := ioutil.TempDir("", "fonts")
+	assert.NoError(t, err)
+
+	familyDir := filepath.Join(dir, "cardo")
+	assert.NoError(t, os.Mkdir(familyDir, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(familyDir, ConfigFile), []byte(config), 0644))
+
+	for _, file := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(familyDir, file), nil, 0644))
+	}
+
+	return dir
+}
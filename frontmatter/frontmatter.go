@@ -0,0 +1,260 @@
+package frontmatter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Delimiters that open and close a front matter section. The choice of
+// delimiter determines the format that the front matter is decoded as.
+const (
+	tomlDelimiter = "+++"
+	yamlDelimiter = "---"
+)
+
+// Error is a problem encountered while decoding front matter. It carries the
+// name of the file and the line within it so that the problem is easy to
+// track down.
+type Error struct {
+	// File is the name of the file containing the front matter.
+	File string
+
+	// Line is the line number (starting at 1) within the file where the
+	// problem was found.
+	Line int
+
+	// Message describes the problem.
+	Message string
+}
+
+// Error returns the error in a "file:line: message" format that most editors
+// know how to jump to.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v:%v: %v", e.File, e.Line, e.Message)
+}
+
+// Decode splits front matter from the top of the given source and decodes it
+// into v. YAML front matter is delimited by "---" lines and TOML front matter
+// by "+++" lines.
+//
+// The returned content is the source that remains after the front matter.
+// The returned integer is the line of the file on which that content starts,
+// which is useful for reporting errors found in the content later on.
+//
+// Keys that don't have a corresponding field in v are considered an error so
+// that typos are caught early. Any error returned is an *Error.
+func Decode(file, source string, v interface{}) (string, int, error) {
+	lines, delimiter, end, err := split(file, source)
+	if err != nil {
+		return "", 0, err
+	}
+
+	data := strings.Join(lines[1:end], "")
+	content := strings.Join(lines[end+1:], "")
+
+	// Lines reported by the decoders are relative to the start of the front
+	// matter, which is the line after the opening delimiter.
+	if delimiter == tomlDelimiter {
+		err = decodeTOML(data, v)
+	} else {
+		err = decodeYAML(data, v)
+	}
+	if err != nil {
+		line, message := extractLine(err.Error())
+		return "", 0, &Error{file, line + 1, "Invalid front matter: " + message}
+	}
+
+	return content, end + 2, nil
+}
+
+// KeyLine finds the line of the file on which a top-level key is set in the
+// front matter at the top of source. If the key isn't set, the line is that
+// of the delimiter closing the front matter, which is where it would be
+// added. If source doesn't start with front matter, the line is 1.
+func KeyLine(source, key string) int {
+	lines, delimiter, end, err := split("", source)
+	if err != nil {
+		return 1
+	}
+
+	var line int
+	if delimiter == tomlDelimiter {
+		line = findTOMLKey(lines[1:end], []string{key})
+	} else {
+		line = findYAMLKey(lines[1:end], key)
+	}
+	if line == 0 {
+		return end + 1
+	}
+
+	// Lines are relative to the start of the front matter.
+	return line + 1
+}
+
+// Splits source into lines and finds the delimiter of the front matter at its
+// top along with the index of the line that closes it.
+func split(file, source string) ([]string, string, int, error) {
+	lines := strings.SplitAfter(source, "\n")
+
+	delimiter := strings.TrimSpace(lines[0])
+	if delimiter != tomlDelimiter && delimiter != yamlDelimiter {
+		return nil, "", 0, &Error{file, 1,
+			fmt.Sprintf("Expected front matter starting with '%v' or '%v'",
+				yamlDelimiter, tomlDelimiter)}
+	}
+
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == delimiter {
+			return lines, delimiter, i, nil
+		}
+	}
+
+	return nil, "", 0, &Error{file, 1,
+		fmt.Sprintf("Front matter opened with '%v' is never closed", delimiter)}
+}
+
+// Matches the line number that both TOML and YAML include in their errors,
+// along with any prefix that comes before it.
+var lineRE = regexp.MustCompile(`^(?:toml: |yaml: )?(?:unmarshal errors:\s+)?(?i:near )?line (\d+)(?: \(last key parsed '.*?'\))?: `)
+
+// Pulls a line number out of an error message produced by one of the
+// decoders. If no line number is present, the line is 0 (which is the line of
+// the opening delimiter once offset).
+func extractLine(message string) (int, string) {
+	matches := lineRE.FindStringSubmatch(message)
+	if matches == nil {
+		return 0, message
+	}
+
+	line, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return 0, message
+	}
+
+	return line, message[len(matches[0]):]
+}
+
+func decodeTOML(data string, v interface{}) error {
+	meta, err := toml.Decode(data, v)
+	if err != nil {
+		return err
+	}
+
+	undecoded := meta.Undecoded()
+	if len(undecoded) > 0 {
+		// The line is reported in the same way as the decoder's own errors.
+		key := undecoded[0]
+		line := findTOMLKey(strings.SplitAfter(data, "\n"), key)
+		if line == 0 {
+			return fmt.Errorf("Unknown key '%v'", key.String())
+		}
+		return fmt.Errorf("line %v: Unknown key '%v'", line, key.String())
+	}
+
+	return nil
+}
+
+// Matches a TOML table header like "[table]" or "[[array.of.tables]]",
+// capturing its key.
+var tomlTableRE = regexp.MustCompile(`^\s*\[\[?\s*([^\[\]]+?)\s*\]\]?\s*(?:#.*)?$`)
+
+// Matches the start of a TOML key/value pair, capturing its key.
+var tomlKeyRE = regexp.MustCompile(`^\s*([\w\-."' ]+?)\s*=`)
+
+// Finds the line (starting at 1) within TOML on which a key is set, taking
+// into account the table that each key is in. A key set within an inline
+// table is found at the line of the table's key. Returns 0 if the key can't
+// be found.
+func findTOMLKey(lines []string, key []string) int {
+	for n := len(key); n > 0; n-- {
+		var table []string
+		for i, line := range lines {
+			if matches := tomlTableRE.FindStringSubmatch(line); matches != nil {
+				table = splitTOMLKey(matches[1])
+				if equalKeys(table, key[:n]) {
+					return i + 1
+				}
+				continue
+			}
+
+			if matches := tomlKeyRE.FindStringSubmatch(line); matches != nil {
+				full := append(append([]string(nil), table...), splitTOMLKey(matches[1])...)
+				if equalKeys(full, key[:n]) {
+					return i + 1
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// Matches the start of a top-level YAML mapping key, capturing the key.
+var yamlKeyRE = regexp.MustCompile(`^(?:"([^"]*)"|'([^']*)'|([^\s#"'][^:]*?))\s*:(?:\s|$)`)
+
+// Finds the line (starting at 1) within YAML on which a top-level key is set,
+// or 0 if it isn't.
+func findYAMLKey(lines []string, key string) int {
+	for i, line := range lines {
+		matches := yamlKeyRE.FindStringSubmatch(line)
+		if matches != nil && matches[1]+matches[2]+matches[3] == key {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func equalKeys(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Splits a dotted TOML key like `a."b.c"` into its parts.
+func splitTOMLKey(s string) []string {
+	var parts []string
+	var part []byte
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			part = append(part, c)
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '.':
+			parts = append(parts, strings.TrimSpace(string(part)))
+			part = nil
+		default:
+			part = append(part, c)
+		}
+	}
+	return append(parts, strings.TrimSpace(string(part)))
+}
+
+func decodeYAML(data string, v interface{}) error {
+	err := yaml.UnmarshalStrict([]byte(data), v)
+	if err != nil {
+		// Type errors may contain a number of problems on separate lines, but
+		// reporting the first is enough to point an author in the right
+		// direction.
+		if typeErr, ok := err.(*yaml.TypeError); ok {
+			return fmt.Errorf("%v", typeErr.Errors[0])
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package frontmatter
+
+import (
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+type testMeta struct {
+	PublishedAt time.Time `toml:"published_at" yaml:"published_at"`
+	Title       string    `toml:"title" yaml:"title"`
+}
+
+func TestDecodeTOML(t *testing.T) {
+	var meta testMeta
+	content, line, err := Decode("test.md", `+++
+title = "Hello"
+published_at = 2017-09-25T00:00:00Z
++++
+
+Content.
+`, &meta)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello", meta.Title)
+	assert.Equal(t, time.Date(2017, 9, 25, 0, 0, 0, 0, time.UTC), meta.PublishedAt)
+	assert.Equal(t, "\nContent.\n", content)
+	assert.Equal(t, 5, line)
+}
+
+func TestDecodeYAML(t *testing.T) {
+	var meta testMeta
+	content, line, err := Decode("test.md", `---
+title: Hello
+published_at: 2017-09-25T00:00:00Z
+---
+
+Content.
+`, &meta)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello", meta.Title)
+	assert.Equal(t, time.Date(2017, 9, 25, 0, 0, 0, 0, time.UTC), meta.PublishedAt)
+	assert.Equal(t, "\nContent.\n", content)
+	assert.Equal(t, 5, line)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var meta testMeta
+	var err error
+
+	_, _, err = Decode("test.md", "Content.\n", &meta)
+	assert.Equal(t, "test.md:1: Expected front matter starting with '---' or '+++'",
+		err.Error())
+
+	_, _, err = Decode("test.md", "---\ntitle: Hello\n", &meta)
+	assert.Equal(t, "test.md:1: Front matter opened with '---' is never closed",
+		err.Error())
+
+	// Malformed YAML
+	_, _, err = Decode("test.md", "---\ntitle: Hello\npublished_at: [\n---\n", &meta)
+	assert.IsType(t, &Error{}, err)
+	assert.Equal(t, 3, err.(*Error).Line)
+
+	// Wrong type in YAML
+	_, _, err = Decode("test.md", "---\ntitle: 123\npublished_at: [1, 2]\n---\n", &meta)
+	assert.Equal(t, 3, err.(*Error).Line)
+	assert.Contains(t, err.Error(), "cannot unmarshal")
+
+	// Unknown key in YAML
+	_, _, err = Decode("test.md", "---\ntitle: Hello\nsubtitel: Typo\n---\n", &meta)
+	assert.Equal(t, 3, err.(*Error).Line)
+	assert.Contains(t, err.Error(), "subtitel")
+
+	// Malformed TOML
+	_, _, err = Decode("test.md", "+++\ntitle = \"Hello\"\npublished_at = \n+++\n", &meta)
+	assert.Equal(t, 3, err.(*Error).Line)
+
+	// Unknown key in TOML
+	_, _, err = Decode("test.md", "+++\ntitle = \"Hello\"\nsubtitel = \"Typo\"\n+++\n", &meta)
+	assert.Equal(t, "test.md:3: Invalid front matter: Unknown key 'subtitel'",
+		err.Error())
+
+	// Unknown tables in TOML are found at their header or key
+	_, _, err = Decode("test.md", "+++\ntitle = \"Hello\"\n\n[extra]\ntitle = \"Again\"\n+++\n", &meta)
+	assert.Equal(t, "test.md:4: Invalid front matter: Unknown key 'extra'", err.Error())
+
+	_, _, err = Decode("test.md", "+++\ntitle = \"Hello\"\nextra = { title = \"Again\" }\n+++\n", &meta)
+	assert.Equal(t, "test.md:3: Invalid front matter: Unknown key 'extra.title'", err.Error())
+}
+
+func TestKeyLine(t *testing.T) {
+	toml := "+++\ntitle = \"Hello\"\n\n[table]\npublished_at = 1\n+++\n\nContent.\n"
+	assert.Equal(t, 2, KeyLine(toml, "title"))
+
+	// Keys in tables aren't top-level, so a missing key is placed at the
+	// closing delimiter
+	assert.Equal(t, 6, KeyLine(toml, "published_at"))
+
+	yaml := "---\ntitle: Hello\nanchor_aliases:\n  published_at: x\n\"published_at\": 2017-10-01\n---\n"
+	assert.Equal(t, 2, KeyLine(yaml, "title"))
+	assert.Equal(t, 5, KeyLine(yaml, "published_at"))
+	assert.Equal(t, 6, KeyLine(yaml, "subtitle"))
+
+	assert.Equal(t, 1, KeyLine("Content.\n", "title"))
+}
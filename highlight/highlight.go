@@ -0,0 +1,273 @@
+package highlight
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Token classes. These are short like the ones used by Pygments so that they
+// don't add too much weight to highlighted markup.
+const (
+	ClassBuiltin         = "nb"
+	ClassClass           = "nc"
+	ClassComment         = "c"
+	ClassConstant        = "kc"
+	ClassDiffDeleted     = "gd"
+	ClassDiffHeader      = "gh"
+	ClassDiffHunk        = "gu"
+	ClassDiffInserted    = "gi"
+	ClassKey             = "na"
+	ClassKeyword         = "k"
+	ClassNumber          = "m"
+	ClassRegex           = "sr"
+	ClassString          = "s"
+	ClassSymbol          = "ss"
+	ClassType            = "kt"
+	ClassVariable        = "nv"
+	ClassPlain           = ""
+	classIdentifier      = "@identifier"
+	classIdentifierUpper = "@identifier-upper"
+)
+
+// Token is a run of source text that has been assigned a class.
+type Token struct {
+	// Class is the token's class, or empty for plain text.
+	Class string
+
+	// Text is the token's source text.
+	Text string
+}
+
+// Render produces HTML for the given tokens with each one that has a class
+// wrapped in a span.
+func Render(tokens []Token) string {
+	var b bytes.Buffer
+	for _, token := range tokens {
+		if token.Class == ClassPlain {
+			b.WriteString(html.EscapeString(token.Text))
+			continue
+		}
+
+		b.WriteString(`<span class="`)
+		b.WriteString(token.Class)
+		b.WriteString(`">`)
+		b.WriteString(html.EscapeString(token.Text))
+		b.WriteString(`</span>`)
+	}
+	return b.String()
+}
+
+// SplitLines breaks tokens into lines so that each line can be rendered on
+// its own. Tokens that span multiple lines (like block comments) are split
+// with each piece keeping the original token's class. Newlines aren't
+// included in the output.
+func SplitLines(tokens []Token) [][]Token {
+	lines := [][]Token{nil}
+	for _, token := range tokens {
+		for i, text := range strings.Split(token.Text, "\n") {
+			if i > 0 {
+				lines = append(lines, nil)
+			}
+			if text != "" {
+				lines[len(lines)-1] = append(lines[len(lines)-1], Token{token.Class, text})
+			}
+		}
+	}
+	return lines
+}
+
+// Tokenize breaks source code in the given language into tokens. Returns false
+// if the language isn't supported.
+func Tokenize(language, code string) ([]Token, bool) {
+	lexer, ok := lexers[strings.ToLower(language)]
+	if !ok {
+		return nil, false
+	}
+	return lexer.tokenize(code), true
+}
+
+//
+// Lexer
+//
+
+// lexer breaks source code into tokens by trying a list of rules in order at
+// each position in the source. The first rule to match wins. Characters that
+// no rule matches are emitted as plain text.
+type lexer struct {
+	// ignoreCase makes keyword lookups case insensitive.
+	ignoreCase bool
+
+	// keywords maps identifiers to the class they should be given. Only used
+	// by rules with an identifier class.
+	keywords map[string]string
+
+	rules []*rule
+}
+
+// rule is a single pattern in a lexer.
+type rule struct {
+	// class is the class given to the whole match. It's ignored if groups is
+	// set.
+	class string
+
+	// classify optionally decides the class of a match based on the source
+	// that follows it.
+	classify func(match, rest string) string
+
+	// groups assigns a class to each of the pattern's capture groups instead
+	// of one class to the whole match. Groups must cover the entire match.
+	groups []string
+
+	// lineStart only allows the rule to match at the start of a line.
+	lineStart bool
+
+	// pattern is the rule's regex. It must be anchored with \A.
+	pattern *regexp.Regexp
+
+	// valueStart only allows the rule to match in a position where a value
+	// can start. This is used to distinguish regex literals from division.
+	valueStart bool
+
+	// wordStart only allows the rule to match at the start of the source or
+	// after whitespace.
+	wordStart bool
+}
+
+func (l *lexer) tokenize(code string) []Token {
+	var tokens []Token
+
+	// The last token that wasn't whitespace or a comment.
+	var prev Token
+
+	emit := func(class, text string) {
+		if text == "" {
+			return
+		}
+
+		if class == classIdentifier || class == classIdentifierUpper {
+			key := text
+			if l.ignoreCase {
+				key = strings.ToLower(key)
+			}
+
+			if keywordClass, ok := l.keywords[key]; ok {
+				class = keywordClass
+			} else if class == classIdentifierUpper && text[0] >= 'A' && text[0] <= 'Z' {
+				class = ClassClass
+			} else {
+				class = ClassPlain
+			}
+		}
+
+		if strings.TrimSpace(text) != "" && class != ClassComment {
+			prev = Token{class, text}
+		}
+
+		// Merge with the previous token where possible to keep output small.
+		if len(tokens) > 0 && tokens[len(tokens)-1].Class == class {
+			tokens[len(tokens)-1].Text += text
+			return
+		}
+
+		tokens = append(tokens, Token{class, text})
+	}
+
+	for pos := 0; pos < len(code); {
+		rest := code[pos:]
+		matched := false
+
+		for _, r := range l.rules {
+			if r.lineStart && pos > 0 && code[pos-1] != '\n' {
+				continue
+			}
+
+			if r.wordStart && pos > 0 && !isSpace(code[pos-1]) {
+				continue
+			}
+
+			if r.valueStart && !canStartValue(prev) {
+				continue
+			}
+
+			loc := r.pattern.FindStringSubmatchIndex(rest)
+			if loc == nil || loc[1] == 0 {
+				continue
+			}
+
+			switch {
+			case r.groups != nil:
+				for i, class := range r.groups {
+					start, end := loc[2*(i+1)], loc[2*(i+1)+1]
+					if start >= 0 {
+						emit(class, rest[start:end])
+					}
+				}
+
+			case r.classify != nil:
+				emit(r.classify(rest[:loc[1]], rest[loc[1]:]), rest[:loc[1]])
+
+			default:
+				emit(r.class, rest[:loc[1]])
+			}
+
+			pos += loc[1]
+			matched = true
+			break
+		}
+
+		if !matched {
+			_, size := utf8.DecodeRuneInString(rest)
+			emit(ClassPlain, rest[:size])
+			pos += size
+		}
+	}
+
+	return tokens
+}
+
+// Decides whether a value could start after the given token. For example, a
+// slash following an identifier is division, but a slash following an
+// operator or keyword starts a regex.
+func canStartValue(prev Token) bool {
+	if prev.Text == "" {
+		return true
+	}
+
+	switch prev.Class {
+	case ClassNumber, ClassString, ClassRegex, ClassConstant, ClassBuiltin:
+		return false
+	case ClassKeyword:
+		return true
+	}
+
+	last := prev.Text[len(prev.Text)-1]
+	return !(isWordChar(last) || last == ')' || last == ']' || last == '}')
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '$' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// Builds a keyword map where all the given words map to a single class.
+func words(class string, list string, keywords map[string]string) map[string]string {
+	if keywords == nil {
+		keywords = make(map[string]string)
+	}
+	for _, word := range strings.Fields(list) {
+		keywords[word] = class
+	}
+	return keywords
+}
+
+// Shorthand for compiling a rule's pattern with the required anchor.
+func re(pattern string) *regexp.Regexp {
+	return regexp.MustCompile(`\A(?:` + pattern + `)`)
+}
@@ -0,0 +1,200 @@
+package highlight
+
+import (
+	"strings"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	tokens, ok := Tokenize("go", `fmt.Println("<hello>")`)
+	assert.True(t, ok)
+	assert.Equal(t, `fmt.Println(<span class="s">&#34;&lt;hello&gt;&#34;</span>)`, Render(tokens))
+}
+
+func TestSplitLines(t *testing.T) {
+	assert.Equal(t, [][]Token{
+		{{ClassKeyword, "x"}, {ClassComment, "/* a"}},
+		{{ClassComment, "b */"}},
+		nil,
+		{{ClassPlain, "y"}},
+	}, SplitLines([]Token{
+		{ClassKeyword, "x"},
+		{ClassComment, "/* a\nb */"},
+		{ClassPlain, "\n\ny"},
+	}))
+}
+
+func TestStylesheet(t *testing.T) {
+	stylesheet := Stylesheet()
+	assert.Contains(t, stylesheet, ".highlight .k { color: #8959a8; }\n")
+
+	// Every class has a rule.
+	assert.Equal(t, len(theme), strings.Count(stylesheet, "\n"))
+}
+
+func TestTokenizeLanguages(t *testing.T) {
+	// Languages are found by name or alias regardless of case
+	for _, language := range []string{"go", "Ruby", "sh"} {
+		_, ok := Tokenize(language, "x")
+		assert.True(t, ok, language)
+	}
+
+	_, ok := Tokenize("cobol", `DISPLAY "HELLO".`)
+	assert.False(t, ok)
+}
+
+func TestTokenizeDiff(t *testing.T) {
+	assertTokens(t, "diff", "--- a/f\n+++ b/f\n@@ -1 +1 @@\n-old\n+new\n same\n", []Token{
+		{ClassDiffHeader, "--- a/f"},
+		{ClassPlain, "\n"},
+		{ClassDiffHeader, "+++ b/f"},
+		{ClassPlain, "\n"},
+		{ClassDiffHunk, "@@ -1 +1 @@"},
+		{ClassPlain, "\n"},
+		{ClassDiffDeleted, "-old"},
+		{ClassPlain, "\n"},
+		{ClassDiffInserted, "+new"},
+		{ClassPlain, "\n same\n"},
+	})
+}
+
+func TestTokenizeGo(t *testing.T) {
+	assertTokens(t, "go", "func main() {\n\t// hi\n\tx := []int{1, 0x2}\n\treturn nil\n}", []Token{
+		{ClassKeyword, "func"},
+		{ClassPlain, " main() {\n\t"},
+		{ClassComment, "// hi"},
+		{ClassPlain, "\n\tx := []"},
+		{ClassType, "int"},
+		{ClassPlain, "{"},
+		{ClassNumber, "1"},
+		{ClassPlain, ", "},
+		{ClassNumber, "0x2"},
+		{ClassPlain, "}\n\t"},
+		{ClassKeyword, "return"},
+		{ClassPlain, " "},
+		{ClassConstant, "nil"},
+		{ClassPlain, "\n}"},
+	})
+
+	// Raw strings span lines
+	assertTokens(t, "go", "s := `a\nb`", []Token{
+		{ClassPlain, "s := "},
+		{ClassString, "`a\nb`"},
+	})
+}
+
+func TestTokenizeJavaScript(t *testing.T) {
+	assertTokens(t, "js", "const re = /a\\/b/g\nlet x = a / b", []Token{
+		{ClassKeyword, "const"},
+		{ClassPlain, " re = "},
+		{ClassRegex, "/a\\/b/g"},
+		{ClassPlain, "\n"},
+		{ClassKeyword, "let"},
+		{ClassPlain, " x = a / b"},
+	})
+
+	assertTokens(t, "js", "tocItems.forEach(e => `${e}`)", []Token{
+		{ClassPlain, "tocItems.forEach(e => "},
+		{ClassString, "`${e}`"},
+		{ClassPlain, ")"},
+	})
+}
+
+func TestTokenizeJSON(t *testing.T) {
+	assertTokens(t, "json", `{"a": "b", "c": [1.5, true]}`, []Token{
+		{ClassPlain, "{"},
+		{ClassKey, `"a"`},
+		{ClassPlain, ": "},
+		{ClassString, `"b"`},
+		{ClassPlain, ", "},
+		{ClassKey, `"c"`},
+		{ClassPlain, ": ["},
+		{ClassNumber, "1.5"},
+		{ClassPlain, ", "},
+		{ClassConstant, "true"},
+		{ClassPlain, "]}"},
+	})
+}
+
+func TestTokenizeRuby(t *testing.T) {
+	assertTokens(t, "ruby", "class Foo < Bar::Baz\n  def x?; @y = {a: :b}; end # c\nend", []Token{
+		{ClassKeyword, "class"},
+		{ClassPlain, " "},
+		{ClassClass, "Foo"},
+		{ClassPlain, " < "},
+		{ClassClass, "Bar"},
+		{ClassPlain, "::"},
+		{ClassClass, "Baz"},
+		{ClassPlain, "\n  "},
+		{ClassKeyword, "def"},
+		{ClassPlain, " x?; "},
+		{ClassVariable, "@y"},
+		{ClassPlain, " = {"},
+		{ClassSymbol, "a:"},
+		{ClassPlain, " "},
+		{ClassSymbol, ":b"},
+		{ClassPlain, "}; "},
+		{ClassKeyword, "end"},
+		{ClassPlain, " "},
+		{ClassComment, "# c"},
+		{ClassPlain, "\n"},
+		{ClassKeyword, "end"},
+	})
+}
+
+func TestTokenizeShell(t *testing.T) {
+	assertTokens(t, "sh", "export FOO=\"$BAR\" # note\necho a#b", []Token{
+		{ClassBuiltin, "export"},
+		{ClassPlain, " FOO="},
+		{ClassString, `"$BAR"`},
+		{ClassPlain, " "},
+		{ClassComment, "# note"},
+		{ClassPlain, "\n"},
+		{ClassBuiltin, "echo"},
+		{ClassPlain, " a#b"},
+	})
+}
+
+func TestTokenizeSQL(t *testing.T) {
+	assertTokens(t, "sql", "SELECT id FROM users WHERE name = 'it''s' -- hi", []Token{
+		{ClassKeyword, "SELECT"},
+		{ClassPlain, " id "},
+		{ClassKeyword, "FROM"},
+		{ClassPlain, " users "},
+		{ClassKeyword, "WHERE"},
+		{ClassPlain, " name = "},
+		{ClassString, "'it''s'"},
+		{ClassPlain, " "},
+		{ClassComment, "-- hi"},
+	})
+}
+
+func TestTokenizeYAML(t *testing.T) {
+	assertTokens(t, "yaml", "---\nname: \"x\" # c\nitems:\n  - enabled: true\n    count: 3\n", []Token{
+		{ClassKeyword, "---\n"},
+		{ClassKey, "name"},
+		{ClassPlain, ": "},
+		{ClassString, `"x"`},
+		{ClassPlain, " "},
+		{ClassComment, "# c"},
+		{ClassPlain, "\n"},
+		{ClassKey, "items"},
+		{ClassPlain, ":\n  - "},
+		{ClassKey, "enabled"},
+		{ClassPlain, ": "},
+		{ClassConstant, "true"},
+		{ClassPlain, "\n    "},
+		{ClassKey, "count"},
+		{ClassPlain, ": "},
+		{ClassNumber, "3"},
+		{ClassPlain, "\n"},
+	})
+}
+
+func assertTokens(t *testing.T, language, code string, expected []Token) {
+	tokens, ok := Tokenize(language, code)
+	assert.True(t, ok)
+	assert.Equal(t, expected, tokens)
+}
@@ -0,0 +1,240 @@
+package highlight
+
+// Patterns that are shared between a number of languages.
+const (
+	cBlockCommentPattern = `/\*[\s\S]*?(?:\*/|\z)`
+	cLineCommentPattern  = `//[^\n]*`
+	doubleQuotedPattern  = `"(?:\\.|[^"\\\n])*"`
+	hashCommentPattern   = `#[^\n]*`
+	identifierPattern    = `[A-Za-z_][A-Za-z0-9_]*`
+	numberPattern        = `0[xX][0-9a-fA-F_]+|[0-9][0-9_]*(?:\.[0-9_]+)?(?:[eE][+-]?[0-9]+)?`
+	singleQuotedPattern  = `'(?:\\.|[^'\\\n])*'`
+	whitespacePattern    = `\s+`
+)
+
+// lexers maps language names and their aliases to lexers.
+var lexers = map[string]*lexer{}
+
+func init() {
+	register(diffLexer, "diff", "patch")
+	register(goLexer, "go", "golang")
+	register(javascriptLexer, "javascript", "js", "es6")
+	register(jsonLexer, "json")
+	register(rubyLexer, "ruby", "rb")
+	register(shellLexer, "shell", "sh", "bash", "console", "zsh")
+	register(sqlLexer, "sql", "postgres", "postgresql", "psql")
+	register(yamlLexer, "yaml", "yml")
+}
+
+func register(l *lexer, names ...string) {
+	for _, name := range names {
+		lexers[name] = l
+	}
+}
+
+//
+// Diff
+//
+
+var diffLexer = &lexer{
+	rules: []*rule{
+		{pattern: re(`(?:diff|index|\+\+\+|---)[^\n]*`), class: ClassDiffHeader, lineStart: true},
+		{pattern: re(`@@[^\n]*`), class: ClassDiffHunk, lineStart: true},
+		{pattern: re(`\+[^\n]*`), class: ClassDiffInserted, lineStart: true},
+		{pattern: re(`-[^\n]*`), class: ClassDiffDeleted, lineStart: true},
+		{pattern: re(`[^\n]*\n?`), class: ClassPlain},
+	},
+}
+
+//
+// Go
+//
+
+var goLexer = &lexer{
+	keywords: words(ClassKeyword, `
+		break case chan const continue default defer else fallthrough for func
+		go goto if import interface map package range return select struct
+		switch type var`,
+		words(ClassType, `
+			bool byte complex64 complex128 error float32 float64 int int8 int16
+			int32 int64 rune string uint uint8 uint16 uint32 uint64 uintptr`,
+			words(ClassConstant, `true false nil iota`,
+				words(ClassBuiltin, `
+					append cap close complex copy delete imag len make new panic
+					print println real recover`, nil)))),
+	rules: []*rule{
+		{pattern: re(whitespacePattern), class: ClassPlain},
+		{pattern: re(cLineCommentPattern), class: ClassComment},
+		{pattern: re(cBlockCommentPattern), class: ClassComment},
+		{pattern: re("`[^`]*`"), class: ClassString},
+		{pattern: re(doubleQuotedPattern), class: ClassString},
+		{pattern: re(singleQuotedPattern), class: ClassString},
+		{pattern: re(identifierPattern), class: classIdentifier},
+		{pattern: re(numberPattern + `i?`), class: ClassNumber},
+	},
+}
+
+//
+// JavaScript
+//
+
+var javascriptLexer = &lexer{
+	keywords: words(ClassKeyword, `
+		async await break case catch class const continue debugger default
+		delete do else export extends finally for from function if import in
+		instanceof let new of return static super switch this throw try typeof
+		var void while with yield`,
+		words(ClassConstant, `true false null undefined NaN Infinity`,
+			words(ClassBuiltin, `
+				Array Boolean Date Error JSON Map Math Number Object Promise
+				RegExp Set String Symbol console document window`, nil))),
+	rules: []*rule{
+		{pattern: re(whitespacePattern), class: ClassPlain},
+		{pattern: re(cLineCommentPattern), class: ClassComment},
+		{pattern: re(cBlockCommentPattern), class: ClassComment},
+		{pattern: re("`(?:\\\\.|[^`\\\\])*`"), class: ClassString},
+		{pattern: re(doubleQuotedPattern), class: ClassString},
+		{pattern: re(singleQuotedPattern), class: ClassString},
+		{
+			pattern:    re(`/(?:\\.|\[(?:\\.|[^\]\\\n])*\]|[^/\\\n\[])+/[gimsuy]*`),
+			class:      ClassRegex,
+			valueStart: true,
+		},
+		{pattern: re(`[A-Za-z_$][A-Za-z0-9_$]*`), class: classIdentifier},
+		{pattern: re(numberPattern), class: ClassNumber},
+	},
+}
+
+//
+// JSON
+//
+
+var jsonLexer = &lexer{
+	keywords: words(ClassConstant, `true false null`, nil),
+	rules: []*rule{
+		{pattern: re(whitespacePattern), class: ClassPlain},
+		{
+			// Strings followed by a colon are keys.
+			pattern: re(doubleQuotedPattern),
+			classify: func(match, rest string) string {
+				for i := 0; i < len(rest); i++ {
+					if !isSpace(rest[i]) {
+						if rest[i] == ':' {
+							return ClassKey
+						}
+						break
+					}
+				}
+				return ClassString
+			},
+		},
+		{pattern: re(`-?[0-9]+(?:\.[0-9]+)?(?:[eE][+-]?[0-9]+)?`), class: ClassNumber},
+		{pattern: re(`[a-z]+`), class: classIdentifier},
+	},
+}
+
+//
+// Ruby
+//
+
+var rubyLexer = &lexer{
+	keywords: words(ClassKeyword, `
+		BEGIN END alias and begin break case class def defined? do else elsif
+		end ensure for if in module next not or redo rescue retry return super
+		then undef unless until when while yield`,
+		words(ClassConstant, `true false nil self __FILE__ __LINE__`,
+			words(ClassBuiltin, `
+				attr_accessor attr_reader attr_writer include extend lambda
+				loop proc puts raise require require_relative`, nil))),
+	rules: []*rule{
+		{pattern: re(whitespacePattern), class: ClassPlain},
+		{pattern: re(hashCommentPattern), class: ClassComment},
+		{pattern: re(`=begin[\s\S]*?(?:\n=end[^\n]*|\z)`), class: ClassComment, lineStart: true},
+		{pattern: re(doubleQuotedPattern), class: ClassString},
+		{pattern: re(singleQuotedPattern), class: ClassString},
+		{pattern: re(`::`), class: ClassPlain},
+		{pattern: re(`:[A-Za-z_][A-Za-z0-9_]*[?!=]?`), class: ClassSymbol},
+		{pattern: re(`([A-Za-z_][A-Za-z0-9_]*[?!]?:)(\s)`), groups: []string{ClassSymbol, ClassPlain}},
+		{pattern: re(`@@?[A-Za-z_][A-Za-z0-9_]*|\$[A-Za-z_][A-Za-z0-9_]*`), class: ClassVariable},
+		{pattern: re(`[A-Za-z_][A-Za-z0-9_]*[?!]?`), class: classIdentifierUpper},
+		{pattern: re(numberPattern), class: ClassNumber},
+	},
+}
+
+//
+// Shell
+//
+
+var shellLexer = &lexer{
+	keywords: words(ClassKeyword, `
+		case do done elif else esac fi for function if in local readonly return
+		select then until while`,
+		words(ClassBuiltin, `
+			alias cd echo eval exec exit export printf pwd read set shift source
+			test trap unset`, nil)),
+	rules: []*rule{
+		{pattern: re(whitespacePattern), class: ClassPlain},
+		{pattern: re(hashCommentPattern), class: ClassComment, wordStart: true},
+		{pattern: re(`"(?:\\.|[^"\\])*"`), class: ClassString},
+		{pattern: re(`'[^']*'`), class: ClassString},
+		{pattern: re(`\$\{[^}\n]*\}|\$[A-Za-z_][A-Za-z0-9_]*|\$[@#?$!*0-9\-]`), class: ClassVariable},
+		{pattern: re(`[A-Za-z_][A-Za-z0-9_\-]*`), class: classIdentifier},
+		{pattern: re(`[0-9]+\b`), class: ClassNumber},
+	},
+}
+
+//
+// SQL
+//
+
+var sqlLexer = &lexer{
+	ignoreCase: true,
+	keywords: words(ClassKeyword, `
+		add all alter and as asc begin between by cascade case check column
+		commit constraint create cross default delete desc distinct do drop
+		else end exists explain foreign from full grant group having if ilike
+		in index inner insert intersect into is join key left like limit not
+		null offset on or order outer primary references returning revoke
+		right rollback select set table then transaction trigger truncate
+		union unique update using values view when where with`,
+		words(ClassType, `
+			bigint bigserial boolean bytea char date decimal double integer
+			interval json jsonb numeric real serial smallint text timestamp
+			timestamptz uuid varchar`,
+			words(ClassConstant, `true false`, nil))),
+	rules: []*rule{
+		{pattern: re(whitespacePattern), class: ClassPlain},
+		{pattern: re(`--[^\n]*`), class: ClassComment},
+		{pattern: re(cBlockCommentPattern), class: ClassComment},
+		{pattern: re(`'(?:''|[^'])*'`), class: ClassString},
+		{pattern: re(`"(?:""|[^"])*"`), class: ClassPlain},
+		{pattern: re(`\$[0-9]+`), class: ClassVariable},
+		{pattern: re(identifierPattern), class: classIdentifier},
+		{pattern: re(`[0-9]+(?:\.[0-9]+)?`), class: ClassNumber},
+	},
+}
+
+//
+// YAML
+//
+
+var yamlLexer = &lexer{
+	keywords: words(ClassConstant, `true false null yes no on off True False Null ~`, nil),
+	rules: []*rule{
+		{pattern: re(`(?:---|\.\.\.)[ \t]*(?:\n|\z)`), class: ClassKeyword, lineStart: true},
+		{
+			pattern:   re(`([ \t]*(?:-[ \t]+)?)("[^"\n]*"|'[^'\n]*'|[^\s#:'"\-][^#:\n]*?|-[^\s#:][^#:\n]*?)(:)([ \t]+|\n|\z)`),
+			groups:    []string{ClassPlain, ClassKey, ClassPlain, ClassPlain},
+			lineStart: true,
+		},
+		// Newlines are kept separate from other whitespace so that indentation
+		// at the start of the next line can be matched as part of a key.
+		{pattern: re(`\n|[ \t]+`), class: ClassPlain},
+		{pattern: re(hashCommentPattern), class: ClassComment, wordStart: true},
+		{pattern: re(doubleQuotedPattern), class: ClassString},
+		{pattern: re(`'(?:''|[^'\n])*'`), class: ClassString},
+		{pattern: re(`[&*][A-Za-z0-9_\-]+`), class: ClassVariable},
+		{pattern: re(`(-?[0-9]+(?:\.[0-9]+)?)([ \t]*\n|[ \t]*\z)`), groups: []string{ClassNumber, ClassPlain}},
+		{pattern: re(`[A-Za-z~][A-Za-z0-9_\-]*`), class: classIdentifier},
+	},
+}
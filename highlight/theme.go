@@ -0,0 +1,49 @@
+package highlight
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// ContainerClass is the class given to the element that contains highlighted
+// code. Rules in the stylesheet are scoped to it.
+const ContainerClass = "highlight"
+
+// theme maps token classes to the CSS declarations used to style them. The
+// colors are loosely based on the "Tomorrow" theme which sits well against
+// the site's light background.
+var theme = map[string]string{
+	ClassBuiltin:      "color: #3e999f",
+	ClassClass:        "color: #c99e00",
+	ClassComment:      "color: #8e908c; font-style: italic",
+	ClassConstant:     "color: #f5871f",
+	ClassDiffDeleted:  "background-color: #fdecea; color: #c82829",
+	ClassDiffHeader:   "color: #4271ae; font-weight: bold",
+	ClassDiffHunk:     "color: #8959a8",
+	ClassDiffInserted: "background-color: #eef6e6; color: #718c00",
+	ClassKey:          "color: #4271ae",
+	ClassKeyword:      "color: #8959a8",
+	ClassNumber:       "color: #f5871f",
+	ClassRegex:        "color: #3e999f",
+	ClassString:       "color: #718c00",
+	ClassSymbol:       "color: #c82829",
+	ClassType:         "color: #c99e00",
+	ClassVariable:     "color: #c82829",
+}
+
+// Stylesheet generates CSS that styles highlighted code. It's meant to be
+// included in the site's stylesheet bundle.
+func Stylesheet() string {
+	var classes []string
+	for class := range theme {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+
+	var b bytes.Buffer
+	for _, class := range classes {
+		fmt.Fprintf(&b, ".%s .%s { %s; }\n", ContainerClass, class, theme[class])
+	}
+	return b.String()
+}
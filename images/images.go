@@ -0,0 +1,247 @@
+package images
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Quality used when encoding JPEG variants.
+const jpegQuality = 90
+
+// Variant is a version of a source image at a particular size.
+type Variant struct {
+	// Density is the pixel density that the variant is meant for (1 for a
+	// normal display and 2 for a high-DPI one). It's 0 for variants that were
+	// generated for a particular width instead.
+	Density int
+
+	// Height is the variant's height in pixels.
+	Height int
+
+	// Name is the variant's file name, like "diagram@2x.png" or
+	// "diagram-400w.png".
+	Name string
+
+	// Path is where the variant was written in the cache.
+	Path string
+
+	// Width is the variant's width in pixels.
+	Width int
+}
+
+// IsSource checks whether the file at the given path is an image that
+// variants can be generated from.
+func IsSource(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+// Process generates variants of a high resolution source image in cacheDir.
+// The source is taken as the 2x variant, and the 1x variant is half its size.
+// A variant is also generated for each of widths that's smaller than the
+// source.
+//
+// Variants are cached by the content hash of their source, so an image is
+// only resized again when it changes.
+func Process(sourcePath, cacheDir string, widths []int) ([]*Variant, error) {
+	data, err := ioutil.ReadFile(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't read image %v: %v", sourcePath, err)
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	base := filepath.Base(sourcePath)
+	extension := filepath.Ext(base)
+	name := base[0 : len(base)-len(extension)]
+
+	variants := []*Variant{
+		{Density: 1, Name: name + extension, Width: max(config.Width/2, 1)},
+		{Density: 2, Name: name + "@2x" + extension, Width: config.Width},
+	}
+	for _, width := range widths {
+		if width <= 0 || width >= config.Width {
+			continue
+		}
+		variants = append(variants, &Variant{
+			Name:  fmt.Sprintf("%v-%vw%v", name, width, extension),
+			Width: width,
+		})
+	}
+
+	err = os.MkdirAll(cacheDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only decoded if a variant isn't already in the cache.
+	var source image.Image
+
+	for _, variant := range variants {
+		variant.Height = scaledHeight(config.Width, config.Height, variant.Width)
+		variant.Path = filepath.Join(cacheDir,
+			fmt.Sprintf("%v-%vx%v%v", hash, variant.Width, variant.Height, extension))
+
+		if _, err := os.Stat(variant.Path); err == nil {
+			continue
+		}
+
+		// The source is already the right size for its 2x variant.
+		if variant.Width == config.Width {
+			err = writeFile(variant.Path, data)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if source == nil {
+			source, _, err = image.Decode(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("Couldn't decode image %v: %v", sourcePath, err)
+			}
+		}
+
+		err = writeImage(variant.Path, format,
+			resize(source, variant.Width, variant.Height))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return variants, nil
+}
+
+// Resizes an image by averaging the source pixels that fall under each
+// destination pixel. It's only meant for scaling down, which is all that
+// variants need, and gives good results for it without anything more
+// sophisticated.
+func resize(src image.Image, width, height int) image.Image {
+	bounds := src.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	scaleX := float64(bounds.Dx()) / float64(width)
+	scaleY := float64(bounds.Dy()) / float64(height)
+
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + int(float64(y)*scaleY)
+		y1 := bounds.Min.Y + int(float64(y+1)*scaleY)
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + int(float64(x)*scaleX)
+			x1 := bounds.Min.X + int(float64(x+1)*scaleX)
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			// Colors are averaged with alpha premultiplied so that fully
+			// transparent pixels don't bleed their color into the result.
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1 && sy < bounds.Max.Y; sy++ {
+				for sx := x0; sx < x1 && sx < bounds.Max.X; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					b += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+
+			if n == 0 || a == 0 {
+				continue
+			}
+
+			dst.Set(x, y, color.NRGBA64{
+				R: uint16(r * 0xffff / a),
+				G: uint16(g * 0xffff / a),
+				B: uint16(b * 0xffff / a),
+				A: uint16(a / n),
+			})
+		}
+	}
+
+	return dst
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Gets the height of an image scaled to the given width while keeping its
+// aspect ratio.
+func scaledHeight(width, height, scaledWidth int) int {
+	scaled := (height*scaledWidth + width/2) / width
+	if scaled < 1 {
+		return 1
+	}
+	return scaled
+}
+
+// Writes data to a file. It's written to a temporary file first so that an
+// interrupted build never leaves a partial file in the cache.
+func writeFile(path string, data []byte) error {
+	file, err := ioutil.TempFile(filepath.Dir(path), ".variant")
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+// Encodes an image in the given format and writes it to a file.
+func writeImage(path, format string, img image.Image) error {
+	var b bytes.Buffer
+	var err error
+
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&b, img, &jpeg.Options{Quality: jpegQuality})
+	case "png":
+		err = png.Encode(&b, img)
+	default:
+		err = fmt.Errorf("Can't write images in format: %v", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	return writeFile(path, b.Bytes())
+}
@@ -0,0 +1,166 @@
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestIsSource(t *testing.T) {
+	assert.True(t, IsSource("diagram.png"))
+	assert.True(t, IsSource("photo.JPG"))
+	assert.True(t, IsSource("photo.jpeg"))
+	assert.False(t, IsSource("diagram.svg"))
+	assert.False(t, IsSource("animation.gif"))
+}
+
+func TestProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "images")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Left half is red and right half is blue.
+	source := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			if x < 20 {
+				source.Set(x, y, color.NRGBA{R: 0xff, A: 0xff})
+			} else {
+				source.Set(x, y, color.NRGBA{B: 0xff, A: 0xff})
+			}
+		}
+	}
+
+	sourcePath := filepath.Join(dir, "diagram.png")
+	writePNG(t, sourcePath, source)
+
+	cacheDir := filepath.Join(dir, "cache")
+	variants, err := Process(sourcePath, cacheDir, []int{10, 40, 100})
+	assert.NoError(t, err)
+
+	// Widths as large as the source are skipped
+	assert.Equal(t, 3, len(variants))
+
+	assert.Equal(t, 1, variants[0].Density)
+	assert.Equal(t, "diagram.png", variants[0].Name)
+	assert.Equal(t, 20, variants[0].Width)
+	assert.Equal(t, 10, variants[0].Height)
+
+	assert.Equal(t, 2, variants[1].Density)
+	assert.Equal(t, "diagram@2x.png", variants[1].Name)
+	assert.Equal(t, 40, variants[1].Width)
+	assert.Equal(t, 20, variants[1].Height)
+
+	assert.Equal(t, 0, variants[2].Density)
+	assert.Equal(t, "diagram-10w.png", variants[2].Name)
+	assert.Equal(t, 10, variants[2].Width)
+	assert.Equal(t, 5, variants[2].Height)
+
+	for _, variant := range variants {
+		img := readImage(t, variant.Path)
+		assert.Equal(t, variant.Width, img.Bounds().Dx())
+		assert.Equal(t, variant.Height, img.Bounds().Dy())
+
+		// Colors on either side survive resizing
+		r, _, b, _ := img.At(0, 0).RGBA()
+		assert.Equal(t, []uint32{0xffff, 0}, []uint32{r, b})
+		r, _, b, _ = img.At(variant.Width-1, 0).RGBA()
+		assert.Equal(t, []uint32{0, 0xffff}, []uint32{r, b})
+	}
+
+	// Variants are reused from the cache when the source hasn't changed
+	past := time.Now().Add(-time.Hour)
+	for _, variant := range variants {
+		assert.NoError(t, os.Chtimes(variant.Path, past, past))
+	}
+
+	cached, err := Process(sourcePath, cacheDir, []int{10})
+	assert.NoError(t, err)
+	for i, variant := range cached {
+		assert.Equal(t, variants[i].Path, variant.Path)
+
+		info, err := os.Stat(variant.Path)
+		assert.NoError(t, err)
+		assert.Equal(t, past.Unix(), info.ModTime().Unix())
+	}
+
+	// A changed source gets new variants
+	source.Set(0, 0, color.NRGBA{G: 0xff, A: 0xff})
+	writePNG(t, sourcePath, source)
+
+	changed, err := Process(sourcePath, cacheDir, nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, variants[0].Path, changed[0].Path)
+}
+
+func TestProcessJPEG(t *testing.T) {
+	dir, err := ioutil.TempDir("", "images")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sourcePath := filepath.Join(dir, "photo.jpg")
+	file, err := os.Create(sourcePath)
+	assert.NoError(t, err)
+	assert.NoError(t, jpeg.Encode(file, image.NewGray(image.Rect(0, 0, 30, 15)), nil))
+	assert.NoError(t, file.Close())
+
+	variants, err := Process(sourcePath, dir, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(variants))
+	assert.Equal(t, "photo.jpg", variants[0].Name)
+	assert.Equal(t, 15, variants[0].Width)
+	assert.Equal(t, 8, variants[0].Height)
+
+	file = openFile(t, variants[0].Path)
+	defer file.Close()
+
+	_, format, err := image.Decode(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+}
+
+func TestProcessInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "images")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sourcePath := filepath.Join(dir, "broken.png")
+	assert.NoError(t, ioutil.WriteFile(sourcePath, []byte("not an image"), 0644))
+
+	_, err = Process(sourcePath, dir, nil)
+	assert.Equal(t, "Couldn't read image "+sourcePath+": image: unknown format", err.Error())
+}
+
+//
+// Helpers
+//
+
+func openFile(t *testing.T, path string) *os.File {
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	return file
+}
+
+func readImage(t *testing.T, path string) image.Image {
+	file := openFile(t, path)
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	assert.NoError(t, err)
+	return img
+}
+
+func writePNG(t *testing.T, path string, img image.Image) {
+	file, err := os.Create(path)
+	assert.NoError(t, err)
+	assert.NoError(t, png.Encode(file, img))
+	assert.NoError(t, file.Close())
+}
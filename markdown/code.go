@@ -0,0 +1,504 @@
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/brandur/singularity/diagram"
+	"github.com/brandur/singularity/highlight"
+	"github.com/russross/blackfriday"
+)
+
+const codeBlockHTML = `<pre%s><code%s>%s</code></pre>`
+
+// HTML for a code block with a caption naming the file that it came from.
+const codeBlockFileHTML = `<div class="code-block"><div class="code-file">%s</div>%s</div>`
+
+// HTML for a diagram drawn in a code block.
+const diagramHTML = `<div class="diagram">%s</div>`
+
+// HTML for a single line of a code block that's been annotated with line
+// numbers or highlighted lines.
+const codeLineHTML = `<span class="%s"%s>%s</span>`
+
+// The language of code blocks that contain ASCII art diagrams to be drawn as
+// SVG.
+const diagramLanguage = "diagram"
+
+// Escapes code that isn't highlighted the same way that Blackfriday does.
+var codeEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&quot;",
+)
+
+// Matches the opening or closing line of a fenced code block, capturing its
+// indentation, its marker, and its info string.
+var codeFenceRE = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ \\t]*(.*)$")
+
+// Matches a single option in a code block's info string like `lines=true` or
+// `file="main.go"`.
+var codeOptionRE = regexp.MustCompile(`^([a-z]+)=(?:"([^"]*)"|([^\s"]+))`)
+
+// codeInfo is the parsed info string of a fenced code block like:
+//
+//	```go {lines=true hl="3-5,9" file="main.go"}
+type codeInfo struct {
+	// file is a file name to show in a caption above the code.
+	file string
+
+	// highlighted are ranges of lines that should be emphasized.
+	highlighted []lineRange
+
+	// language is the language of the code.
+	language string
+
+	// lines enables a gutter of line numbers.
+	lines bool
+}
+
+// annotated checks whether the code block needs to be rendered line by line.
+func (i *codeInfo) annotated() bool {
+	return i.lines || len(i.highlighted) > 0
+}
+
+// isHighlighted checks whether the given line (starting at 1) is in one of
+// the block's highlighted ranges.
+func (i *codeInfo) isHighlighted(line int) bool {
+	for _, r := range i.highlighted {
+		if line >= r.start && line <= r.end {
+			return true
+		}
+	}
+	return false
+}
+
+// lineRange is an inclusive range of lines starting at 1.
+type lineRange struct {
+	start, end int
+}
+
+// Parses the info string of a code block as Blackfriday provides it, which is
+// the language optionally followed by options.
+func parseCodeInfo(info string) (*codeInfo, error) {
+	codeInfo := &codeInfo{}
+	rest := strings.TrimSpace(info)
+
+	// A language comes first if there is one. It's distinguishable from an
+	// option because it has no value.
+	if rest != "" {
+		end := strings.IndexAny(rest, " \t")
+		if end == -1 {
+			end = len(rest)
+		}
+		if !strings.Contains(rest[:end], "=") {
+			codeInfo.language = rest[:end]
+			rest = strings.TrimSpace(rest[end:])
+		}
+	}
+
+	seen := make(map[string]bool)
+	for rest != "" {
+		matches := codeOptionRE.FindStringSubmatch(rest)
+		if matches == nil {
+			return nil, fmt.Errorf("Malformed code block option: %v", rest)
+		}
+		rest = strings.TrimSpace(rest[len(matches[0]):])
+
+		key := matches[1]
+		value := matches[2] + matches[3]
+
+		if seen[key] {
+			return nil, fmt.Errorf("Code block option %q is given more than once", key)
+		}
+		seen[key] = true
+
+		err := setCodeOption(codeInfo, key, key, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codeInfo, nil
+}
+
+// Sets one of the options that can be given in a code block's info string.
+// Errors refer to the option by name, which is what it was given as.
+func setCodeOption(info *codeInfo, key, name, value string) error {
+	switch key {
+	case "file":
+		if value == "" {
+			return fmt.Errorf("Code block option %q can't be empty", name)
+		}
+		info.file = value
+
+	case "hl":
+		ranges, err := parseLineRanges(value)
+		if err != nil {
+			return fmt.Errorf("Code block option %q is invalid: %v", name, err)
+		}
+		info.highlighted = ranges
+
+	case "lines":
+		lines, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("Code block option %q should be true or false, not %q", name, value)
+		}
+		info.lines = lines
+
+	default:
+		return fmt.Errorf("Unknown code block option %q (known options are file, hl, and lines)", name)
+	}
+
+	return nil
+}
+
+// Parses a comma-separated list of lines and line ranges like "3-5,9".
+func parseLineRanges(s string) ([]lineRange, error) {
+	var ranges []lineRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+
+		bounds := strings.SplitN(part, "-", 2)
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil || start < 1 {
+			return nil, fmt.Errorf("%q isn't a line or range of lines", part)
+		}
+
+		end := start
+		if len(bounds) > 1 {
+			end, err = strconv.Atoi(bounds[1])
+			if err != nil || end < start {
+				return nil, fmt.Errorf("%q isn't a line or range of lines", part)
+			}
+		}
+
+		ranges = append(ranges, lineRange{start, end})
+	}
+	return ranges, nil
+}
+
+// Renders a code block. Code in a language that we know about is highlighted
+// so that pages are readable without any client-side JavaScript, and
+// diagrams are drawn as SVG.
+func (r *renderer) renderCodeBlock(w io.Writer, node *blackfriday.Node) {
+	// Info strings with options have already been validated by
+	// transformCodeFences, so an error here isn't expected.
+	info, err := parseCodeInfo(string(node.Info))
+	if err != nil {
+		info = &codeInfo{}
+	}
+
+	out := renderCode(info, string(node.Literal))
+
+	// Separate the block from whatever came before it in the same way that
+	// Blackfriday would.
+	if node.Prev != nil {
+		io.WriteString(w, "\n")
+	}
+
+	io.WriteString(w, out)
+	if node.Parent.Type != blackfriday.Item {
+		io.WriteString(w, "\n")
+	}
+}
+
+// Renders the HTML for a block of code, or for a diagram if that's what it
+// is.
+func renderCode(info *codeInfo, code string) string {
+	if info.language == diagramLanguage {
+		return fmt.Sprintf(diagramHTML, diagram.Render(code))
+	}
+
+	var preClasses []string
+	var codeAttrs, content string
+	if info.language != "" {
+		codeAttrs = fmt.Sprintf(` class="language-%s"`, html.EscapeString(info.language))
+	}
+
+	tokens, ok := highlight.Tokenize(info.language, code)
+	if ok {
+		preClasses = append(preClasses, highlight.ContainerClass)
+	}
+
+	switch {
+	case info.annotated():
+		if ok {
+			tokens, _ = highlight.Tokenize(info.language, strings.TrimSuffix(code, "\n"))
+		} else {
+			tokens = []highlight.Token{{Class: highlight.ClassPlain, Text: strings.TrimSuffix(code, "\n")}}
+		}
+
+		if info.lines {
+			preClasses = append(preClasses, "numbered")
+		}
+
+		content = renderCodeLines(info, highlight.SplitLines(tokens))
+
+	case ok:
+		content = highlight.Render(tokens)
+
+	default:
+		content = codeEscaper.Replace(code)
+	}
+
+	var preAttrs string
+	if len(preClasses) > 0 {
+		preAttrs = fmt.Sprintf(` class="%s"`, strings.Join(preClasses, " "))
+	}
+
+	out := fmt.Sprintf(codeBlockHTML, preAttrs, codeAttrs, content)
+	if info.file != "" {
+		out = fmt.Sprintf(codeBlockFileHTML, html.EscapeString(info.file), out)
+	}
+	return out
+}
+
+// Renders code one line at a time so that lines can be numbered and
+// highlighted. Each line is wrapped in a span. Numbers are left to CSS so that
+// they're not included when code is copied.
+func renderCodeLines(info *codeInfo, lines [][]highlight.Token) string {
+	rendered := make([]string, len(lines))
+	for i, tokens := range lines {
+		class := "line"
+		if info.isHighlighted(i + 1) {
+			class += " line-highlighted"
+		}
+
+		var attrs string
+		if info.lines {
+			attrs = fmt.Sprintf(` data-line="%v"`, i+1)
+		}
+
+		rendered[i] = fmt.Sprintf(codeLineHTML, class, attrs, highlight.Render(tokens))
+	}
+	return strings.Join(rendered, "\n") + "\n"
+}
+
+// Finds the closing line of a fenced code block, which is made of at least as
+// many of the same character as the opening marker and nothing else. Returns
+// len(lines) if the block is never closed.
+func findClosingFence(lines []string, start int, marker string) int {
+	for i := start; i < len(lines); i++ {
+		closing := codeFenceRE.FindStringSubmatch(lines[i])
+		if closing != nil && closing[3] == "" &&
+			closing[2][0] == marker[0] && len(closing[2]) >= len(marker) {
+			return i
+		}
+	}
+	return len(lines)
+}
+
+// Matches the opening tag of a raw HTML block, capturing the tag's name.
+var htmlBlockRE = regexp.MustCompile(`^<([a-zA-Z0-9]+)`)
+
+// Tags that start a raw HTML block when they open a line, which are the ones
+// that Blackfriday recognizes. It also recognizes "ins" and "del", but never
+// finds where they end, so they're left out.
+var htmlBlockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"canvas": true, "div": true, "dl": true, "fieldset": true,
+	"figcaption": true, "figure": true, "footer": true, "form": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hgroup": true, "iframe": true, "main": true,
+	"math": true, "nav": true, "noscript": true, "ol": true, "output": true,
+	"p": true, "pre": true, "progress": true, "script": true,
+	"section": true, "style": true, "table": true, "ul": true, "video": true,
+}
+
+// Matches the first line of a list item, whose content continues on lines
+// indented by a level.
+var listItemRE = regexp.MustCompile(`^ {0,3}(?:[\-*+]|[0-9]+\.)[ \t]`)
+
+// Finds the lines of the source that Markdown takes literally, which are
+// those in fenced code blocks, indented code blocks, and raw HTML blocks.
+// Extensions like math and wiki links shouldn't be expanded in any of them.
+//
+// The content of list items and footnotes is indented by a level, so an
+// indented code block within one is indented by two.
+func literalLines(lines []string) []bool {
+	literal := make([]bool, len(lines))
+
+	// Whether the last line was blank, which is the only place that an
+	// indented code block can start.
+	blank := true
+
+	// Whether the current line is within the content of a list item or a
+	// footnote.
+	container := false
+
+	// Whether the current line is within an indented code block, which
+	// continues across blank lines.
+	code := false
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if strings.TrimSpace(line) == "" {
+			blank = true
+			continue
+		}
+
+		switch {
+		case listItemRE.MatchString(line) || footnoteDefinitionRE.MatchString(line):
+			container = true
+			code = false
+			blank = false
+			continue
+
+		case container && isIndented(line):
+			line = dedent(line)
+
+		case blank:
+			container = false
+		}
+
+		start := blank
+		blank = false
+
+		if isIndented(line) && (code || start) {
+			literal[i] = true
+			code = true
+			continue
+		}
+
+		code = false
+
+		// Unlike a fence, an HTML block can't interrupt a paragraph.
+		end := -1
+		if matches := codeFenceRE.FindStringSubmatch(lines[i]); matches != nil {
+			end = findClosingFence(lines, i+1, matches[2])
+			if end == len(lines) {
+				end--
+			}
+		} else if start {
+			end = findHTMLBlockEnd(lines, i)
+		}
+
+		if end != -1 {
+			for ; i <= end; i++ {
+				literal[i] = true
+			}
+			i = end
+			blank = true
+		}
+	}
+
+	return literal
+}
+
+// Finds the last line of a raw HTML block starting at the given line, or -1
+// if there isn't one. Following Blackfriday, a block is either a comment, or
+// an opening block tag that's closed by a tag followed only by whitespace and
+// then a blank line. Either has to be followed by a newline.
+func findHTMLBlockEnd(lines []string, start int) int {
+	if strings.HasPrefix(lines[start], "<!--") {
+		for i := start; i < len(lines); i++ {
+			line := lines[i]
+			if i == start {
+				line = line[len("<!--"):]
+			}
+
+			end := strings.Index(line, "-->")
+			if end == -1 {
+				continue
+			}
+			if strings.TrimSpace(line[end+len("-->"):]) != "" || i+1 == len(lines) {
+				return -1
+			}
+			return i
+		}
+		return -1
+	}
+
+	matches := htmlBlockRE.FindStringSubmatch(lines[start])
+	if matches == nil || !htmlBlockTags[matches[1]] {
+		return -1
+	}
+
+	closing := "</" + matches[1] + ">"
+	for i := start; i < len(lines); i++ {
+		line := lines[i]
+		if i == start {
+			line = line[1:]
+		}
+
+		end := strings.LastIndex(line, closing)
+		if end == -1 || strings.TrimSpace(line[end+len(closing):]) != "" {
+			continue
+		}
+		if i+1 < len(lines) && strings.TrimSpace(lines[i+1]) == "" {
+			return i
+		}
+	}
+	return -1
+}
+
+// Validates the options of every fenced code block in the source and rewrites
+// its opening line so that Blackfriday will accept them. Options are written
+// in braces after the language:
+//
+//	```go {lines=true hl="3-5,9" file="main.go"}
+//
+// But Blackfriday only passes options through if the language is inside the
+// braces as well, so the line above becomes:
+//
+//	```{go lines=true hl="3-5,9" file="main.go"}
+func transformCodeFences(source string) (string, error) {
+	lines := strings.Split(source, "\n")
+
+	for i := 0; i < len(lines); i++ {
+		matches := codeFenceRE.FindStringSubmatch(lines[i])
+		if matches == nil {
+			continue
+		}
+
+		indent, marker, rawInfo := matches[1], matches[2], strings.TrimSpace(matches[3])
+
+		end := findClosingFence(lines, i+1, marker)
+		numLines := end - i - 1
+
+		start := i + 1
+		i = end
+
+		var info string
+		switch {
+		case strings.HasPrefix(rawInfo, "{") && strings.HasSuffix(rawInfo, "}"):
+			info = rawInfo[1 : len(rawInfo)-1]
+
+		case strings.Contains(rawInfo, "{"):
+			brace := strings.Index(rawInfo, "{")
+			if !strings.HasSuffix(rawInfo, "}") {
+				return "", &Error{Line: start, Message: fmt.Sprintf(
+					"Code block options should be closed with a brace: %v", rawInfo)}
+			}
+			info = strings.TrimSpace(rawInfo[:brace]) + " " + rawInfo[brace+1:len(rawInfo)-1]
+
+		default:
+			// No options, so there's nothing to rewrite.
+			continue
+		}
+
+		codeInfo, err := parseCodeInfo(info)
+		if err != nil {
+			return "", &Error{Line: start, Message: err.Error()}
+		}
+
+		for _, r := range codeInfo.highlighted {
+			if r.end > numLines {
+				return "", &Error{Line: start, Message: fmt.Sprintf(
+					"Code block option \"hl\" refers to line %v, but the block only has %v line(s)",
+					r.end, numLines)}
+			}
+		}
+
+		lines[start-1] = indent + marker + "{" + strings.TrimSpace(info) + "}"
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
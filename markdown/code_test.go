@@ -0,0 +1,157 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestLiteralLines(t *testing.T) {
+	testCases := []struct {
+		source  string
+		literal []int
+	}{
+		{"Text\n\n    code\n\n    more\nText", []int{3, 5}},
+		{"Text\n    continued", nil},
+		{"```\n    x\n```\n\n    y", []int{1, 2, 3, 5}},
+		{"```\nnever closed", []int{1, 2}},
+		{"- Item\n\n    more\n\n        code", []int{5}},
+		{"[^1]: Note.\n\n    More.\n\n        code", []int{5}},
+		{"<div>\n$x$\n</div>\n\nText", []int{1, 2, 3}},
+		{"Text\n\n<pre>$x$</pre>\n", []int{3}},
+		{"```\nx\n```\n<pre>$x$</pre>\n", []int{1, 2, 3, 4}},
+		{"<!--\n$x$\n-->\n", []int{1, 2, 3}},
+
+		// Not HTML blocks
+		{"<div>\n$x$\n</div>\nText", nil},
+		{"Text\n<pre>$x$</pre>\n", nil},
+		{"<span>$x$</span>\n", nil},
+		{"<pre>$x$</pre>", nil},
+	}
+
+	for _, testCase := range testCases {
+		var literal []int
+		for i, ok := range literalLines(strings.Split(testCase.source, "\n")) {
+			if ok {
+				literal = append(literal, i+1)
+			}
+		}
+		assert.Equal(t, testCase.literal, literal, testCase.source)
+	}
+}
+
+func TestParseCodeInfo(t *testing.T) {
+	info, err := parseCodeInfo(`go lines=true hl="3-5,9" file="main.go"`)
+	assert.NoError(t, err)
+	assert.Equal(t, &codeInfo{
+		file:        "main.go",
+		highlighted: []lineRange{{3, 5}, {9, 9}},
+		language:    "go",
+		lines:       true,
+	}, info)
+
+	// Options without a language
+	info, err = parseCodeInfo(`hl=2`)
+	assert.NoError(t, err)
+	assert.Equal(t, &codeInfo{highlighted: []lineRange{{2, 2}}}, info)
+
+	_, err = parseCodeInfo(`go colour=red`)
+	assert.Equal(t,
+		`Unknown code block option "colour" (known options are file, hl, and lines)`,
+		err.Error())
+
+	_, err = parseCodeInfo(`go lines=yes`)
+	assert.Equal(t, `Code block option "lines" should be true or false, not "yes"`,
+		err.Error())
+
+	_, err = parseCodeInfo(`go hl="5-3"`)
+	assert.Equal(t, `Code block option "hl" is invalid: "5-3" isn't a line or range of lines`,
+		err.Error())
+
+	_, err = parseCodeInfo(`go lines=true lines=false`)
+	assert.Equal(t, `Code block option "lines" is given more than once`, err.Error())
+
+	_, err = parseCodeInfo(`go file="main.go`)
+	assert.Equal(t, `Malformed code block option: file="main.go`, err.Error())
+}
+
+func TestRenderCodeBlock(t *testing.T) {
+	// Supported languages are highlighted
+	rendered, err := renderMarkdown("``` go\nreturn nil\n```", nil)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		`<pre class="highlight"><code class="language-go"><span class="k">return</span> <span class="kc">nil</span>
+</code></pre>
+`, rendered)
+
+	// Unsupported languages are escaped but otherwise left alone
+	rendered, err = renderMarkdown("``` cobol\nDISPLAY \"<HELLO>\".\n```", nil)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		`<pre><code class="language-cobol">DISPLAY &quot;&lt;HELLO&gt;&quot;.
+</code></pre>
+`, rendered)
+
+	// As are blocks without a language
+	rendered, err = renderMarkdown("    x < y\n", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "<pre><code>x &lt; y\n</code></pre>\n", rendered)
+}
+
+func TestRenderCodeBlockAnnotated(t *testing.T) {
+	rendered, err := renderMarkdown(
+		"```go {lines=true hl=\"2\" file=\"main.go\"}\n/* a\nb */\nx\n```", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `<div class="code-block"><div class="code-file">main.go</div>`+
+		`<pre class="highlight numbered"><code class="language-go">`+
+		`<span class="line" data-line="1"><span class="c">/* a</span></span>
+<span class="line line-highlighted" data-line="2"><span class="c">b */</span></span>
+<span class="line" data-line="3">x</span>
+</code></pre></div>
+`, rendered)
+
+	// Unsupported languages can be annotated too
+	rendered, err = renderMarkdown("```{cobol hl=1}\nA < B\n```", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `<pre><code class="language-cobol">`+
+		`<span class="line line-highlighted">A &lt; B</span>
+</code></pre>
+`, rendered)
+}
+
+func TestRenderCodeBlockDiagram(t *testing.T) {
+	rendered, err := renderMarkdown("```diagram\n-->\n```", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `<div class="diagram">`+
+		`<svg xmlns="http://www.w3.org/2000/svg" width="24" height="16" viewBox="0 0 24 16">`+
+		`<g fill="none" stroke="currentColor" stroke-width="1.5" stroke-linecap="round" stroke-linejoin="round">`+
+		`<line x1="0" y1="8" x2="16" y2="8"></line></g>`+
+		`<g fill="currentColor"><polygon points="24,8 16,4 16,12"></polygon></g>`+
+		`</svg></div>
+`, rendered)
+}
+
+func TestTransformCodeFences(t *testing.T) {
+	source, err := transformCodeFences("Text\n\n```go {lines=true file=\"main.go\"}\nx\n```\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "Text\n\n```{go lines=true file=\"main.go\"}\nx\n```\n", source)
+
+	// Fences without options and the contents of code blocks are untouched
+	in := "````\n```go {bad=option}\n````\n``` ruby\n```\n"
+	source, err = transformCodeFences(in)
+	assert.NoError(t, err)
+	assert.Equal(t, in, source)
+
+	_, err = transformCodeFences("Text\n\n```go {colour=red}\nx\n```\n")
+	assert.Equal(t, `line 3: Unknown code block option "colour" (known options are file, hl, and lines)`,
+		err.Error())
+
+	_, err = transformCodeFences("```go {hl=\"1-3\"}\nx\ny\n```\n")
+	assert.Equal(t, `line 1: Code block option "hl" refers to line 3, but the block only has 2 line(s)`,
+		err.Error())
+
+	_, err = transformCodeFences("```go {lines=true\nx\n```\n")
+	assert.Equal(t, `line 1: Code block options should be closed with a brace: go {lines=true`,
+		err.Error())
+}
@@ -0,0 +1,513 @@
+package markdown
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Directive is a use of a directive in a document. Directives sit on a line
+// of their own and take quoted attributes, which may contain escaped quotes
+// and backslashes:
+//
+//	!fig src="/assets/fig.png" caption="A \"quoted\" caption."
+//
+// Some also take a Markdown body. The body starts after a brace at the end of
+// the directive's line and ends with a line containing only a closing brace:
+//
+//	!note title="Heads up" {
+//	Body in **Markdown**.
+//	}
+type Directive struct {
+	// Attrs are the directive's attributes.
+	Attrs map[string]string
+
+	// Body is the raw Markdown of the directive's body.
+	Body string
+
+	// HasBody is whether the directive was given a body.
+	HasBody bool
+
+	// Index is the directive's position among directives of the same name in
+	// the document, starting at 1. It's used to number things like figures.
+	Index int
+
+	// Line is the line in the source on which the directive appears.
+	Line int
+
+	// Name is the directive's name without its leading "!".
+	Name string
+}
+
+// DirectiveBody describes whether a directive takes a body.
+type DirectiveBody int
+
+// Kinds of directive body.
+const (
+	// BodyNone is for directives that can't have a body.
+	BodyNone DirectiveBody = iota
+
+	// BodyOptional is for directives that may or may not have a body.
+	BodyOptional
+
+	// BodyRequired is for directives that must have a body.
+	BodyRequired
+)
+
+// DirectiveHandler renders a directive.
+type DirectiveHandler struct {
+	// Attrs are the attributes that the directive accepts. Any other
+	// attribute is an error.
+	Attrs []string
+
+	// Body is whether the directive takes a body.
+	Body DirectiveBody
+
+	// Render produces HTML for the directive. For a directive with a body,
+	// the body is rendered as part of the document between the returned
+	// opening and closing HTML. Directives without a body should return all
+	// their HTML as the opening.
+	Render func(d *Directive, options *RenderOptions) (open, close string, err error)
+
+	// Required are attributes that must be given.
+	Required []string
+}
+
+// The directives that every pipeline starts with.
+var defaultDirectives = map[string]*DirectiveHandler{
+	"aside": {
+		Body:   BodyRequired,
+		Render: renderAside,
+	},
+	"code": {
+		Attrs:    []string{"dedent", "hl", "lang", "lines", "numbers", "region", "src"},
+		Render:   renderCodeExcerpt,
+		Required: []string{"src"},
+	},
+	"details": {
+		Attrs:    []string{"open", "summary"},
+		Body:     BodyRequired,
+		Render:   renderDetails,
+		Required: []string{"summary"},
+	},
+	"fig": {
+		Attrs:    []string{"alt", "caption", "name", "src"},
+		Render:   renderFigure,
+		Required: []string{"src"},
+	},
+	"note": {
+		Attrs:  []string{"title"},
+		Body:   BodyRequired,
+		Render: renderNote,
+	},
+	"pullquote": {
+		Attrs:  []string{"cite"},
+		Body:   BodyRequired,
+		Render: renderPullquote,
+	},
+}
+
+// Matches a line that starts a directive, capturing its name and the rest of
+// the line.
+var directiveRE = regexp.MustCompile(`^!([a-z][a-z0-9\-]*)(?:[ \t]+(.*?))?[ \t]*$`)
+
+// Matches the name of an attribute.
+var directiveAttrNameRE = regexp.MustCompile(`^[a-z][a-z0-9\-_]*`)
+
+// Directives are replaced in Markdown by HTML comments containing their
+// rendered HTML, which the renderer then swaps back in. Going through a
+// comment keeps Blackfriday from interpreting the HTML, and lets a
+// directive's body stay part of the document so that things like footnotes
+// and headers within it work normally.
+const directivePlaceholderPrefix = "<!--singularity-html:"
+const directivePlaceholderSuffix = "-->"
+
+// Placeholders that stand in for whole blocks are marked so that they can be
+// separated from the content around them by blank lines just before the
+// document is parsed, which Blackfriday needs to see them as blocks of their
+// own. Adding the blank lines any earlier would throw off the line numbers
+// that later transforms report errors with.
+const blockPlaceholderPrefix = "<!--singularity-block:"
+
+// RegisterDirective adds a directive to the pipeline, replacing any existing
+// directive with the same name.
+func (p *Pipeline) RegisterDirective(name string, handler *DirectiveHandler) error {
+	if !directiveAttrNameRE.MatchString(name) || strings.Contains(name, "_") {
+		return fmt.Errorf("Directive name %q should be lowercase letters, numbers, and dashes", name)
+	}
+
+	if handler.Render == nil {
+		return fmt.Errorf("Directive !%v must have a render function", name)
+	}
+
+	p.directives[name] = handler
+	return nil
+}
+
+// Replaces every directive in the source with its rendered HTML. Directives
+// in code blocks are left alone.
+func (p *Pipeline) transformDirectives(source string, options *RenderOptions) (string, error) {
+	sourceLines := strings.Split(source, "\n")
+	state := &directiveState{
+		counts:     make(map[string]int),
+		directives: make(map[string][]*Directive),
+	}
+
+	lines, err := p.expandDirectives(sourceLines, 1, state, options)
+	if err != nil {
+		return "", err
+	}
+
+	lines, err = resolveFigureReferences(sourceLines, lines, state.directives["fig"])
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// Tracks the directives seen so far while expanding a document.
+type directiveState struct {
+	counts     map[string]int
+	directives map[string][]*Directive
+}
+
+// Expands directives in a set of lines, the first of which is at firstLine
+// in the original source. Each line of a directive is replaced by exactly one
+// line so that line numbers stay the same.
+func (p *Pipeline) expandDirectives(lines []string, firstLine int, state *directiveState, options *RenderOptions) ([]string, error) {
+	var out []string
+
+	for i := 0; i < len(lines); i++ {
+		if matches := codeFenceRE.FindStringSubmatch(lines[i]); matches != nil {
+			end := findClosingFence(lines, i+1, matches[2])
+			if end == len(lines) {
+				end--
+			}
+			out = append(out, lines[i:end+1]...)
+			i = end
+			continue
+		}
+
+		matches := directiveRE.FindStringSubmatch(lines[i])
+		if matches == nil {
+			out = append(out, lines[i])
+			continue
+		}
+
+		line := firstLine + i
+		directive, err := p.parseDirective(matches[1], matches[2], line)
+		if err != nil {
+			return nil, err
+		}
+
+		// Counted before the body is expanded so that directives are indexed
+		// in the order that they appear.
+		state.counts[directive.Name]++
+		directive.Index = state.counts[directive.Name]
+		state.directives[directive.Name] = append(state.directives[directive.Name], directive)
+
+		var body []string
+		end := i
+		if directive.HasBody {
+			end = findDirectiveEnd(lines, i+1)
+			if end == -1 {
+				return nil, &Error{Line: line, Message: fmt.Sprintf(
+					"Directive !%v is never closed with a line containing only }", directive.Name)}
+			}
+
+			body, err = p.expandDirectives(lines[i+1:end], line+1, state, options)
+			if err != nil {
+				return nil, err
+			}
+			directive.Body = strings.Join(lines[i+1:end], "\n")
+		}
+
+		open, close, err := p.directives[directive.Name].Render(directive, options)
+		if err != nil {
+			return nil, &Error{Line: line, Message: fmt.Sprintf(
+				"Directive !%v: %v", directive.Name, err)}
+		}
+
+		out = append(out, blockPlaceholder(open))
+		if directive.HasBody {
+			out = append(out, body...)
+			out = append(out, blockPlaceholder(close))
+		}
+
+		i = end
+	}
+
+	return out, nil
+}
+
+// Parses and validates a directive's name and attributes.
+func (p *Pipeline) parseDirective(name, rest string, line int) (*Directive, error) {
+	handler, ok := p.directives[name]
+	if !ok {
+		var names []string
+		for name := range p.directives {
+			names = append(names, "!"+name)
+		}
+		sort.Strings(names)
+
+		return nil, &Error{Line: line, Message: fmt.Sprintf(
+			"Unknown directive !%v (known directives are %v)", name, strings.Join(names, ", "))}
+	}
+
+	attrs, hasBody, err := parseDirectiveAttrs(rest)
+	if err != nil {
+		return nil, &Error{Line: line, Message: fmt.Sprintf("Directive !%v: %v", name, err)}
+	}
+
+	known := make(map[string]bool)
+	for _, attr := range handler.Attrs {
+		known[attr] = true
+	}
+
+	var keys []string
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !known[key] {
+			message := fmt.Sprintf("Unknown attribute %q for directive !%v", key, name)
+			if len(handler.Attrs) > 0 {
+				message += fmt.Sprintf(" (known attributes are %v)", strings.Join(handler.Attrs, ", "))
+			} else {
+				message += " (it takes no attributes)"
+			}
+			return nil, &Error{Line: line, Message: message}
+		}
+	}
+
+	for _, attr := range handler.Required {
+		if _, ok := attrs[attr]; !ok {
+			return nil, &Error{Line: line, Message: fmt.Sprintf(
+				"Directive !%v is missing required attribute %q", name, attr)}
+		}
+	}
+
+	switch {
+	case hasBody && handler.Body == BodyNone:
+		return nil, &Error{Line: line, Message: fmt.Sprintf(
+			"Directive !%v doesn't take a body", name)}
+	case !hasBody && handler.Body == BodyRequired:
+		return nil, &Error{Line: line, Message: fmt.Sprintf(
+			"Directive !%v needs a body between { and }", name)}
+	}
+
+	return &Directive{Attrs: attrs, HasBody: hasBody, Line: line, Name: name}, nil
+}
+
+// Parses a directive's attributes like `src="fig.png" caption="A \"fig\""`.
+// Values must be double quoted, and may contain escaped double quotes and
+// backslashes. A trailing brace indicates that the directive has a body.
+func parseDirectiveAttrs(s string) (map[string]string, bool, error) {
+	attrs := make(map[string]string)
+
+	rest := strings.TrimSpace(s)
+	for rest != "" {
+		if rest == "{" {
+			return attrs, true, nil
+		}
+
+		name := directiveAttrNameRE.FindString(rest)
+		if name == "" {
+			return nil, false, fmt.Errorf("Expected an attribute name at: %v", rest)
+		}
+		rest = rest[len(name):]
+
+		if !strings.HasPrefix(rest, `="`) {
+			return nil, false, fmt.Errorf(`Attribute %q should be followed by ="value"`, name)
+		}
+		rest = rest[2:]
+
+		var value []byte
+		closed := false
+		for i := 0; i < len(rest); i++ {
+			c := rest[i]
+
+			if c == '\\' {
+				if i+1 >= len(rest) || (rest[i+1] != '"' && rest[i+1] != '\\') {
+					return nil, false, fmt.Errorf(
+						`Attribute %q has an invalid escape (only \" and \\ are allowed)`, name)
+				}
+				value = append(value, rest[i+1])
+				i++
+				continue
+			}
+
+			if c == '"' {
+				rest = rest[i+1:]
+				closed = true
+				break
+			}
+
+			value = append(value, c)
+		}
+
+		if !closed {
+			return nil, false, fmt.Errorf("Attribute %q is missing a closing quote", name)
+		}
+
+		if _, ok := attrs[name]; ok {
+			return nil, false, fmt.Errorf("Attribute %q is given more than once", name)
+		}
+		attrs[name] = string(value)
+
+		if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+			return nil, false, fmt.Errorf("Expected a space after attribute %q", name)
+		}
+		rest = strings.TrimSpace(rest)
+	}
+
+	return attrs, false, nil
+}
+
+// Finds the line that closes a directive's body, skipping over code blocks
+// and the bodies of nested directives. Returns -1 if there isn't one.
+func findDirectiveEnd(lines []string, start int) int {
+	depth := 1
+	for i := start; i < len(lines); i++ {
+		if matches := codeFenceRE.FindStringSubmatch(lines[i]); matches != nil {
+			i = findClosingFence(lines, i+1, matches[2])
+			continue
+		}
+
+		if matches := directiveRE.FindStringSubmatch(lines[i]); matches != nil &&
+			strings.HasSuffix(matches[2], "{") {
+			depth++
+			continue
+		}
+
+		if strings.TrimSpace(lines[i]) == "}" {
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Wraps HTML in a placeholder that survives Markdown rendering.
+func directivePlaceholder(html string) string {
+	return directivePlaceholderPrefix +
+		base64.StdEncoding.EncodeToString([]byte(html)) +
+		directivePlaceholderSuffix
+}
+
+// Wraps HTML in a placeholder that becomes a block of its own.
+func blockPlaceholder(html string) string {
+	return blockPlaceholderPrefix +
+		base64.StdEncoding.EncodeToString([]byte(html)) +
+		directivePlaceholderSuffix
+}
+
+// Extracts the HTML from a placeholder of either kind. Returns false if the
+// given HTML isn't a placeholder.
+func parseDirectivePlaceholder(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if !strings.HasSuffix(s, directivePlaceholderSuffix) {
+		return "", false
+	}
+
+	var prefix string
+	switch {
+	case strings.HasPrefix(s, directivePlaceholderPrefix):
+		prefix = directivePlaceholderPrefix
+	case strings.HasPrefix(s, blockPlaceholderPrefix):
+		prefix = blockPlaceholderPrefix
+	default:
+		return "", false
+	}
+
+	data, err := base64.StdEncoding.DecodeString(
+		s[len(prefix) : len(s)-len(directivePlaceholderSuffix)])
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// Surrounds every block placeholder with blank lines so that Blackfriday sees
+// it as a block of its own. Blackfriday also only recognizes a comment as a
+// block when it's followed by a newline, which a placeholder at the very end
+// of the source wouldn't be.
+func separateBlockPlaceholders(source string) string {
+	if !strings.Contains(source, blockPlaceholderPrefix) {
+		return source
+	}
+
+	lines := strings.Split(source, "\n")
+	var out []string
+	for i, line := range lines {
+		if !strings.HasPrefix(line, blockPlaceholderPrefix) {
+			out = append(out, line)
+			continue
+		}
+
+		if len(out) > 0 && strings.TrimSpace(out[len(out)-1]) != "" {
+			out = append(out, "")
+		}
+		out = append(out, line)
+		if i+1 == len(lines) || strings.TrimSpace(lines[i+1]) != "" {
+			out = append(out, "")
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// Renders a snippet of Markdown that's expected to be inline content like a
+// caption, without the paragraph that it'd normally be wrapped in.
+func renderInline(source string, options *RenderOptions) string {
+	rendered := strings.TrimSpace(renderAST(parseMarkdown(source), options))
+	if strings.HasPrefix(rendered, "<p>") && strings.HasSuffix(rendered, "</p>") &&
+		strings.Count(rendered, "<p>") == 1 {
+		rendered = rendered[len("<p>") : len(rendered)-len("</p>")]
+	}
+	return rendered
+}
+
+//
+// Directive handlers
+//
+
+func renderAside(d *Directive, options *RenderOptions) (string, string, error) {
+	return `<aside>`, `</aside>`, nil
+}
+
+func renderDetails(d *Directive, options *RenderOptions) (string, string, error) {
+	var attrs string
+	switch d.Attrs["open"] {
+	case "", "false":
+	case "true":
+		attrs = " open"
+	default:
+		return "", "", fmt.Errorf(`open should be "true" or "false", not %q`, d.Attrs["open"])
+	}
+
+	return fmt.Sprintf(`<details%s><summary>%s</summary>`,
+		attrs, renderInline(d.Attrs["summary"], options)), `</details>`, nil
+}
+
+func renderNote(d *Directive, options *RenderOptions) (string, string, error) {
+	open := `<div class="note">`
+	if title := d.Attrs["title"]; title != "" {
+		open += fmt.Sprintf(`<p class="note-title">%s</p>`, renderInline(title, options))
+	}
+	return open, `</div>`, nil
+}
+
+func renderPullquote(d *Directive, options *RenderOptions) (string, string, error) {
+	close := `</blockquote>`
+	if cite := d.Attrs["cite"]; cite != "" {
+		close = fmt.Sprintf(`<cite>%s</cite>`, renderInline(cite, options)) + close
+	}
+	return `<blockquote class="pullquote">`, close, nil
+}
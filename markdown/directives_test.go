@@ -0,0 +1,193 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestParseDirectiveAttrs(t *testing.T) {
+	attrs, hasBody, err := parseDirectiveAttrs(`src="fig.png" caption="A \"quoted\" \\ caption."`)
+	assert.NoError(t, err)
+	assert.False(t, hasBody)
+	assert.Equal(t, map[string]string{
+		"caption": `A "quoted" \ caption.`,
+		"src":     "fig.png",
+	}, attrs)
+
+	attrs, hasBody, err = parseDirectiveAttrs(`title="Heads up" {`)
+	assert.NoError(t, err)
+	assert.True(t, hasBody)
+	assert.Equal(t, map[string]string{"title": "Heads up"}, attrs)
+
+	attrs, hasBody, err = parseDirectiveAttrs(``)
+	assert.NoError(t, err)
+	assert.False(t, hasBody)
+	assert.Equal(t, map[string]string{}, attrs)
+
+	_, _, err = parseDirectiveAttrs(`src=fig.png`)
+	assert.Equal(t, `Attribute "src" should be followed by ="value"`, err.Error())
+
+	_, _, err = parseDirectiveAttrs(`src="fig.png`)
+	assert.Equal(t, `Attribute "src" is missing a closing quote`, err.Error())
+
+	_, _, err = parseDirectiveAttrs(`src="a\nb"`)
+	assert.Equal(t, `Attribute "src" has an invalid escape (only \" and \\ are allowed)`, err.Error())
+
+	_, _, err = parseDirectiveAttrs(`src="a"src="b"`)
+	assert.Equal(t, `Expected a space after attribute "src"`, err.Error())
+
+	_, _, err = parseDirectiveAttrs(`src="a" src="b"`)
+	assert.Equal(t, `Attribute "src" is given more than once`, err.Error())
+}
+
+func TestRenderDirectivesWithBodies(t *testing.T) {
+	rendered, err := Render(`Before.
+
+!note title="Heads *up*" {
+A note with a footnote[^1].
+
+!aside {
+Nested.
+}
+}
+After.
+
+[^1]: The footnote.`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `<p>Before.</p>
+
+<div class="note"><p class="note-title">Heads <em>up</em></p>
+
+<p>A note with a footnote<sup id="footnote-1-source"><a href="#footnote-1">1</a></sup>.</p>
+
+<aside>
+
+<p>Nested.</p>
+
+</aside>
+
+</div>
+
+<p>After.</p>
+`, collapseFootnotes(rendered))
+
+	rendered, err = Render(`!details summary="The `+"`SELECT`"+`" open="true" {
+`+"```sql\nSELECT 1\n```"+`
+}`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `<details open><summary>The <code>SELECT</code></summary>
+
+<pre class="highlight"><code class="language-sql"><span class="k">SELECT</span> <span class="m">1</span>
+</code></pre>
+
+</details>
+`, rendered)
+
+	rendered, err = Render(`!pullquote cite="Someone" {
+Quotable.
+}`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `<blockquote class="pullquote">
+<p>Quotable.</p>
+
+<cite>Someone</cite></blockquote>
+`, rendered)
+
+	// Directives needn't be separated from what's around them by blank lines
+	rendered, err = Render("Before.\n!aside {\nNested.\n}\nAfter.", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `<p>Before.</p>
+
+<aside>
+
+<p>Nested.</p>
+
+</aside>
+
+<p>After.</p>
+`, rendered)
+
+	// Directives in code are left alone
+	rendered, err = Render("```\n!unknown {\n```", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "<pre><code>!unknown {\n</code></pre>\n", rendered)
+}
+
+func TestRenderDirectiveErrors(t *testing.T) {
+	_, err := Render("Text.\n\n!chart src=\"a.csv\"", nil)
+	assert.Equal(t, "line 3: Unknown directive !chart "+
+		"(known directives are !aside, !code, !details, !fig, !note, !pullquote)", err.Error())
+
+	_, err = Render("!fig src=\"a.png\" width=\"100\"", nil)
+	assert.Equal(t, `line 1: Unknown attribute "width" for directive !fig (known attributes are alt, caption, name, src)`,
+		err.Error())
+
+	_, err = Render("!aside title=\"Aside\" {\nBody.\n}", nil)
+	assert.Equal(t, `line 1: Unknown attribute "title" for directive !aside (it takes no attributes)`,
+		err.Error())
+
+	_, err = Render("!fig caption=\"Caption\"", nil)
+	assert.Equal(t, `line 1: Directive !fig is missing required attribute "src"`, err.Error())
+
+	_, err = Render("!note", nil)
+	assert.Equal(t, `line 1: Directive !note needs a body between { and }`, err.Error())
+
+	_, err = Render("!fig src=\"a.png\" {\nBody.\n}", nil)
+	assert.Equal(t, `line 1: Directive !fig doesn't take a body`, err.Error())
+
+	_, err = Render("Text.\n\n!note {\nBody.", nil)
+	assert.Equal(t, `line 3: Directive !note is never closed with a line containing only }`, err.Error())
+
+	_, err = Render("!note {\n\n!fig src=\"a.png\" caption=\"a\nb\"\n}", nil)
+	assert.Equal(t, `line 3: Directive !fig: Attribute "caption" is missing a closing quote`, err.Error())
+
+	_, err = Render("!details summary=\"Summary\" open=\"yes\" {\nBody.\n}", nil)
+	assert.Equal(t, `line 1: Directive !details: open should be "true" or "false", not "yes"`, err.Error())
+
+	// Directives don't shift the lines of anything after them
+	_, err = Render("!note {\nBody.\n}\n```go {bogus=1}\n```", nil)
+	assert.Equal(t, `line 4: Unknown code block option "bogus" (known options are file, hl, and lines)`,
+		err.Error())
+
+	_, err = Render("Text.\n!fig src=\"a.png\"\n```go {bogus=1}\n```", nil)
+	assert.Equal(t, `line 3: Unknown code block option "bogus" (known options are file, hl, and lines)`,
+		err.Error())
+}
+
+func TestRegisterDirective(t *testing.T) {
+	p := NewPipeline()
+
+	err := p.RegisterDirective("hello", &DirectiveHandler{
+		Attrs: []string{"name"},
+		Render: func(d *Directive, options *RenderOptions) (string, string, error) {
+			return "<p>Hello, " + d.Attrs["name"] + ".</p>", "", nil
+		},
+	})
+	assert.NoError(t, err)
+
+	rendered, err := p.Render(`!hello name="world"`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "<p>Hello, world.</p>\n", rendered)
+
+	// Other pipelines aren't affected
+	_, err = Render(`!hello name="world"`, nil)
+	assert.Contains(t, err.Error(), "Unknown directive !hello")
+
+	err = p.RegisterDirective("Hello", &DirectiveHandler{Render: renderAside})
+	assert.Equal(t, `Directive name "Hello" should be lowercase letters, numbers, and dashes`,
+		err.Error())
+
+	err = p.RegisterDirective("hello", &DirectiveHandler{})
+	assert.Equal(t, `Directive !hello must have a render function`, err.Error())
+}
+
+// Strips the footnotes section from rendered HTML so that tests can focus on
+// the rest of the document.
+func collapseFootnotes(rendered string) string {
+	if i := strings.Index(rendered, "\n<div id=\"footnotes\">"); i != -1 {
+		return rendered[:i]
+	}
+	return rendered
+}
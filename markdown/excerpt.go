@@ -0,0 +1,179 @@
+package markdown
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Matches a line that marks the start or end of a named region in a source
+// file. Markers must be in a comment like:
+//
+//	// region: handler
+//	// endregion: handler
+var regionMarkerRE = regexp.MustCompile(`^\s*(?://|#|--|/\*|<!--|;)\s*(end)?region:\s*([\w.\-]+)`)
+
+// Code block options that can be given to a `!code` directive as attributes,
+// mapped to their names in the info string of a fenced code block. The option
+// for line numbers is named differently because `lines` picks the lines of an
+// excerpt.
+var codeExcerptOptions = []struct{ attr, option string }{
+	{"hl", "hl"},
+	{"numbers", "lines"},
+}
+
+// Renders a `!code` directive, which embeds a code block containing an
+// excerpt of a file:
+//
+//	!code src="examples/server.go" lines="10-42"
+//	!code src="examples/server.go" region="handler" hl="3" numbers="true"
+//
+// Excerpts are either a range of lines or a region of the file that's been
+// delimited with region markers. Either way, the directive fails if the file
+// or the excerpt within it doesn't exist so that snippets in articles can't
+// drift away from real code. Lines are kept exactly as they are in the file
+// unless `dedent="true"` is given to remove the indentation common to all of
+// them.
+//
+// The code block is captioned with the file's path and its language is
+// inferred from the file's extension unless one is given with `lang`. Lines
+// can be highlighted and numbered with `hl` and `numbers`, which work like
+// the `hl` and `lines` options of a fenced code block.
+func renderCodeExcerpt(d *Directive, options *RenderOptions) (string, string, error) {
+	var codeDir string
+	if options != nil {
+		codeDir = options.CodeDir
+	}
+
+	src := d.Attrs["src"]
+
+	clean := filepath.Clean(filepath.FromSlash(src))
+	if filepath.IsAbs(clean) || clean == ".." ||
+		strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", "", fmt.Errorf("src %q should be a relative path within the repository", src)
+	}
+
+	language := d.Attrs["lang"]
+	if language == "" {
+		language = strings.TrimPrefix(filepath.Ext(src), ".")
+	}
+
+	info := &codeInfo{file: src, language: language}
+	for _, excerptOption := range codeExcerptOptions {
+		if value, ok := d.Attrs[excerptOption.attr]; ok {
+			err := setCodeOption(info, excerptOption.option, excerptOption.attr, value)
+			if err != nil {
+				return "", "", err
+			}
+		}
+	}
+
+	var dedent bool
+	switch d.Attrs["dedent"] {
+	case "", "false":
+	case "true":
+		dedent = true
+	default:
+		return "", "", fmt.Errorf(`dedent should be "true" or "false", not %q`, d.Attrs["dedent"])
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(codeDir, clean))
+	if err != nil {
+		return "", "", fmt.Errorf("couldn't read %q: %v", src, err)
+	}
+
+	fileLines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+
+	var code []string
+	switch {
+	case d.Attrs["lines"] != "" && d.Attrs["region"] != "":
+		return "", "", fmt.Errorf("takes either lines or region, but not both")
+
+	case d.Attrs["lines"] != "":
+		ranges, err := parseLineRanges(d.Attrs["lines"])
+		if err != nil || len(ranges) != 1 {
+			return "", "", fmt.Errorf(`lines should be a single line or range like "10-42", not %q`,
+				d.Attrs["lines"])
+		}
+
+		r := ranges[0]
+		if r.end > len(fileLines) {
+			return "", "", fmt.Errorf("lines %q are beyond the end of %q, which has %v line(s)",
+				d.Attrs["lines"], src, len(fileLines))
+		}
+		code = fileLines[r.start-1 : r.end]
+
+	case d.Attrs["region"] != "":
+		code, err = extractRegion(fileLines, d.Attrs["region"])
+		if err != nil {
+			return "", "", fmt.Errorf("couldn't extract from %q: %v", src, err)
+		}
+
+	default:
+		code = fileLines
+	}
+
+	if dedent {
+		code = dedentCommon(code)
+	}
+
+	return renderCode(info, strings.Join(code, "\n")+"\n"), "", nil
+}
+
+// Finds the lines between the start and end markers of a named region.
+func extractRegion(lines []string, name string) ([]string, error) {
+	start := -1
+	for i, line := range lines {
+		matches := regionMarkerRE.FindStringSubmatch(line)
+		if matches == nil || matches[2] != name {
+			continue
+		}
+
+		switch {
+		case matches[1] == "" && start == -1:
+			start = i + 1
+		case matches[1] == "":
+			return nil, fmt.Errorf("region %q is started more than once", name)
+		case start == -1:
+			return nil, fmt.Errorf("region %q is ended before it's started", name)
+		default:
+			return lines[start:i], nil
+		}
+	}
+
+	if start == -1 {
+		return nil, fmt.Errorf("region %q doesn't exist", name)
+	}
+	return nil, fmt.Errorf("region %q is never ended", name)
+}
+
+// Removes whitespace that's common to the start of every non-empty line so
+// that excerpts from deep within a file aren't needlessly indented.
+func dedentCommon(lines []string) []string {
+	var prefix string
+	first := true
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			prefix = indent
+			first = false
+			continue
+		}
+
+		for !strings.HasPrefix(indent, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	dedented := make([]string, len(lines))
+	for i, line := range lines {
+		dedented[i] = strings.TrimPrefix(line, prefix)
+	}
+	return dedented
+}
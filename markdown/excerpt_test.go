@@ -0,0 +1,155 @@
+package markdown
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+const excerptSource = `package main
+
+func main() {
+	// region: body
+	x := 1
+	if x > 0 {
+		println(x)
+	}
+	// endregion: body
+}
+`
+
+func TestRenderCodeExcerpts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "excerpts")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "examples"), 0755)
+	assert.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "examples", "main.go"),
+		[]byte(excerptSource), 0644)
+	assert.NoError(t, err)
+
+	options := &RenderOptions{CodeDir: dir}
+
+	// Each excerpt renders the same as a code block containing exactly the
+	// same lines, including any region markers in a range of lines
+	assertRendersLike(t,
+		"Text.\n\n```go {file=\"examples/main.go\"}\nfunc main() {\n\t// region: body\n\tx := 1\n```\n\nMore.",
+		"Text.\n\n!code src=\"examples/main.go\" lines=\"3-5\"\n\nMore.", options)
+
+	// Regions don't include their own markers
+	assertRendersLike(t,
+		"```go {file=\"examples/main.go\"}\n\tx := 1\n\tif x > 0 {\n\t\tprintln(x)\n\t}\n```",
+		`!code src="examples/main.go" region="body"`, options)
+
+	// Dedenting is opt-in
+	assertRendersLike(t,
+		"```go {file=\"examples/main.go\"}\nx := 1\nif x > 0 {\n\tprintln(x)\n}\n```",
+		`!code src="examples/main.go" region="body" dedent="true"`, options)
+
+	// Lines can be highlighted and numbered like in any code block
+	assertRendersLike(t,
+		"```go {file=\"examples/main.go\" hl=\"2-3\" lines=true}\n\tx := 1\n\tif x > 0 {\n\t\tprintln(x)\n\t}\n```",
+		`!code src="examples/main.go" region="body" hl="2-3" numbers="true"`, options)
+
+	// The language can be overridden
+	assertRendersLike(t,
+		"```text {file=\"examples/main.go\"}\npackage main\n```",
+		`!code src="examples/main.go" lines="1" lang="text"`, options)
+
+	// Directives in code blocks are left alone
+	rendered, err := Render("```\n!code src=\"examples/missing.go\"\n```", options)
+	assert.NoError(t, err)
+	assert.Equal(t, "<pre><code>!code src=&quot;examples/missing.go&quot;\n</code></pre>\n", rendered)
+
+	// An excerpt doesn't shift the lines of anything after it
+	_, err = Render("!code src=\"examples/main.go\" region=\"body\"\n\n```go {bogus=1}\n```", options)
+	assert.Equal(t, `line 3: Unknown code block option "bogus" (known options are file, hl, and lines)`,
+		err.Error())
+
+	_, err = Render("Text.\n\n!code src=\"examples/missing.go\"", options)
+	assert.Contains(t, err.Error(), `line 3: Directive !code: couldn't read "examples/missing.go"`)
+
+	_, err = Render(`!code src="examples/main.go" region="nope"`, options)
+	assert.Equal(t,
+		`line 1: Directive !code: couldn't extract from "examples/main.go": region "nope" doesn't exist`,
+		err.Error())
+
+	_, err = Render(`!code src="examples/main.go" lines="8-20"`, options)
+	assert.Equal(t,
+		`line 1: Directive !code: lines "8-20" are beyond the end of "examples/main.go", which has 10 line(s)`,
+		err.Error())
+
+	_, err = Render(`!code src="examples/main.go" lines="3" region="body"`, options)
+	assert.Equal(t, `line 1: Directive !code: takes either lines or region, but not both`, err.Error())
+
+	_, err = Render(`!code src="examples/main.go" hl="3-1"`, options)
+	assert.Equal(t,
+		`line 1: Directive !code: Code block option "hl" is invalid: "3-1" isn't a line or range of lines`,
+		err.Error())
+
+	_, err = Render(`!code src="examples/main.go" numbers="yes"`, options)
+	assert.Equal(t,
+		`line 1: Directive !code: Code block option "numbers" should be true or false, not "yes"`,
+		err.Error())
+
+	_, err = Render(`!code src="examples/main.go" dedent="yes"`, options)
+	assert.Equal(t, `line 1: Directive !code: dedent should be "true" or "false", not "yes"`, err.Error())
+
+	_, err = Render(`!code src="../main.go"`, options)
+	assert.Equal(t,
+		`line 1: Directive !code: src "../main.go" should be a relative path within the repository`,
+		err.Error())
+
+	_, err = Render(`!code src="examples/main.go" color="red"`, options)
+	assert.Equal(t,
+		`line 1: Unknown attribute "color" for directive !code (known attributes are dedent, hl, lang, lines, numbers, region, src)`,
+		err.Error())
+
+	_, err = Render(`!code lines="1"`, options)
+	assert.Equal(t, `line 1: Directive !code is missing required attribute "src"`, err.Error())
+}
+
+func TestRenderCodeExcerpt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "excerpts")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(excerptSource), 0644)
+	assert.NoError(t, err)
+
+	// Excerpts are rendered like any other code block
+	rendered, err := Render(`!code src="main.go" lines="1"`, &RenderOptions{CodeDir: dir})
+	assert.NoError(t, err)
+	assert.Equal(t, `<div class="code-block"><div class="code-file">main.go</div>`+
+		`<pre class="highlight"><code class="language-go"><span class="k">package</span> main
+</code></pre></div>
+`, rendered)
+}
+
+func TestDedentCommon(t *testing.T) {
+	assert.Equal(t,
+		[]string{"a", "", "\tb", "c"},
+		dedentCommon([]string{"\t\ta", "", "\t\t\tb", "\t\tc"}))
+
+	assert.Equal(t,
+		[]string{"a", " b"},
+		dedentCommon([]string{"a", " b"}))
+}
+
+//
+// Helpers
+//
+
+func assertRendersLike(t *testing.T, expected, source string, options *RenderOptions) {
+	expectedRendered, err := Render(expected, options)
+	assert.NoError(t, err)
+
+	rendered, err := Render(source, options)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedRendered, rendered, source)
+}
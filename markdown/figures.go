@@ -0,0 +1,265 @@
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"image"
+	_ "image/gif"  // registers GIF with image.DecodeConfig
+	_ "image/jpeg" // registers JPEG with image.DecodeConfig
+	_ "image/png"  // registers PNG with image.DecodeConfig
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Separates the images of a gallery in a figure's src and alt attributes.
+const figureGallerySeparator = "|"
+
+// Prefixes the name of a figure to form its ID, so that a figure named
+// "architecture" can be linked to with "#fig:architecture".
+const figureIDPrefix = "fig:"
+
+const figureHTML = `<figure%s>
+  <p>%s</p>
+  <figcaption>%s</figcaption>
+</figure>`
+
+const figureImageHTML = `<a href="%s"><img src="%s" alt="%s"%s%s></a>`
+
+// Matches a valid figure name.
+var figureNameRE = regexp.MustCompile(`^[a-z0-9][a-z0-9\-_]*$`)
+
+// Matches links to figures in Markdown source, capturing the link's text and
+// the figure's name.
+var figureReferenceRE = regexp.MustCompile(`\[([^\]]*)\]\(#` + figureIDPrefix + `([^)\s]*)\)`)
+
+// Matches the width, height, or viewBox of an SVG's root element.
+var svgTagRE = regexp.MustCompile(`(?s)<svg\s[^>]*>`)
+var svgDimensionRE = regexp.MustCompile(`\s(width|height)="([0-9.]+)(?:px)?"`)
+var svgViewBoxRE = regexp.MustCompile(`\sviewBox="[0-9.\-]+[\s,]+[0-9.\-]+[\s,]+([0-9.]+)[\s,]+([0-9.]+)"`)
+
+// Renders a figure of one image, or a gallery of several when src contains a
+// list separated by pipes. Figures are numbered in the order they appear, and
+// those with a name get an ID that can be linked to.
+func renderFigure(d *Directive, options *RenderOptions) (string, string, error) {
+	sources := splitFigureList(d.Attrs["src"])
+	for _, src := range sources {
+		if src == "" {
+			return "", "", fmt.Errorf("src contains an empty image")
+		}
+	}
+
+	alts := make([]string, len(sources))
+	if alt, ok := d.Attrs["alt"]; ok {
+		alts = splitFigureList(alt)
+		if len(alts) != len(sources) {
+			return "", "", fmt.Errorf("alt has %v values, but src has %v images",
+				len(alts), len(sources))
+		}
+	}
+
+	var images []string
+	for i, src := range sources {
+		img, err := renderFigureImage(src, alts[i], len(sources) == 1, options)
+		if err != nil {
+			return "", "", err
+		}
+		images = append(images, img)
+	}
+
+	var attrs string
+	if name, ok := d.Attrs["name"]; ok {
+		if !figureNameRE.MatchString(name) {
+			return "", "", fmt.Errorf("name should be lowercase letters, numbers, dashes, "+
+				"and underscores, but was %q", name)
+		}
+		attrs += fmt.Sprintf(` id="%s"`, figureIDPrefix+name)
+	}
+
+	content := images[0]
+	if len(images) > 1 {
+		attrs += ` class="gallery"`
+		content = "\n    " + strings.Join(images, "\n    ") + "\n  "
+	}
+
+	caption := fmt.Sprintf(`<span class="figure-number">Figure %v</span>`, d.Index)
+	if d.Attrs["caption"] != "" {
+		caption = fmt.Sprintf(`<span class="figure-number">Figure %v:</span> %s`,
+			d.Index, renderInline(d.Attrs["caption"], options))
+	}
+
+	return fmt.Sprintf(figureHTML, attrs, content, caption), "", nil
+}
+
+// Renders a single image of a figure along with a link to its full size
+// version.
+func renderFigureImage(src, alt string, overflowing bool, options *RenderOptions) (string, error) {
+	// Links go to the "@2x" version of the image, unless it's known not to
+	// exist.
+	link := src
+	if variant := highDPIVariant(src); variant != "" {
+		link = variant
+	}
+
+	var dimensions string
+	if variants := imageVariants(src, options); variants != nil {
+		link = src
+		for _, variant := range variants {
+			switch variant.Density {
+			case 1:
+				dimensions = fmt.Sprintf(` width="%v" height="%v"`, variant.Width, variant.Height)
+			case 2:
+				link = variant.URL
+			}
+		}
+	} else if path, ok := localImagePath(src, options); ok {
+		width, height, err := imageDimensions(path)
+		if err != nil {
+			return "", err
+		}
+		dimensions = fmt.Sprintf(` width="%v" height="%v"`, width, height)
+
+		if variantPath, ok := localImagePath(link, options); ok {
+			if _, err := os.Stat(variantPath); err != nil {
+				link = src
+			}
+		}
+	}
+
+	var class string
+	if overflowing {
+		class = ` class="overflowing"`
+	}
+
+	return fmt.Sprintf(figureImageHTML, html.EscapeString(link), html.EscapeString(src),
+		html.EscapeString(alt), dimensions, class), nil
+}
+
+// Reads the intrinsic width and height of an image. PNG, JPEG, and GIF are
+// read from their headers, and SVG from the dimensions or view box of its
+// root element.
+func imageDimensions(path string) (int, int, error) {
+	if filepath.Ext(path) == ".svg" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return 0, 0, err
+		}
+		return svgDimensions(path, data)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Couldn't read dimensions of %v: %v", path, err)
+	}
+
+	return config.Width, config.Height, nil
+}
+
+// Resolves references to figures like `[see](#fig:architecture)`. A
+// reference to a figure that doesn't exist is an error, and a reference
+// without any text gets the figure's number like "Figure 2".
+//
+// References are checked in the original source so that errors have accurate
+// line numbers, and rewritten in the expanded one.
+func resolveFigureReferences(source, expanded []string, figures []*Directive) ([]string, error) {
+	numbers := make(map[string]int)
+	for _, figure := range figures {
+		name, ok := figure.Attrs["name"]
+		if !ok {
+			continue
+		}
+
+		if _, ok := numbers[name]; ok {
+			return nil, &Error{Line: figure.Line, Message: fmt.Sprintf(
+				"Figure name %q is used more than once", name)}
+		}
+		numbers[name] = figure.Index
+	}
+
+	var err error
+	eachProseLine(source, func(i int) {
+		if err != nil {
+			return
+		}
+
+		for _, matches := range figureReferenceRE.FindAllStringSubmatch(source[i], -1) {
+			if _, ok := numbers[matches[2]]; !ok {
+				err = &Error{Line: i + 1, Message: fmt.Sprintf(
+					"Reference to unknown figure %q", matches[2])}
+				return
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	eachProseLine(expanded, func(i int) {
+		expanded[i] = figureReferenceRE.ReplaceAllStringFunc(expanded[i], func(link string) string {
+			matches := figureReferenceRE.FindStringSubmatch(link)
+			if matches[1] != "" {
+				return link
+			}
+			return fmt.Sprintf("[Figure %v](#%s%s)", numbers[matches[2]], figureIDPrefix, matches[2])
+		})
+	})
+
+	return expanded, nil
+}
+
+// Calls fn with the index of every line that's outside of a code block or a
+// raw HTML block.
+func eachProseLine(lines []string, fn func(i int)) {
+	for i, literal := range literalLines(lines) {
+		if !literal {
+			fn(i)
+		}
+	}
+}
+
+// Splits a list of values given to a figure for a gallery.
+func splitFigureList(s string) []string {
+	values := strings.Split(s, figureGallerySeparator)
+	for i, value := range values {
+		values[i] = strings.TrimSpace(value)
+	}
+	return values
+}
+
+func svgDimensions(path string, data []byte) (int, int, error) {
+	tag := svgTagRE.Find(data)
+	if tag == nil {
+		return 0, 0, fmt.Errorf("Couldn't find an <svg> element in %v", path)
+	}
+
+	dimensions := make(map[string]float64)
+	for _, matches := range svgDimensionRE.FindAllSubmatch(tag, -1) {
+		value, err := strconv.ParseFloat(string(matches[2]), 64)
+		if err == nil {
+			dimensions[string(matches[1])] = value
+		}
+	}
+
+	if _, ok := dimensions["width"]; !ok {
+		if matches := svgViewBoxRE.FindSubmatch(tag); matches != nil {
+			dimensions["width"], _ = strconv.ParseFloat(string(matches[1]), 64)
+			dimensions["height"], _ = strconv.ParseFloat(string(matches[2]), 64)
+		}
+	}
+
+	width, height := dimensions["width"], dimensions["height"]
+	if width == 0 || height == 0 {
+		return 0, 0, fmt.Errorf("Couldn't find the width and height of %v", path)
+	}
+
+	return int(width + 0.5), int(height + 0.5), nil
+}
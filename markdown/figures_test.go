@@ -0,0 +1,153 @@
+package markdown
+
+import (
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestRenderFigure(t *testing.T) {
+	var rendered string
+	var err error
+
+	rendered, err = Render(`!fig src="fig-src" caption="fig-caption"`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `<figure>
+  <p><a href="fig-src"><img src="fig-src" alt="" class="overflowing"></a></p>
+  <figcaption><span class="figure-number">Figure 1:</span> fig-caption</figcaption>
+</figure>
+`, rendered)
+
+	// .png links to "@2x" version of the source
+	rendered, err = Render(`!fig src="fig-src.png" alt="A figure." caption="fig-caption"`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `<figure>
+  <p><a href="fig-src@2x.png"><img src="fig-src.png" alt="A figure." class="overflowing"></a></p>
+  <figcaption><span class="figure-number">Figure 1:</span> fig-caption</figcaption>
+</figure>
+`, rendered)
+
+	// .svg doesn't link to "@2x"
+	rendered, err = Render(`!fig src="fig-src.svg"`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `<figure>
+  <p><a href="fig-src.svg"><img src="fig-src.svg" alt="" class="overflowing"></a></p>
+  <figcaption><span class="figure-number">Figure 1</span></figcaption>
+</figure>
+`, rendered)
+
+	// Captions are Markdown
+	rendered, err = Render(`!fig src="fig-src" caption="A *\"quoted\"* [link](/a)."`, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, rendered,
+		`<figcaption><span class="figure-number">Figure 1:</span> A <em>&ldquo;quoted&rdquo;</em> <a href="/a">link</a>.</figcaption>`)
+}
+
+func TestRenderFigureGallery(t *testing.T) {
+	rendered, err := Render(`!fig src="a.png | b.svg" alt="First. | Second." name="pair"`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `<figure id="fig:pair" class="gallery">
+  <p>
+    <a href="a@2x.png"><img src="a.png" alt="First."></a>
+    <a href="b.svg"><img src="b.svg" alt="Second."></a>
+  </p>
+  <figcaption><span class="figure-number">Figure 1</span></figcaption>
+</figure>
+`, rendered)
+
+	_, err = Render(`!fig src="a.png | b.png" alt="Only one."`, nil)
+	assert.Equal(t, `line 1: Directive !fig: alt has 1 values, but src has 2 images`, err.Error())
+
+	_, err = Render(`!fig src="a.png | "`, nil)
+	assert.Equal(t, `line 1: Directive !fig: src contains an empty image`, err.Error())
+}
+
+func TestRenderFigureDimensions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "figures")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file, err := os.Create(filepath.Join(dir, "fig.png"))
+	assert.NoError(t, err)
+	assert.NoError(t, png.Encode(file, image.NewRGBA(image.Rect(0, 0, 40, 30))))
+	assert.NoError(t, file.Close())
+
+	err = ioutil.WriteFile(filepath.Join(dir, "fig.svg"),
+		[]byte(`<?xml version="1.0"?>`+"\n"+`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 120.4 60">`), 0644)
+	assert.NoError(t, err)
+
+	options := &RenderOptions{ImageDir: dir, ImageURL: "/assets/"}
+
+	rendered, err := Render(`!fig src="/assets/fig.png"`, options)
+	assert.NoError(t, err)
+	assert.Contains(t, rendered, `<img src="/assets/fig.png" alt="" width="40" height="30" class="overflowing">`)
+
+	rendered, err = Render(`!fig src="/assets/fig.svg"`, options)
+	assert.NoError(t, err)
+	assert.Contains(t, rendered, `<img src="/assets/fig.svg" alt="" width="120" height="60" class="overflowing">`)
+
+	// Links only go to an "@2x" version that exists, and it's given as a
+	// srcset when it does
+	assert.Contains(t, rendered, `<a href="/assets/fig.svg">`)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "fig@2x.png"), nil, 0644))
+
+	rendered, err = Render(`!fig src="/assets/fig.png"`, options)
+	assert.NoError(t, err)
+	assert.Contains(t, rendered, `<a href="/assets/fig@2x.png"><img src="/assets/fig.png" `+
+		`srcset="/assets/fig.png 1x, /assets/fig@2x.png 2x" alt="" width="40" height="30" class="overflowing"></a>`)
+
+	assert.NoError(t, os.Remove(filepath.Join(dir, "fig@2x.png")))
+	rendered, err = Render(`!fig src="/assets/fig.png"`, options)
+	assert.NoError(t, err)
+	assert.Contains(t, rendered, `<a href="/assets/fig.png"><img src="/assets/fig.png" alt=""`)
+
+	// Images from elsewhere aren't read
+	rendered, err = Render(`!fig src="https://example.com/fig.png"`, options)
+	assert.NoError(t, err)
+	assert.Contains(t, rendered, `<img src="https://example.com/fig.png" alt="" class="overflowing">`)
+
+	_, err = Render("Text.\n\n!fig src=\"/assets/missing.png\"", options)
+	assert.Contains(t, err.Error(), "line 3: Directive !fig: open ")
+	assert.Contains(t, err.Error(), "missing.png: no such file or directory")
+}
+
+func TestRenderFigureReferences(t *testing.T) {
+	rendered, err := Render(`As shown in [](#fig:second) and [the first](#fig:first).
+
+!fig src="a.svg" name="first"
+
+!fig src="b.svg" caption="Second." name="second"
+
+`+"```\n[](#fig:code)\n```", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `<p>As shown in <a href="#fig:second">Figure 2</a> and <a href="#fig:first">the first</a>.</p>
+
+<figure id="fig:first">
+  <p><a href="a.svg"><img src="a.svg" alt="" class="overflowing"></a></p>
+  <figcaption><span class="figure-number">Figure 1</span></figcaption>
+</figure>
+
+<figure id="fig:second">
+  <p><a href="b.svg"><img src="b.svg" alt="" class="overflowing"></a></p>
+  <figcaption><span class="figure-number">Figure 2:</span> Second.</figcaption>
+</figure>
+
+<pre><code>[](#fig:code)
+</code></pre>
+`, rendered)
+
+	_, err = Render("!fig src=\"a.svg\" name=\"first\"\n\nSee [](#fig:frist).", nil)
+	assert.Equal(t, `line 3: Reference to unknown figure "frist"`, err.Error())
+
+	_, err = Render("!fig src=\"a.svg\" name=\"first\"\n\n!fig src=\"b.svg\" name=\"first\"", nil)
+	assert.Equal(t, `line 3: Figure name "first" is used more than once`, err.Error())
+
+	_, err = Render(`!fig src="a.svg" name="First Figure"`, nil)
+	assert.Equal(t, `line 1: Directive !fig: name should be lowercase letters, numbers, `+
+		`dashes, and underscores, but was "First Figure"`, err.Error())
+}
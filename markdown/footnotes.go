@@ -0,0 +1,316 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/russross/blackfriday"
+)
+
+// A layer that we wrap the entire footer section in for styling purposes.
+const footerWrapper = `
+<div id="footnotes">
+  %s
+</div>
+`
+
+// HTML for a footnote within the document. Its anchor links back to the first
+// reference to the footnote.
+const footnoteAnchorHTML = `
+<sup id="footnote-%v">
+  <a href="#%s">%v</a>
+</sup>
+`
+
+// HTML for a footnote within the document that's referenced more than once.
+// Instead of a single link back, there's one for each reference.
+const footnoteAnchorMultipleHTML = `<sup id="footnote-%v">%v %s</sup>`
+
+// HTML for a single backlink from a footnote that's referenced more than
+// once.
+const footnoteBacklinkHTML = `<a href="#%s">%s</a>`
+
+// HTML for a reference to a footnote within the document.
+const footnoteReferenceHTML = `
+<sup id="%s">
+  <a href="#footnote-%v">%v</a>
+</sup>
+`
+
+// Matches the first line of a footnote definition like:
+//
+//	[^label]: The footnote's content.
+var footnoteDefinitionRE = regexp.MustCompile(`^\[\^([^\]\s]+)\]:[ \t]*(.*)$`)
+
+// Matches a reference to a footnote like "[^label]".
+var footnoteReferenceRE = regexp.MustCompile(`\[\^([^\]\s]+)\]`)
+
+// footnote is a footnote definition extracted from a document.
+type footnote struct {
+	// content is the Markdown content of the footnote with any indentation on
+	// continuation lines removed.
+	content string
+
+	// label is the footnote's name as it appears in the source (e.g. "note"
+	// for "[^note]").
+	label string
+
+	// line is the line in the source on which the footnote was defined.
+	line int
+
+	// number is the footnote's number in the rendered document. It's
+	// assigned in order of first reference, and is 0 for footnotes that are
+	// never referenced.
+	number int
+
+	// references are the IDs of every reference to the footnote in the
+	// order in which they appear.
+	references []string
+}
+
+// Pulls footnote definitions out of Markdown source. Definitions start with a
+// line like "[^label]: content" and may continue onto subsequent lines.
+// Paragraphs after the first must be indented by four spaces or a tab.
+//
+// Definitions are replaced by empty lines so that the line numbers of the
+// remaining content are unchanged. Fenced code blocks are left alone.
+func extractFootnotes(source string) (string, []*footnote, error) {
+	lines := strings.Split(source, "\n")
+
+	var footnotes []*footnote
+	seen := make(map[string]*footnote)
+
+	for i := 0; i < len(lines); i++ {
+		if matches := codeFenceRE.FindStringSubmatch(lines[i]); matches != nil {
+			i = findClosingFence(lines, i+1, matches[2])
+			continue
+		}
+
+		matches := footnoteDefinitionRE.FindStringSubmatch(lines[i])
+		if matches == nil {
+			continue
+		}
+
+		note := &footnote{label: matches[1], line: i + 1}
+		if prev, ok := seen[note.label]; ok {
+			return "", nil, &Error{Line: note.line,
+				Message: fmt.Sprintf("Footnote [^%v] was already defined on line %v",
+					note.label, prev.line)}
+		}
+		seen[note.label] = note
+		footnotes = append(footnotes, note)
+
+		content := []string{matches[2]}
+		lines[i] = ""
+
+		for i+1 < len(lines) {
+			next := lines[i+1]
+
+			if strings.TrimSpace(next) == "" {
+				// A blank line only continues the footnote if the next line
+				// with content is indented.
+				j := i + 1
+				for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+					j++
+				}
+				if j == len(lines) || !isIndented(lines[j]) {
+					break
+				}
+			} else if !isIndented(next) {
+				// Unindented lines are a lazy continuation of the current
+				// paragraph, unless the previous line ended it, or the line
+				// starts something else.
+				last := content[len(content)-1]
+				if strings.TrimSpace(last) == "" ||
+					footnoteDefinitionRE.MatchString(next) ||
+					strings.HasPrefix(next, "#") {
+					break
+				}
+			}
+
+			content = append(content, dedent(next))
+			lines[i+1] = ""
+			i++
+		}
+
+		note.content = strings.Join(content, "\n")
+	}
+
+	return strings.Join(lines, "\n"), footnotes, nil
+}
+
+// Replaces references to footnotes in the text of the given document with
+// HTML links to the footnote. Footnotes are numbered in the order that
+// they're first referenced.
+//
+// Only text nodes are considered, so references inside code spans or code
+// blocks are left alone. An error is returned for references to footnotes
+// that aren't defined, which points to the first one in source.
+func transformFootnoteReferences(doc *blackfriday.Node, source string, footnotes []*footnote) error {
+	byLabel := make(map[string]*footnote)
+	for _, note := range footnotes {
+		byLabel[note.label] = note
+	}
+
+	number := 0
+
+	var err error
+	doc.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if node.Type != blackfriday.Text || !entering {
+			return blackfriday.GoToNext
+		}
+
+		text := node.Literal
+		locs := footnoteReferenceRE.FindAllSubmatchIndex(text, -1)
+		if locs == nil {
+			return blackfriday.GoToNext
+		}
+
+		// Every reference found splits the text node in two with an HTML
+		// span for the reference in between. Text up to each reference is
+		// inserted before the original node, which is left holding whatever
+		// comes after the last one.
+		start := 0
+		for _, loc := range locs {
+			label := string(text[loc[2]:loc[3]])
+
+			note, ok := byLabel[label]
+			if !ok {
+				err = &Error{Line: findFootnoteReference(source, label), Message: fmt.Sprintf(
+					"Footnote [^%v] is referenced but never defined", label)}
+				return blackfriday.Terminate
+			}
+
+			if note.number == 0 {
+				number++
+				note.number = number
+			}
+
+			id := fmt.Sprintf("footnote-%v-source", note.number)
+			if len(note.references) > 0 {
+				id = fmt.Sprintf("%s-%v", id, len(note.references)+1)
+			}
+			note.references = append(note.references, id)
+
+			before := blackfriday.NewNode(blackfriday.Text)
+			before.Literal = text[start:loc[0]]
+			node.InsertBefore(before)
+
+			reference := blackfriday.NewNode(blackfriday.HTMLSpan)
+			reference.Literal = []byte(collapseHTML(
+				fmt.Sprintf(footnoteReferenceHTML, id, note.number, note.number)))
+			node.InsertBefore(reference)
+
+			start = loc[1]
+		}
+		node.Literal = text[start:]
+
+		return blackfriday.GoToNext
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, note := range footnotes {
+		if note.number == 0 {
+			return &Error{Line: note.line, Message: fmt.Sprintf(
+				"Footnote [^%v] is defined but never referenced", note.label)}
+		}
+	}
+
+	return nil
+}
+
+// Gets the line of the first reference to the footnote with the given label
+// outside of code, or 0 if there isn't one.
+func findFootnoteReference(source, label string) int {
+	reference := "[^" + label + "]"
+	line := 0
+
+	lines := strings.Split(source, "\n")
+	eachProseLine(lines, func(i int) {
+		if line != 0 {
+			return
+		}
+
+		// Errors are never returned by the function given, so one is never
+		// returned here either.
+		_, _ = replaceOutsideCode(lines[i], func(s string) (string, error) {
+			if line == 0 && strings.Contains(s, reference) {
+				line = i + 1
+			}
+			return s, nil
+		})
+	})
+
+	return line
+}
+
+// Renders the section that goes at the bottom of the page containing all
+// referenced footnotes in order of their number.
+func renderFootnotes(footnotes []*footnote, options *RenderOptions) (string, error) {
+	if len(footnotes) < 1 {
+		return "", nil
+	}
+
+	ordered := make([]*footnote, len(footnotes))
+	for _, note := range footnotes {
+		ordered[note.number-1] = note
+	}
+
+	var b bytes.Buffer
+	for _, note := range ordered {
+		var anchor string
+		if len(note.references) == 1 {
+			anchor = collapseHTML(fmt.Sprintf(footnoteAnchorHTML,
+				note.number, note.references[0], note.number))
+		} else {
+			var backlinks []string
+			for i, reference := range note.references {
+				backlinks = append(backlinks, fmt.Sprintf(footnoteBacklinkHTML,
+					reference, string(rune('a'+i%26))))
+			}
+			anchor = fmt.Sprintf(footnoteAnchorMultipleHTML,
+				note.number, note.number, strings.Join(backlinks, " "))
+		}
+
+		if footnoteReferenceRE.MatchString(note.content) {
+			return "", &Error{Line: note.line, Message: fmt.Sprintf(
+				"Footnote [^%v] contains a reference to another footnote, which isn't supported",
+				note.label)}
+		}
+
+		content := renderAST(parseMarkdown(note.content), options)
+
+		// Place the anchor at the start of the footnote's first paragraph if
+		// it has one, or in a paragraph of its own if it doesn't.
+		if strings.HasPrefix(content, "<p>") {
+			content = "<p>" + anchor + " " + content[len("<p>"):]
+		} else {
+			content = "<p>" + anchor + "</p>\n" + content
+		}
+
+		b.WriteString(content)
+		b.WriteString("\n")
+	}
+
+	return fmt.Sprintf(footerWrapper, b.String()), nil
+}
+
+// Removes one level of indentation (four spaces or a tab) from a line.
+func dedent(line string) string {
+	if strings.HasPrefix(line, "\t") {
+		return line[1:]
+	}
+	if strings.HasPrefix(line, "    ") {
+		return line[4:]
+	}
+	return line
+}
+
+// Checks whether a line is indented by at least four spaces or a tab.
+func isIndented(line string) bool {
+	return strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "    ")
+}
@@ -0,0 +1,137 @@
+package markdown
+
+import (
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestExtractFootnotes(t *testing.T) {
+	source, footnotes, err := extractFootnotes(`Text [^a] and [^b].
+
+[^a]: Footnote a
+continued lazily.
+
+[^b]: Footnote b.
+
+    Second paragraph of b.
+
+` + "```" + `
+[^c]: Not a footnote because it's in code.
+` + "```" + `
+`)
+	assert.NoError(t, err)
+
+	// Definitions are replaced by empty lines so line numbers are preserved.
+	assert.Equal(t, `Text [^a] and [^b].
+
+
+
+
+
+
+
+
+`+"```"+`
+[^c]: Not a footnote because it's in code.
+`+"```"+`
+`, source)
+
+	assert.Equal(t, 2, len(footnotes))
+
+	assert.Equal(t, "a", footnotes[0].label)
+	assert.Equal(t, "Footnote a\ncontinued lazily.", footnotes[0].content)
+	assert.Equal(t, 3, footnotes[0].line)
+
+	assert.Equal(t, "b", footnotes[1].label)
+	assert.Equal(t, "Footnote b.\n\nSecond paragraph of b.", footnotes[1].content)
+	assert.Equal(t, 6, footnotes[1].line)
+
+	_, _, err = extractFootnotes("[^a]: One.\n\n[^a]: Two.")
+	assert.Equal(t, "line 3: Footnote [^a] was already defined on line 1", err.Error())
+
+	// A fence only closes on a line of at least as many of the same
+	// character, so shorter fences inside longer ones don't end the block.
+	code := "````\n```\n[^c]: Still code.\n```\n````\n~~~\n[^d]: Also code.\n~~~~\n"
+	source, footnotes, err = extractFootnotes(code)
+	assert.NoError(t, err)
+	assert.Equal(t, code, source)
+	assert.Equal(t, 0, len(footnotes))
+}
+
+func TestRenderMarkdownFootnotes(t *testing.T) {
+	rendered, err := renderMarkdown(`This is a reference [^one] to a footnote [^two].
+
+[^one]: Footnote one.
+
+[^two]: Footnote two.
+`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `<p>This is a reference <sup id="footnote-1-source"><a href="#footnote-1">1</a></sup> to a footnote <sup id="footnote-2-source"><a href="#footnote-2">2</a></sup>.</p>
+
+<div id="footnotes">
+  <p><sup id="footnote-1"><a href="#footnote-1-source">1</a></sup> Footnote one.</p>
+
+<p><sup id="footnote-2"><a href="#footnote-2-source">2</a></sup> Footnote two.</p>
+
+
+</div>
+`, rendered)
+}
+
+func TestRenderMarkdownFootnotesNumbering(t *testing.T) {
+	// Footnotes are numbered in order of first reference rather than
+	// definition, and multiple references produce multiple backlinks.
+	rendered, err := renderMarkdown(`First [^later], second [^earlier], third [^later].
+
+[^earlier]: Defined first.
+
+[^later]: Defined second.
+
+    With a second paragraph.
+`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `<p>First <sup id="footnote-1-source"><a href="#footnote-1">1</a></sup>, second <sup id="footnote-2-source"><a href="#footnote-2">2</a></sup>, third <sup id="footnote-1-source-2"><a href="#footnote-1">1</a></sup>.</p>
+
+<div id="footnotes">
+  <p><sup id="footnote-1">1 <a href="#footnote-1-source">a</a> <a href="#footnote-1-source-2">b</a></sup> Defined second.</p>
+
+<p>With a second paragraph.</p>
+
+<p><sup id="footnote-2"><a href="#footnote-2-source">2</a></sup> Defined first.</p>
+
+
+</div>
+`, rendered)
+}
+
+func TestRenderMarkdownFootnotesInCode(t *testing.T) {
+	// Brackets in code aren't confused for footnote references.
+	rendered, err := renderMarkdown("Index `arr[1]` and `[^x]`.\n\n"+
+		"```\nx := arr[1]\ny := \"[^x]\"\n```\n", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `<p>Index <code>arr[1]</code> and <code>[^x]</code>.</p>
+
+<pre><code>x := arr[1]
+y := &quot;[^x]&quot;
+</code></pre>
+`, rendered)
+}
+
+func TestRenderMarkdownFootnotesErrors(t *testing.T) {
+	var err error
+
+	_, err = renderMarkdown("Reference [^missing].", nil)
+	assert.Equal(t, "line 1: Footnote [^missing] is referenced but never defined", err.Error())
+
+	// The line is that of the first reference outside of code.
+	_, err = renderMarkdown("Code `[^missing]`.\n\n```\n[^missing]\n```\n\n"+
+		"Reference [^missing] and [^missing].\n\nAgain [^missing].", nil)
+	assert.Equal(t, "line 7: Footnote [^missing] is referenced but never defined", err.Error())
+
+	_, err = renderMarkdown("No references.\n\n[^unused]: Unused.", nil)
+	assert.Equal(t, "line 3: Footnote [^unused] is defined but never referenced", err.Error())
+
+	_, err = renderMarkdown("Reference [^a].\n\n[^a]: Nested [^a].", nil)
+	assert.Equal(t, "line 3: Footnote [^a] contains a reference to another footnote, which isn't supported", err.Error())
+}
@@ -0,0 +1,425 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/russross/blackfriday"
+)
+
+// Header is a header in a document.
+type Header struct {
+	// ID is the header's ID, which is used as its permalink.
+	ID string
+
+	// Level is the header's level, from 1 for h1 to 6 for h6.
+	Level int
+
+	// Text is the header's text with any markup removed.
+	Text string
+}
+
+// LinkTarget is an article that others can link to with a wiki link like
+// [[slug#header-id]] or a link like [text](article:slug#header-id).
+type LinkTarget struct {
+	// Headers maps the IDs of the article's headers to their text. Links to
+	// headers that aren't in it are an error.
+	//
+	// It's nil while the article's headers are still being found, in which
+	// case links to any of them are allowed and are given the article's
+	// title.
+	Headers map[string]string
+
+	// Title is the article's title, which links to it are given when they
+	// don't have text of their own.
+	Title string
+
+	// URL is where the article is published.
+	URL string
+}
+
+// Matches a wiki link like [[slug]], [[slug#header-id]], or
+// [[slug#header-id|text]], capturing its slug, header ID, and text.
+var wikiLinkRE = regexp.MustCompile(`\[\[([^\[\]|#\s]+)(?:#([^\[\]|\s]+))?(?:\|([^\[\]]+))?\]\]`)
+
+// Matches a Markdown link to an article like [text](article:slug#header-id),
+// capturing its text, slug, and header ID.
+var articleLinkRE = regexp.MustCompile(`\[([^\[\]]*)\]\(article:([^()#\s]+)(?:#([^()\s]+))?\)`)
+
+// Matches a run of whitespace.
+var spaceRE = regexp.MustCompile(`\s+`)
+
+// Escapes text so that it's taken literally when put in a Markdown link.
+var linkTextEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"`", "\\`",
+	"*", `\*`,
+	"<", `\<`,
+	"[", `\[`,
+	"]", `\]`,
+	"_", `\_`,
+	`"`, "&quot;",
+)
+
+// Link is a link in a document to somewhere outside of it.
+type Link struct {
+	// Context is an excerpt of the text around the link, like the rest of
+	// the paragraph that it's in.
+	Context string
+
+	// Header is the header of the section that the link is in, or nil if it
+	// comes before the document's first header.
+	Header *Header
+
+	// URL is where the link points.
+	URL string
+}
+
+// Node types that are inline, and so aren't what a link's context is taken
+// from when they contain it.
+var inlineContainers = map[blackfriday.NodeType]bool{
+	blackfriday.Del:    true,
+	blackfriday.Emph:   true,
+	blackfriday.Image:  true,
+	blackfriday.Link:   true,
+	blackfriday.Strong: true,
+}
+
+// Length in characters beyond which the context of a link is cut down to the
+// text around it.
+const linkContextLength = 200
+
+// Headers gets the headers of a Markdown document along with the IDs that
+// they're given when it's rendered. It uses the default pipeline.
+func Headers(source string, options *RenderOptions) ([]*Header, error) {
+	return defaultPipeline.Headers(source, options)
+}
+
+// Links gets the links in a Markdown document along with where they are in
+// it. It uses the default pipeline.
+func Links(source string, options *RenderOptions) ([]*Link, error) {
+	return defaultPipeline.Links(source, options)
+}
+
+// Headers gets the headers of a Markdown document along with the IDs that
+// they're given when it's rendered with the pipeline.
+//
+// Links between articles are resolved like they are when rendering because
+// they change the text that IDs are made from. So that the headers of every
+// article can be found before any are rendered, the link targets in options
+// can leave out their headers.
+func (p *Pipeline) Headers(source string, options *RenderOptions) ([]*Header, error) {
+	doc, err := p.parse(source, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var headers []*Header
+	doc.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if node.Type != blackfriday.Heading || !entering {
+			return blackfriday.GoToNext
+		}
+
+		headers = append(headers, newHeader(node))
+		return blackfriday.SkipChildren
+	})
+
+	return headers, nil
+}
+
+// Links gets the links in a Markdown document when it's rendered with the
+// pipeline, including those to other articles. Links within the document
+// itself like "#header-id" aren't included, and neither are links in
+// footnotes.
+func (p *Pipeline) Links(source string, options *RenderOptions) ([]*Link, error) {
+	doc, err := p.parse(source, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var header *Header
+	var links []*Link
+	doc.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if !entering {
+			return blackfriday.GoToNext
+		}
+
+		switch node.Type {
+		case blackfriday.Heading:
+			header = newHeader(node)
+
+		case blackfriday.Link:
+			if strings.HasPrefix(string(node.Destination), "#") {
+				return blackfriday.GoToNext
+			}
+
+			links = append(links, &Link{
+				Context: linkContext(node),
+				Header:  header,
+				URL:     string(node.Destination),
+			})
+		}
+		return blackfriday.GoToNext
+	})
+
+	return links, nil
+}
+
+// Runs the pipeline's pre-render transforms and parses the result into a
+// syntax tree with headers given their IDs like they are when rendering.
+func (p *Pipeline) parse(source string, options *RenderOptions) (*blackfriday.Node, error) {
+	var parseOptions RenderOptions
+	if options != nil {
+		parseOptions = *options
+	}
+	parseOptions.NoHeaderLinks = false
+
+	enabled, err := p.enabled(&parseOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err = p.runStage(PreRender, enabled, source, &parseOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err = transformCodeFences(source)
+	if err != nil {
+		return nil, err
+	}
+
+	source, _, err = extractFootnotes(source)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := parseMarkdown(source)
+	transformHeaders(doc, &parseOptions)
+	return doc, nil
+}
+
+// Gets an excerpt of the text around a link from the block that it's in. Long
+// blocks are cut down to the words around the link.
+func linkContext(link *blackfriday.Node) string {
+	block := link.Parent
+	for block.Parent != nil && inlineContainers[block.Type] {
+		block = block.Parent
+	}
+
+	var b bytes.Buffer
+	var start, end int
+	block.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		switch {
+		case node == link && entering:
+			start = b.Len()
+		case node == link:
+			end = b.Len()
+		case entering && (node.Type == blackfriday.Text || node.Type == blackfriday.Code):
+			b.Write(node.Literal)
+		case entering && node.Type == blackfriday.Hardbreak:
+			b.WriteString(" ")
+		}
+		return blackfriday.GoToNext
+	})
+
+	return excerpt(b.String(), start, end, linkContextLength)
+}
+
+// Cuts text down to about length characters around the part of it between
+// start and end, breaking at spaces. Runs of whitespace are collapsed.
+func excerpt(text string, start, end, length int) string {
+	before := []rune(strings.TrimLeft(spaceRE.ReplaceAllString(text[:start], " "), " "))
+	middle := []rune(spaceRE.ReplaceAllString(text[start:end], " "))
+	after := []rune(strings.TrimRight(spaceRE.ReplaceAllString(text[end:], " "), " "))
+
+	remaining := length - len(middle)
+	if len(before)+len(after) <= remaining {
+		return string(before) + string(middle) + string(after)
+	}
+
+	// Space is shared evenly by the text on either side of the middle, except
+	// that whatever one side doesn't need goes to the other.
+	beforeLength, afterLength := remaining/2, remaining-remaining/2
+	if len(before) < beforeLength {
+		afterLength += beforeLength - len(before)
+		beforeLength = len(before)
+	} else if len(after) < afterLength {
+		beforeLength += afterLength - len(after)
+		afterLength = len(after)
+	}
+
+	var b bytes.Buffer
+	if beforeLength < len(before) {
+		// A word that's been cut partway through is dropped.
+		cut := string(before[len(before)-beforeLength:])
+		if i := strings.Index(cut, " "); i != -1 && before[len(before)-beforeLength-1] != ' ' {
+			cut = cut[i+1:]
+		}
+		b.WriteString("…")
+		b.WriteString(cut)
+	} else {
+		b.WriteString(string(before))
+	}
+
+	b.WriteString(string(middle))
+
+	if afterLength < len(after) {
+		cut := string(after[:afterLength])
+		if i := strings.LastIndex(cut, " "); i != -1 && after[afterLength] != ' ' {
+			cut = cut[:i]
+		}
+		cut = strings.TrimRight(cut, " ")
+		b.WriteString(cut)
+		b.WriteString("…")
+	} else {
+		b.WriteString(string(after))
+	}
+
+	return b.String()
+}
+
+func newHeader(node *blackfriday.Node) *Header {
+	return &Header{
+		ID:    node.HeadingID,
+		Level: node.Level,
+		Text:  plainText(node),
+	}
+}
+
+// Resolves links to other articles against options.LinkTargets. Wiki links
+// like [[slug#header-id]] become regular Markdown links, and the URLs of
+// links like [text](article:slug#header-id) are replaced with the article's.
+// Links without any text get the title of the header or article that they
+// point to.
+//
+// Links to articles or headers that don't exist are an error. Links in code
+// and raw HTML blocks are left alone.
+func transformWikiLinks(source string, options *RenderOptions) (string, error) {
+	var targets map[string]*LinkTarget
+	if options != nil {
+		targets = options.LinkTargets
+	}
+
+	lines := strings.Split(source, "\n")
+
+	var err error
+	eachProseLine(lines, func(i int) {
+		if err != nil {
+			return
+		}
+
+		lines[i], err = replaceOutsideCode(lines[i], func(s string) (string, error) {
+			s, err := replaceLinks(s, wikiLinkRE, targets, i+1, func(matches []string) (string, string, string) {
+				return matches[1], matches[2], matches[3]
+			})
+			if err != nil {
+				return "", err
+			}
+
+			return replaceLinks(s, articleLinkRE, targets, i+1, func(matches []string) (string, string, string) {
+				return matches[2], matches[3], matches[1]
+			})
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// Replaces every link matched by re in s with a resolved Markdown link. The
+// parts function extracts the slug, header ID, and text from a match.
+func replaceLinks(s string, re *regexp.Regexp, targets map[string]*LinkTarget, line int,
+	parts func(matches []string) (string, string, string)) (string, error) {
+
+	var err error
+	replaced := re.ReplaceAllStringFunc(s, func(link string) string {
+		if err != nil {
+			return link
+		}
+
+		slug, id, text := parts(re.FindStringSubmatch(link))
+
+		var url, title string
+		url, title, err = resolveLink(targets, slug, id)
+		if err != nil {
+			err = &Error{Line: line, Message: err.Error()}
+			return link
+		}
+
+		if strings.TrimSpace(text) == "" {
+			text = linkTextEscaper.Replace(title)
+		}
+		return fmt.Sprintf("[%s](%s)", text, url)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return replaced, nil
+}
+
+// Runs fn on the parts of a line that aren't in code spans.
+func replaceOutsideCode(line string, fn func(s string) (string, error)) (string, error) {
+	var out []string
+	start := 0
+
+	for i := 0; i < len(line); i++ {
+		if line[i] != '`' {
+			continue
+		}
+
+		n := countRun(line, i, '`')
+		end := findCodeSpanEnd(line, i+n, n)
+		if end == -1 {
+			i += n - 1
+			continue
+		}
+
+		replaced, err := fn(line[start:i])
+		if err != nil {
+			return "", err
+		}
+		out = append(out, replaced, line[i:end])
+
+		start = end
+		i = end - 1
+	}
+
+	replaced, err := fn(line[start:])
+	if err != nil {
+		return "", err
+	}
+	out = append(out, replaced)
+
+	return strings.Join(out, ""), nil
+}
+
+// Gets the URL of a link to an article or one of its headers along with the
+// title of what it points to.
+func resolveLink(targets map[string]*LinkTarget, slug, id string) (string, string, error) {
+	target, ok := targets[slug]
+	if !ok {
+		return "", "", fmt.Errorf("Link to unknown article %q", slug)
+	}
+
+	if id == "" {
+		return target.URL, target.Title, nil
+	}
+
+	// The article's headers aren't known yet.
+	if target.Headers == nil {
+		return target.URL + "#" + id, target.Title, nil
+	}
+
+	title, ok := target.Headers[id]
+	if !ok {
+		return "", "", fmt.Errorf("Link to unknown header %q in article %q", id, slug)
+	}
+
+	return target.URL + "#" + id, title, nil
+}
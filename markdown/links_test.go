@@ -0,0 +1,145 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+var testLinkTargets = map[string]*LinkTarget{
+	"walk-away": {
+		Headers: map[string]string{"the-test": "The Test", "why": "Why *It* Matters"},
+		Title:   "The Walk Away [Test]",
+		URL:     "/articles/walk-away",
+	},
+}
+
+func TestHeaders(t *testing.T) {
+	headers, err := Headers("# Title\n\n## Section (#custom)\n\n!note {\n### In a *Note*\n}\n\n"+
+		"```\n## Not a header\n```\n\n## Section (#custom)", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Header{
+		{ID: "title", Level: 1, Text: "Title"},
+		{ID: "custom", Level: 2, Text: "Section"},
+		{ID: "in-a-note", Level: 3, Text: "In a Note"},
+		{ID: "custom-1", Level: 2, Text: "Section"},
+	}, headers)
+
+	// IDs are found even if they wouldn't be rendered
+	headers, err = Headers("## Section", &RenderOptions{NoHeaderLinks: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "section", headers[0].ID)
+
+	// IDs are made from the text that links to other articles are given
+	headers, err = Headers("## Compare With [[walk-away]]\n\n## On [[walk-away#why]]",
+		&RenderOptions{LinkTargets: testLinkTargets})
+	assert.NoError(t, err)
+	assert.Equal(t, []*Header{
+		{ID: "compare-with-the-walk-away-test", Level: 2, Text: "Compare With The Walk Away [Test]"},
+		{ID: "on-why-it-matters", Level: 2, Text: "On Why *It* Matters"},
+	}, headers)
+
+	// Headers of articles that aren't known yet can be linked to
+	headers, err = Headers("## On [[walk-away#anything]]", &RenderOptions{
+		LinkTargets: map[string]*LinkTarget{
+			"walk-away": {Title: "The Walk Away", URL: "/articles/walk-away"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "on-the-walk-away", headers[0].ID)
+
+	rendered, err := Render("## Compare With [[walk-away]]", &RenderOptions{LinkTargets: testLinkTargets})
+	assert.NoError(t, err)
+	assert.Contains(t, rendered, `id="compare-with-the-walk-away-test"`)
+}
+
+func TestRenderWikiLinks(t *testing.T) {
+	options := &RenderOptions{LinkTargets: testLinkTargets}
+
+	testCases := []struct {
+		source   string
+		expected string
+	}{
+		{`[[walk-away]]`, `<a href="/articles/walk-away">The Walk Away [Test]</a>`},
+		{`[[walk-away#why]]`, `<a href="/articles/walk-away#why">Why *It* Matters</a>`},
+		{`[[walk-away#the-test|the *test*]]`, `<a href="/articles/walk-away#the-test">the <em>test</em></a>`},
+		{`[it](article:walk-away#the-test)`, `<a href="/articles/walk-away#the-test">it</a>`},
+		{`[](article:walk-away)`, `<a href="/articles/walk-away">The Walk Away [Test]</a>`},
+
+		// Code is left alone
+		{"`[[walk-away]]` and ``[](article:nothing)``", "<code>[[walk-away]]</code> and <code>[](article:nothing)</code>"},
+	}
+
+	for _, testCase := range testCases {
+		rendered, err := Render(testCase.source, options)
+		assert.NoError(t, err, testCase.source)
+		assert.Equal(t, "<p>"+testCase.expected+"</p>\n", rendered, testCase.source)
+	}
+
+	rendered, err := Render("```\n[[nothing]]\n```", options)
+	assert.NoError(t, err)
+	assert.Equal(t, "<pre><code>[[nothing]]\n</code></pre>\n", rendered)
+
+	rendered, err = Render("Code:\n\n    arr[[0]]", options)
+	assert.NoError(t, err)
+	assert.Equal(t, "<p>Code:</p>\n\n<pre><code>arr[[0]]\n</code></pre>\n", rendered)
+
+	rendered, err = Render("<div>\n[[nothing]]\n</div>\n", options)
+	assert.NoError(t, err)
+	assert.Equal(t, "<div>\n[[nothing]]\n</div>\n", rendered)
+}
+
+func TestRenderWikiLinksErrors(t *testing.T) {
+	options := &RenderOptions{LinkTargets: testLinkTargets}
+
+	_, err := Render("Text.\n\nSee [[walk-awya]].", options)
+	assert.Equal(t, `line 3: Link to unknown article "walk-awya"`, err.Error())
+
+	_, err = Render("See [this](article:walk-away#the-tset).", options)
+	assert.Equal(t, `line 1: Link to unknown header "the-tset" in article "walk-away"`, err.Error())
+
+	_, err = Render("See [[walk-away]].", nil)
+	assert.Equal(t, `line 1: Link to unknown article "walk-away"`, err.Error())
+}
+
+func TestLinks(t *testing.T) {
+	links, err := Links(`Intro with [a link](https://example.com).
+
+## The *First* Section
+
+A paragraph linking to [[walk-away#why]] with
+more text after.
+
+* A list item with [](article:walk-away) in **[bold](/bold)**.
+
+[Back to the top](#the-first-section)`, &RenderOptions{LinkTargets: testLinkTargets})
+	assert.NoError(t, err)
+
+	section := &Header{ID: "the-first-section", Level: 2, Text: "The First Section"}
+	assert.Equal(t, []*Link{
+		{Context: "Intro with a link.", URL: "https://example.com"},
+		{Context: "A paragraph linking to Why *It* Matters with more text after.", Header: section,
+			URL: "/articles/walk-away#why"},
+		{Context: "A list item with The Walk Away [Test] in bold.", Header: section,
+			URL: "/articles/walk-away"},
+		{Context: "A list item with The Walk Away [Test] in bold.", Header: section,
+			URL: "/bold"},
+	}, links)
+}
+
+func TestExcerpt(t *testing.T) {
+	text := "one two three four five LINK six seven eight nine ten"
+	start := strings.Index(text, "LINK")
+	end := start + len("LINK")
+
+	assert.Equal(t, text, excerpt(text, start, end, 100))
+	assert.Equal(t, "…four five LINK six seven…", excerpt(text, start, end, 24))
+
+	// Space that one side doesn't need goes to the other
+	assert.Equal(t, "LINK six seven…", excerpt("LINK six seven eight", 0, 4, 15))
+	assert.Equal(t, "…six seven LINK", excerpt("five six seven LINK", 15, 19, 15))
+
+	// Whitespace is collapsed
+	assert.Equal(t, "a LINK b", excerpt("  a\n LINK \tb ", 5, 9, 100))
+}
@@ -1,49 +1,127 @@
 package markdown
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"net/url"
+	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/russross/blackfriday"
+	"github.com/shurcooL/sanitized_anchor_name"
+	"golang.org/x/net/html"
 )
 
-var renderFuncs = []func(string, *RenderOptions) string{
-	// pre-transformations
-	transformFigures,
-	transformHeaders,
+// Error is a problem in Markdown source that prevents it from being rendered
+// correctly.
+type Error struct {
+	// Line is the line number (starting at 1) in the source where the problem
+	// was found. It's 0 if the problem can't be tied to a particular line.
+	Line int
 
-	// main Markdown rendering
-	renderMarkdown,
+	// Message describes the problem.
+	Message string
+}
 
-	// post-transformations
-	addSpacingDivs,
-	transformCodeWithLanguagePrefix,
-	transformFootnotes,
-	transformImagesToRetina,
+// Error returns the error's message prefixed with its line if it has one.
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("line %v: %v", e.Line, e.Message)
 }
 
 // RenderOptions describes a rendering operation to be customized.
 type RenderOptions struct {
-	// AbsoluteURLs replaces the sources of any images that pointed to relative
-	// URLs with absolute URLs.
+	// AnchorAliases maps old header IDs to the IDs that replaced them. A
+	// hidden anchor target is emitted for each old ID just before the header
+	// with the new one so that existing links keep working.
+	AnchorAliases map[string]string
+
+	// AbsoluteURLs replaces the sources of any images and targets of any links
+	// that pointed to relative URLs with absolute URLs resolved against
+	// BaseURL.
 	AbsoluteURLs bool
 
+	// AssetURLs maps the URLs of assets like "/assets/diagram.png" to the
+	// URLs of their fingerprinted versions. Images and links that point to
+	// assets are rewritten to use them. URLs are left alone if it's nil.
+	AssetURLs map[string]string
+
+	// BaseURL is the absolute URL of the document being rendered (e.g.
+	// "https://singularity.brandur.org/articles/self-hosting-singularity").
+	// Relative URLs are resolved against it when AbsoluteURLs is set.
+	BaseURL string
+
+	// CodeDir is the directory that files embedded with `!code` are read
+	// from. Defaults to the current working directory.
+	CodeDir string
+
+	// Disable names transforms in the pipeline that shouldn't run for this
+	// render. It takes precedence over Enable.
+	Disable []string
+
+	// Enable names transforms in the pipeline that are disabled by default
+	// but which should run for this render.
+	Enable []string
+
+	// ImageDir is the directory that figure images are read from to find
+	// their dimensions. Only images whose URLs start with ImageURL are read,
+	// and the rest of their URL is their path within ImageDir. Figures don't
+	// get dimensions unless both are set.
+	ImageDir string
+
+	// ImageURL is the URL prefix under which the images in ImageDir are
+	// served (e.g. "/assets/").
+	ImageURL string
+
+	// ImageVariants maps the URLs of images to the versions of them that the
+	// build generated at other sizes. Images that have variants get a srcset
+	// made from them rather than from an "@2x" file found in ImageDir, and
+	// figures get their dimensions from them.
+	ImageVariants map[string][]*ImageVariant
+
+	// LinkTargets maps the slugs of articles to what's needed to link to
+	// them from others. Links to articles that aren't in it are an error.
+	LinkTargets map[string]*LinkTarget
+
 	// NoHeaderLinks disables automatic permalinks on headers.
 	NoHeaderLinks bool
 
-	// NoRetina disables the Retina.JS rendering attributes.
-	NoRetina bool
+	// Warn receives problems found while rendering that aren't serious
+	// enough to fail it, like an image without a high-DPI variant. Warnings
+	// are discarded if it's nil.
+	Warn func(message string)
+}
+
+// ImageVariant is a version of an image at a particular size.
+type ImageVariant struct {
+	// Density is the pixel density that the variant is meant for (1 or 2),
+	// or 0 if it was generated for a particular width instead.
+	Density int
+
+	// Height is the variant's height in pixels.
+	Height int
+
+	// URL is where the variant is served from.
+	URL string
+
+	// Width is the variant's width in pixels.
+	Width int
 }
 
 // Render a Markdown string to HTML while applying all custom project-specific
-// filters including footnotes and stable header links.
-func Render(source string, options *RenderOptions) string {
-	for _, f := range renderFuncs {
-		source = f(source, options)
-	}
-	return source
+// filters including footnotes and stable header links. It uses the default
+// pipeline. See Pipeline for rendering with a custom set of transforms.
+//
+// Problems in the source like references to undefined footnotes are returned
+// as an *Error.
+func Render(source string, options *RenderOptions) (string, error) {
+	return defaultPipeline.Render(source, options)
 }
 
 var h2RE = regexp.MustCompile(`<h2`)
@@ -51,7 +129,7 @@ var h3RE = regexp.MustCompile(`<h3`)
 
 // Puts a ring before every h2 except the first and a brush stroke before every
 // h3 except the first.
-func addSpacingDivs(source string, options *RenderOptions) string {
+func addSpacingDivs(source string, options *RenderOptions) (string, error) {
 	var first bool
 	res := source
 
@@ -75,7 +153,7 @@ func addSpacingDivs(source string, options *RenderOptions) string {
 		}
 	})
 
-	return res
+	return res, nil
 }
 
 // Look for any whitespace between HTML tags.
@@ -91,189 +169,556 @@ func collapseHTML(html string) string {
 	return html
 }
 
-func renderMarkdown(source string, options *RenderOptions) string {
-	return string(blackfriday.Run([]byte(source)))
+// Checks whether any descendant of the given node is of the given type.
+func containsNode(node *blackfriday.Node, nodeType blackfriday.NodeType) bool {
+	found := false
+	node.Walk(func(child *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if child != node && child.Type == nodeType {
+			found = true
+			return blackfriday.Terminate
+		}
+		return blackfriday.GoToNext
+	})
+	return found
 }
 
-var codeRE = regexp.MustCompile(`<code class="(\w+)">`)
+// Joins adjacent text nodes among the children of the given node. Blackfriday
+// sometimes splits text that looks like it might contain markup into more
+// than one node.
+func mergeTextNodes(node *blackfriday.Node) {
+	for child := node.FirstChild; child != nil; child = child.Next {
+		for child.Type == blackfriday.Text && child.Next != nil &&
+			child.Next.Type == blackfriday.Text {
+			child.Literal = append(append([]byte(nil), child.Literal...), child.Next.Literal...)
+			child.Next.Unlink()
+		}
+	}
+}
 
-func transformCodeWithLanguagePrefix(source string, options *RenderOptions) string {
-	return codeRE.ReplaceAllString(source, `<code class="language-$1">`)
+// Parses Markdown source into a syntax tree using the project's standard set
+// of extensions.
+func parseMarkdown(source string) *blackfriday.Node {
+	parser := blackfriday.New(blackfriday.WithExtensions(blackfriday.CommonExtensions))
+	return parser.Parse([]byte(separateBlockPlaceholders(source)))
 }
 
-const figureHTML = `
-<figure>
-  <p><a href="%s"><img src="%s" class="overflowing"></a></p>
-  <figcaption>%s</figcaption>
-</figure>
-`
+// Renders a syntax tree produced by parseMarkdown to HTML.
+func renderAST(doc *blackfriday.Node, options *RenderOptions) string {
+	renderer := &renderer{
+		HTMLRenderer: blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
+			Flags: blackfriday.CommonHTMLFlags,
+		}),
+		options: options,
+	}
 
-var figureRE = regexp.MustCompile(`!fig src="(.*)" caption="(.*)"`)
+	var b bytes.Buffer
+	renderer.RenderHeader(&b, doc)
+	doc.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		return renderer.RenderNode(&b, node, entering)
+	})
+	renderer.RenderFooter(&b, doc)
 
-func transformFigures(source string, options *RenderOptions) string {
-	return figureRE.ReplaceAllStringFunc(source, func(figure string) string {
-		matches := figureRE.FindStringSubmatch(figure)
-		src := matches[1]
+	return b.String()
+}
 
-		link := src
-		extension := filepath.Ext(link)
-		if extension != "" && extension != ".svg" {
-			link = link[0:len(src)-len(extension)] + "@2x" + extension
+// Extracts the text of a node and all its descendants with any markup
+// removed.
+func plainText(node *blackfriday.Node) string {
+	var b bytes.Buffer
+	node.Walk(func(child *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if entering && (child.Type == blackfriday.Text || child.Type == blackfriday.Code) {
+			b.Write(child.Literal)
 		}
-
-		// This is a really ugly hack in that it relies on the regex above
-		// being greedy about quotes, but meh, I'll make it better when there's
-		// a good reason to.
-		caption := strings.Replace(matches[2], `\"`, `"`, -1)
-
-		return fmt.Sprintf(figureHTML, link, src, caption)
+		return blackfriday.GoToNext
 	})
+	return b.String()
 }
 
-// A layer that we wrap the entire footer section in for styling purposes.
-const footerWrapper = `
-<div id="footnotes">
-  %s
-</div>
-`
-
-// HTML for a footnote within the document.
-const footnoteAnchorHTML = `
-<sup id="footnote-%s">
-  <a href="#footnote-%s-source">%s</a>
-</sup>
-`
-
-// HTML for a reference to a footnote within the document.
-const footnoteReferenceHTML = `
-<sup id="footnote-%s-source">
-  <a href="#footnote-%s">%s</a>
-</sup>
-`
-
-// Look for the section the section at the bottom of the page that looks like
-// <p>[1] (the paragraph tag is there because Markdown will have already
-// wrapped it by this point).
-var footerRE = regexp.MustCompile(`(?ms:^<p>\[\d+\].*)`)
-
-// Look for a single footnote within the footer.
-var footnoteRE = regexp.MustCompile(`\[(\d+)\](\s+.*)`)
-
-// Note that this must be a post-transform filter. If it wasn't, our Markdown
-// renderer would not render the Markdown inside the footnotes layer because it
-// would already be wrapped in HTML.
-func transformFootnotes(source string, options *RenderOptions) string {
-	footer := footerRE.FindString(source)
-
-	if footer != "" {
-		// remove the footer for now
-		source = strings.Replace(source, footer, "", 1)
-
-		footer = footnoteRE.ReplaceAllStringFunc(footer, func(footnote string) string {
-			// first create a footnote with an anchor that links can target
-			matches := footnoteRE.FindStringSubmatch(footnote)
-			number := matches[1]
-			anchor := fmt.Sprintf(footnoteAnchorHTML, number, number, number) + matches[2]
-
-			// then replace all references in the body to this footnote
-			reference := fmt.Sprintf(footnoteReferenceHTML, number, number, number)
-			source = strings.Replace(source,
-				fmt.Sprintf(`[%s]`, number),
-				collapseHTML(reference), -1)
-
-			return collapseHTML(anchor)
-		})
-
-		// and wrap the whole footer section in a layer for styling
-		footer = fmt.Sprintf(footerWrapper, footer)
-		source = source + footer
+// Renders Markdown to HTML. Footnotes are handled here rather than as a
+// separate transformation because references to them are found in the syntax
+// tree where code is easily distinguishable from text.
+func renderMarkdown(source string, options *RenderOptions) (string, error) {
+	source, err := transformCodeFences(source)
+	if err != nil {
+		return "", err
 	}
 
-	return source
+	source, footnotes, err := extractFootnotes(source)
+	if err != nil {
+		return "", err
+	}
+
+	doc := parseMarkdown(source)
+
+	transformHeaders(doc, options)
+
+	err = transformFootnoteReferences(doc, source, footnotes)
+	if err != nil {
+		return "", err
+	}
+
+	footer, err := renderFootnotes(footnotes, options)
+	if err != nil {
+		return "", err
+	}
+
+	return renderAST(doc, options) + footer, nil
 }
 
-const headerHTML = `
-<h%v id="%s">
-  <a href="#%s">%s</a>
-</h%v>
-`
+// renderer is a Blackfriday renderer that produces the same HTML as the
+// standard one except for a few node types that get special treatment.
+type renderer struct {
+	*blackfriday.HTMLRenderer
 
-const headerHTMLNoLink = `
-<h%v>%s</h%v>
-`
+	options *RenderOptions
+}
 
-// Matches one of the following:
-//
-//   # header
-//   # header (#header-id)
-//
-// For now, only match ## or more so as to remove code comments from
-// matches. We need a better way of doing that though.
-var headerRE = regexp.MustCompile(`(?m:^(#{2,})\s+(.*?)(\s+\(#(.*)\))?$)`)
+// RenderNode renders a single node of a syntax tree.
+func (r *renderer) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	switch node.Type {
+	case blackfriday.CodeBlock:
+		r.renderCodeBlock(w, node)
+		return blackfriday.GoToNext
+
+	case blackfriday.HTMLBlock:
+		if html, ok := parseDirectivePlaceholder(string(node.Literal)); ok {
+			// Separate the block from whatever came before it in the same
+			// way that Blackfriday would.
+			if node.Prev != nil {
+				io.WriteString(w, "\n")
+			}
+			io.WriteString(w, html)
+			io.WriteString(w, "\n")
+			return blackfriday.GoToNext
+		}
 
-func transformHeaders(source string, options *RenderOptions) string {
-	headerNum := 0
+	case blackfriday.HTMLSpan:
+		if html, ok := parseDirectivePlaceholder(string(node.Literal)); ok {
+			io.WriteString(w, html)
+			return blackfriday.GoToNext
+		}
+	}
 
+	return r.HTMLRenderer.RenderNode(w, node, entering)
+}
+
+// Matches an explicit ID at the end of a header's text like:
+//
+//	## header (#header-id)
+var headerIDRE = regexp.MustCompile(`\s+\(#([^)\s]*)\)$`)
+
+// Gives every header in the document an ID and a permalink to itself. A
+// header's ID is either given explicitly with a suffix like "(#header-id)" or
+// generated from its text. Duplicate IDs are given a numbered suffix.
+//
+// Headers are found in the syntax tree rather than in Markdown source so that
+// lines in code blocks that happen to look like headers are left alone.
+func transformHeaders(doc *blackfriday.Node, options *RenderOptions) {
 	// Tracks previously assigned headers so that we can detect duplicates.
 	headers := make(map[string]int)
 
-	source = headerRE.ReplaceAllStringFunc(source, func(header string) string {
-		matches := headerRE.FindStringSubmatch(header)
+	doc.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if node.Type != blackfriday.Heading || !entering {
+			return blackfriday.GoToNext
+		}
 
-		level := len(matches[1])
-		title := matches[2]
-		id := matches[4]
+		mergeTextNodes(node)
 
-		var newID string
+		// An explicit ID is stripped from the header's text whether or not
+		// it ends up being used.
+		id := node.HeadingID
+		if last := node.LastChild; last != nil && last.Type == blackfriday.Text {
+			if loc := headerIDRE.FindSubmatchIndex(last.Literal); loc != nil {
+				id = string(last.Literal[loc[2]:loc[3]])
+				last.Literal = last.Literal[:loc[0]]
+			}
+		}
 
+		if options != nil && options.NoHeaderLinks {
+			node.HeadingID = ""
+			return blackfriday.SkipChildren
+		}
+
+		// Headers without an explicit ID get one generated from their text
+		// so that permalinks don't depend on a header's position.
 		if id == "" {
-			// Header with no name, assign a prefixed number.
-			newID = fmt.Sprintf("section-%v", headerNum)
+			id = sanitized_anchor_name.Create(plainText(node))
+			if id == "" {
+				id = "section"
+			}
+		}
 
-		} else {
-			occurrence, ok := headers[id]
+		var newID string
+		occurrence, ok := headers[id]
 
-			if ok {
-				// Give duplicate IDs a suffix.
-				newID = fmt.Sprintf("%s-%d", id, occurrence)
-				headers[id]++
+		if ok {
+			// Give duplicate IDs a suffix.
+			newID = fmt.Sprintf("%s-%d", id, occurrence)
+			headers[id]++
 
-			} else {
-				// Otherwise this is the first such ID we've seen.
-				newID = id
-				headers[id] = 1
+		} else {
+			// Otherwise this is the first such ID we've seen.
+			newID = id
+			headers[id] = 1
+		}
+
+		node.HeadingID = newID
+
+		// Wrap the header's content in a link to itself, unless it already
+		// contains a link because links can't be nested.
+		if !containsNode(node, blackfriday.Link) {
+			link := blackfriday.NewNode(blackfriday.Link)
+			link.Destination = []byte("#" + newID)
+			for child := node.FirstChild; child != nil; {
+				next := child.Next
+				link.AppendChild(child)
+				child = next
 			}
+			node.AppendChild(link)
+		}
+
+		return blackfriday.SkipChildren
+	})
+}
+
+const anchorAliasHTML = `<span id="%s" class="anchor-alias"></span>`
+
+// Matches the opening tag of a header that has an ID.
+var headerTagIDRE = regexp.MustCompile(`<h[1-6] id="([^"]+)"`)
+
+// Inserts hidden anchor targets for any aliased header IDs. Aliases whose
+// header doesn't exist are ignored.
+func transformAnchorAliases(source string, options *RenderOptions) (string, error) {
+	if options == nil || len(options.AnchorAliases) < 1 {
+		return source, nil
+	}
+
+	// Group old IDs by their new ID so that all aliases of a header are
+	// inserted together and in a stable order.
+	aliases := make(map[string][]string)
+	for oldID, newID := range options.AnchorAliases {
+		aliases[newID] = append(aliases[newID], oldID)
+	}
+
+	return headerTagIDRE.ReplaceAllStringFunc(source, func(header string) string {
+		oldIDs := aliases[headerTagIDRE.FindStringSubmatch(header)[1]]
+		sort.Strings(oldIDs)
+
+		var targets string
+		for _, oldID := range oldIDs {
+			targets += fmt.Sprintf(anchorAliasHTML, oldID)
 		}
+		return targets + header
+	}), nil
+}
 
-		headerNum++
+// Matches an image tag, capturing its source.
+var imageTagRE = regexp.MustCompile(`<img\s[^>]*?\bsrc="([^"]+)"[^>]*>`)
+
+// Gives every image a `data-rjs` attribute so that Retina.JS will replace it
+// with its "@2x" version, *except* if the image is an SVG or already has a
+// srcset. SVGs are resolution agnostic and don't need replacing. This
+// transform is disabled by default in favor of generating srcset at build
+// time, and is only useful along with Retina.JS.
+func transformImagesToRetina(source string, options *RenderOptions) (string, error) {
+	return imageTagRE.ReplaceAllStringFunc(source, func(img string) string {
+		src := imageTagRE.FindStringSubmatch(img)[1]
+		if filepath.Ext(src) == ".svg" || strings.Contains(img, " srcset=") {
+			return img
+		}
+		return `<img data-rjs="2" ` + img[len("<img "):]
+	}), nil
+}
 
-		// Replace the Markdown header with HTML equivalent.
-		if options != nil && options.NoHeaderLinks {
-			return collapseHTML(fmt.Sprintf(headerHTMLNoLink, level, title, level))
+// Gives every image that has an "@2x" version next to it in ImageDir a
+// srcset so that browsers on high-DPI displays will use it. Images without
+// one produce a warning, except for SVGs, which are resolution agnostic.
+// Images that aren't in ImageDir are left alone.
+//
+// Images with generated variants in ImageVariants get a srcset of all of
+// them instead.
+func transformImagesToSrcset(source string, options *RenderOptions) (string, error) {
+	return imageTagRE.ReplaceAllStringFunc(source, func(img string) string {
+		if strings.Contains(img, " srcset=") {
+			return img
+		}
+
+		src := html.UnescapeString(imageTagRE.FindStringSubmatch(img)[1])
+
+		if variants := imageVariants(src, options); variants != nil {
+			return insertSrcset(img, variantsSrcset(variants))
+		}
+
+		variant := highDPIVariant(src)
+		if variant == "" {
+			return img
+		}
+
+		path, ok := localImagePath(src, options)
+		if !ok {
+			return img
+		}
+
+		variantPath, _ := localImagePath(variant, options)
+		if _, err := os.Stat(variantPath); err != nil {
+			warn(options, "Image %v has no high-DPI variant (expected %v)", src, variantPath)
+			return img
 		}
 
-		return collapseHTML(fmt.Sprintf(headerHTML, level, newID, newID, title, level))
+		// Only worth mentioning if the variant exists without the original.
+		if _, err := os.Stat(path); err != nil {
+			warn(options, "Image %v doesn't exist, but its high-DPI variant does", src)
+		}
+
+		return insertSrcset(img, src+" 1x, "+variant+" 2x")
+	}), nil
+}
+
+// Gets the generated variants of an image, if it has any.
+func imageVariants(src string, options *RenderOptions) []*ImageVariant {
+	if options == nil {
+		return nil
+	}
+	return options.ImageVariants[src]
+}
+
+// Inserts a srcset into an image tag just after its source.
+func insertSrcset(img, srcset string) string {
+	i := strings.Index(img, `src="`) + len(`src="`)
+	i += strings.Index(img[i:], `"`) + 1
+	return img[:i] + fmt.Sprintf(` srcset="%s"`, html.EscapeString(srcset)) + img[i:]
+}
 
+// Builds a srcset out of an image's variants. Width descriptors can't be
+// mixed with density descriptors, so if any variant was generated for a
+// width, every variant is described by its width. Browsers then pick one
+// based on the width of the viewport and the display's density.
+func variantsSrcset(variants []*ImageVariant) string {
+	sorted := append([]*ImageVariant(nil), variants...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Width < sorted[j].Width
 	})
 
-	return source
+	byWidth := false
+	for _, variant := range sorted {
+		if variant.Density == 0 {
+			byWidth = true
+		}
+	}
+
+	var candidates []string
+	for _, variant := range sorted {
+		if byWidth {
+			candidates = append(candidates, fmt.Sprintf("%v %vw", variant.URL, variant.Width))
+		} else {
+			candidates = append(candidates, fmt.Sprintf("%v %vx", variant.URL, variant.Density))
+		}
+	}
+	return strings.Join(candidates, ", ")
 }
 
-var imageRE = regexp.MustCompile(`<img src="(.+)"`)
+// Gets the URL of the "@2x" version of an image. SVGs and URLs without an
+// extension don't have one, and produce an empty string.
+func highDPIVariant(src string) string {
+	extension := filepath.Ext(src)
+	if extension == "" || extension == ".svg" {
+		return ""
+	}
+	return src[0:len(src)-len(extension)] + "@2x" + extension
+}
 
-func transformImagesToRetina(source string, options *RenderOptions) string {
-	if options != nil && options.NoRetina {
-		return source
+// Maps an image's URL to a file on disk when it's under ImageURL and an
+// ImageDir has been configured.
+func localImagePath(src string, options *RenderOptions) (string, bool) {
+	if options == nil || options.ImageDir == "" || options.ImageURL == "" {
+		return "", false
 	}
 
-	// The basic idea here is that we give every image a `retina-rjs` tag so
-	// that Retina.JS will replace it with a retina version *except* if the
-	// image is an SVG. These are resolution agnostic and don't need replacing.
-	return imageRE.ReplaceAllStringFunc(source, func(img string) string {
-		matches := imageRE.FindStringSubmatch(img)
-		if filepath.Ext(matches[1]) == ".svg" {
-			return fmt.Sprintf(`<img src="%s"`, matches[1])
+	if !strings.HasPrefix(src, options.ImageURL) {
+		return "", false
+	}
+
+	return filepath.Join(options.ImageDir, filepath.FromSlash(src[len(options.ImageURL):])), true
+}
+
+// Sends a warning to options.Warn if one was given.
+func warn(options *RenderOptions, format string, args ...interface{}) {
+	if options == nil || options.Warn == nil {
+		return
+	}
+	options.Warn(fmt.Sprintf(format, args...))
+}
+
+// Replaces the URLs of assets in images and links with the URLs of their
+// fingerprinted versions from AssetURLs. URLs under ImageURL that aren't in
+// it produce a warning because they'll be broken on the built site.
+//
+// Images marked for Retina.JS are pointed at the fingerprinted version of
+// their "@2x" variant explicitly, since the one that Retina.JS would guess
+// from a fingerprinted source doesn't exist.
+func transformAssetURLs(source string, options *RenderOptions) (string, error) {
+	if options == nil || options.AssetURLs == nil {
+		return source, nil
+	}
+
+	fingerprint := func(url string) string {
+		if fingerprinted, ok := options.AssetURLs[url]; ok {
+			return fingerprinted
 		}
-		return fmt.Sprintf(`<img data-rjs="2" src="%s"`, matches[1])
-	})
+		if options.ImageURL != "" && strings.HasPrefix(url, options.ImageURL) {
+			warn(options, "Asset %v doesn't exist", url)
+		}
+		return url
+	}
+
+	// Images marked for Retina.JS are given their "@2x" variant while their
+	// source is still the unfingerprinted one that it's named after.
+	retinaVariant := func(token *html.Token) {
+		if token.Data != "img" {
+			return
+		}
+
+		var src string
+		for _, attr := range token.Attr {
+			if attr.Key == "src" {
+				src = attr.Val
+			}
+		}
+
+		for i, attr := range token.Attr {
+			if attr.Key != "data-rjs" {
+				continue
+			}
+			if variant, ok := options.AssetURLs[highDPIVariant(src)]; ok {
+				token.Attr[i].Val = variant
+			}
+		}
+	}
+
+	return rewriteURLs(source, fingerprint, retinaVariant), nil
+}
+
+// Attributes that contain URLs and which are rewritten by rewriteURLs, keyed
+// by the tag they appear on.
+var urlAttributes = map[string][]string{
+	"a":   {"href"},
+	"img": {"src", "srcset"},
+}
+
+// Rewrites the URLs in images and links to absolute URLs by resolving them
+// against BaseURL. This is needed for content that's displayed away from the
+// site like in a feed reader or an email.
+//
+// Resolution follows the normal rules that a browser uses, so root-relative
+// paths are joined to BaseURL's host, document-relative paths are joined to
+// its directory, and fragments (like the ones used by footnotes and header
+// permalinks) are joined to the document itself. URLs which are already
+// absolute are left alone.
+func transformURLsToAbsolute(source string, options *RenderOptions) (string, error) {
+	if options == nil || !options.AbsoluteURLs {
+		return source, nil
+	}
+
+	base, err := url.Parse(options.BaseURL)
+	if err != nil || !base.IsAbs() {
+		return "", fmt.Errorf("BaseURL should be an absolute URL, but was %q", options.BaseURL)
+	}
+
+	resolve := func(s string) string {
+		ref, err := url.Parse(s)
+		if err != nil || ref.IsAbs() {
+			return s
+		}
+		return base.ResolveReference(ref).String()
+	}
+
+	return rewriteURLs(source, resolve, nil), nil
+}
+
+// Replaces each URL in the attributes of images and links (those in
+// urlAttributes) with the result of rewrite, including each of the URLs in a
+// srcset. If tag is given, it's called with each of those tags before its
+// URLs are rewritten so that it can change other attributes.
+//
+// Tags that don't change are copied verbatim so as not to disturb the rest
+// of the document.
+func rewriteURLs(source string, rewrite func(url string) string, tag func(token *html.Token)) string {
+	var b bytes.Buffer
+	tokenizer := html.NewTokenizer(strings.NewReader(source))
+
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+
+		raw := tokenizer.Raw()
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			b.Write(raw)
+			continue
+		}
+
+		// Raw is only valid until the next call to Next or Token, so it
+		// needs to be copied before tokenizing the tag.
+		raw = append([]byte(nil), raw...)
+
+		token := tokenizer.Token()
+		keys, ok := urlAttributes[token.Data]
+		if !ok {
+			b.Write(raw)
+			continue
+		}
+
+		original := append([]html.Attribute(nil), token.Attr...)
+		if tag != nil {
+			tag(&token)
+		}
+
+		for i, attr := range token.Attr {
+			switch {
+			case attr.Key == "srcset" && containsString(keys, attr.Key):
+				token.Attr[i].Val = mapSrcset(attr.Val, rewrite)
+			case containsString(keys, attr.Key):
+				token.Attr[i].Val = rewrite(attr.Val)
+			}
+		}
+
+		changed := false
+		for i, attr := range token.Attr {
+			changed = changed || attr != original[i]
+		}
+
+		if changed {
+			b.WriteString(token.String())
+		} else {
+			b.Write(raw)
+		}
+	}
+
+	return b.String()
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Replaces each of the URLs in a srcset like "a.png 1x, a@2x.png 2x" with
+// the result of fn.
+func mapSrcset(srcset string, fn func(url string) string) string {
+	candidates := strings.Split(srcset, ",")
+	for i, candidate := range candidates {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+
+		fields[0] = fn(fields[0])
+		candidates[i] = strings.Join(fields, " ")
+	}
+	return strings.Join(candidates, ", ")
 }
@@ -1,6 +1,9 @@
 package markdown
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	assert "github.com/stretchr/testify/require"
@@ -14,11 +17,18 @@ func TestCollapseHTML(t *testing.T) {
 }
 
 func TestRender(t *testing.T) {
-	assert.Equal(t, "<p><strong>strong</strong></p>\n", Render("**strong**", nil))
+	rendered, err := Render("**strong**", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "<p><strong>strong</strong></p>\n", rendered)
+
+	_, err = Render("Undefined footnote [^1].", nil)
+	assert.Equal(t, "line 1: Footnote [^1] is referenced but never defined", err.Error())
 }
 
 func TestRenderMarkdown(t *testing.T) {
-	assert.Equal(t, "<p><strong>strong</strong></p>\n", renderMarkdown("**strong**", nil))
+	rendered, err := renderMarkdown("**strong**", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "<p><strong>strong</strong></p>\n", rendered)
 }
 
 func TestAddSpacingDivs(t *testing.T) {
@@ -30,7 +40,7 @@ func TestAddSpacingDivs(t *testing.T) {
 
 <h2 id="xx">header b</h2>
 `,
-		addSpacingDivs(`
+		mustTransform(t, addSpacingDivs, `
 <h2 id="xx">header a</h2>
 
 <h2 id="xx">header b</h2>
@@ -45,7 +55,7 @@ func TestAddSpacingDivs(t *testing.T) {
 
 <h3 id="xx">header b</h3>
 `,
-		addSpacingDivs(`
+		mustTransform(t, addSpacingDivs, `
 <h3 id="xx">header a</h3>
 
 <h3 id="xx">header b</h3>
@@ -53,164 +63,396 @@ func TestAddSpacingDivs(t *testing.T) {
 	)
 }
 
-func TestTransformCodeWithLanguagePrefix(t *testing.T) {
+func TestTransformAnchorAliases(t *testing.T) {
 	assert.Equal(t,
-		`<code class="language-ruby">`,
-		transformCodeWithLanguagePrefix(`<code class="ruby">`, nil),
+		`<span id="old-b" class="anchor-alias"></span>`+
+			`<span id="old-c" class="anchor-alias"></span>`+
+			`<h2 id="new"><a href="#new">New</a></h2>`+"\n"+
+			`<h2 id="other"><a href="#other">Other</a></h2>`,
+		mustTransform(t, transformAnchorAliases,
+			`<h2 id="new"><a href="#new">New</a></h2>`+"\n"+
+				`<h2 id="other"><a href="#other">Other</a></h2>`,
+			&RenderOptions{AnchorAliases: map[string]string{
+				"old-c":   "new",
+				"old-b":   "new",
+				"missing": "nonexistent",
+			}},
+		),
 	)
+
+	assert.Equal(t, `<h2 id="new">New</h2>`,
+		mustTransform(t, transformAnchorAliases, `<h2 id="new">New</h2>`, nil))
 }
 
-func TestTransformFigures(t *testing.T) {
-	assert.Equal(t, `
-<figure>
-  <p><a href="fig-src"><img src="fig-src" class="overflowing"></a></p>
-  <figcaption>fig-caption</figcaption>
-</figure>
-`,
-		transformFigures(`!fig src="fig-src" caption="fig-caption"`, nil),
-	)
+func TestTransformHeaders(t *testing.T) {
+	var rendered string
+	var err error
 
-	// .png links to "@2x" version of the source
-	assert.Equal(t, `
-<figure>
-  <p><a href="fig-src@2x.png"><img src="fig-src.png" class="overflowing"></a></p>
-  <figcaption>fig-caption</figcaption>
-</figure>
-`,
-		transformFigures(`!fig src="fig-src.png" caption="fig-caption"`, nil),
-	)
+	rendered, err = renderMarkdown(`
+## Introduction (#intro)
 
-	// .svg doesn't link to "@2x"
-	assert.Equal(t, `
-<figure>
-  <p><a href="fig-src.svg"><img src="fig-src.svg" class="overflowing"></a></p>
-  <figcaption>fig-caption</figcaption>
-</figure>
-`,
-		transformFigures(`!fig src="fig-src.svg" caption="fig-caption"`, nil),
-	)
+Intro here.
 
-	assert.Equal(t, `
-<figure>
-  <p><a href="fig-src"><img src="fig-src" class="overflowing"></a></p>
-  <figcaption>Caption with some "" quote.</figcaption>
-</figure>
-`,
-		transformFigures(`!fig src="fig-src" caption="Caption with some \"\" quote."`, nil),
-	)
-}
+## Body
 
-func TestTransformFootnotes(t *testing.T) {
-	assert.Equal(t, `
-<p>This is a reference <sup id="footnote-1-source"><a href="#footnote-1">1</a></sup> to a footnote <sup id="footnote-2-source"><a href="#footnote-2">2</a></sup>.</p>
+### Article (#article)
 
+Article one.
 
-<div id="footnotes">
-  <p><sup id="footnote-1"><a href="#footnote-1-source">1</a></sup> Footnote one.</p>
+### Subsection (#sub)
 
-<p><sup id="footnote-2"><a href="#footnote-2-source">2</a></sup> Footnote two.</p>
+More content.
 
-</div>
-`,
-		transformFootnotes(`
-<p>This is a reference [1] to a footnote [2].</p>
+### Article (#article)
 
-<p>[1] Footnote one.</p>
+Article two.
 
-<p>[2] Footnote two.</p>
-`,
-			nil,
-		),
-	)
-}
+### Subsection
 
-func TestTransformHeaders(t *testing.T) {
-	assert.Equal(t, `
-<h2 id="intro"><a href="#intro">Introduction</a></h2>
+More content.
 
-Intro here.
+## Conclusion (#conclusion)
+
+Conclusion.
+`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `<h2 id="intro"><a href="#intro">Introduction</a></h2>
 
-<h2 id="section-1"><a href="#section-1">Body</a></h2>
+<p>Intro here.</p>
+
+<h2 id="body"><a href="#body">Body</a></h2>
 
 <h3 id="article"><a href="#article">Article</a></h3>
 
-Article one.
+<p>Article one.</p>
 
 <h3 id="sub"><a href="#sub">Subsection</a></h3>
 
-More content.
+<p>More content.</p>
 
 <h3 id="article-1"><a href="#article-1">Article</a></h3>
 
-Article two.
+<p>Article two.</p>
 
-<h3 id="section-5"><a href="#section-5">Subsection</a></h3>
+<h3 id="subsection"><a href="#subsection">Subsection</a></h3>
 
-More content.
+<p>More content.</p>
 
 <h2 id="conclusion"><a href="#conclusion">Conclusion</a></h2>
 
-Conclusion.
-`,
-		transformHeaders(`
-## Introduction (#intro)
+<p>Conclusion.</p>
+`, rendered)
 
-Intro here.
+	// Generated IDs get the same suffixes as explicit ones when duplicated,
+	// and an explicit ID takes precedence over a generated one.
+	rendered, err = renderMarkdown(`
+## Why Go? It's Fast!
 
-## Body
+## Why Go? It's Fast!
 
-### Article (#article)
+## Why Go (#why-go-it-s-fast)
 
-Article one.
+## ???
+`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `<h2 id="why-go-it-s-fast"><a href="#why-go-it-s-fast">Why Go? It&rsquo;s Fast!</a></h2>
 
-### Subsection (#sub)
+<h2 id="why-go-it-s-fast-1"><a href="#why-go-it-s-fast-1">Why Go? It&rsquo;s Fast!</a></h2>
 
-More content.
+<h2 id="why-go-it-s-fast-2"><a href="#why-go-it-s-fast-2">Why Go</a></h2>
 
-### Article (#article)
+<h2 id="section"><a href="#section">???</a></h2>
+`, rendered)
 
-Article two.
+	// h1s and inline markup are supported. Headers that contain a link
+	// aren't wrapped in another one.
+	rendered, err = renderMarkdown(`
+# The *walk away* test
 
-### Subsection
+## Using `+"`go vet`"+` (#vet)
 
-More content.
+## See [the docs](/docs)
+`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `<h1 id="the-walk-away-test"><a href="#the-walk-away-test">The <em>walk away</em> test</a></h1>
 
-## Conclusion (#conclusion)
+<h2 id="vet"><a href="#vet">Using <code>go vet</code></a></h2>
 
-Conclusion.
-`,
-			nil,
-		),
-	)
+<h2 id="see-the-docs">See <a href="/docs">the docs</a></h2>
+`, rendered)
 
-	assert.Equal(t, `
-<h2>Introduction</h2>
-`,
-		transformHeaders(`
+	// Code that looks like a header is left alone
+	rendered, err = renderMarkdown("```\n# comment (#not-an-id)\n```\n\n    ## indented\n", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `<pre><code># comment (#not-an-id)
+</code></pre>
+
+<pre><code>## indented
+</code></pre>
+`, rendered)
+
+	rendered, err = renderMarkdown(`
 ## Introduction (#intro)
-`,
-			&RenderOptions{NoHeaderLinks: true},
-		),
-	)
+`, &RenderOptions{NoHeaderLinks: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "<h2>Introduction</h2>\n", rendered)
 }
 
 func TestTransformImagesToRetina(t *testing.T) {
 	assert.Equal(t,
 		`<img data-rjs="2" src="/assets/hello.jpg">`,
-		transformImagesToRetina(`<img src="/assets/hello.jpg">`, nil),
+		mustTransform(t, transformImagesToRetina, `<img src="/assets/hello.jpg">`, nil),
 	)
 
 	// No retina data- marker is inserted for resolution agnostic SVGs.
 	assert.Equal(t,
 		`<img src="/assets/hello.svg">`,
-		transformImagesToRetina(`<img src="/assets/hello.svg">`, nil),
+		mustTransform(t, transformImagesToRetina, `<img src="/assets/hello.svg">`, nil),
 	)
 
+	// Attributes after the source don't confuse the check for SVGs.
+	assert.Equal(t,
+		`<img src="/assets/hello.svg" alt="Hello." class="overflowing">`,
+		mustTransform(t, transformImagesToRetina,
+			`<img src="/assets/hello.svg" alt="Hello." class="overflowing">`, nil),
+	)
+
+	// Images that already have a srcset are left to the browser.
+	assert.Equal(t,
+		`<img src="/assets/hello.jpg" srcset="/assets/hello.jpg 1x, /assets/hello@2x.jpg 2x">`,
+		mustTransform(t, transformImagesToRetina,
+			`<img src="/assets/hello.jpg" srcset="/assets/hello.jpg 1x, /assets/hello@2x.jpg 2x">`, nil),
+	)
+
+	// The transform is disabled by default.
+	rendered, err := Render(`<img src="/assets/hello.jpg">`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "<p><img src=\"/assets/hello.jpg\"></p>\n", rendered)
+
+	rendered, err = Render(`<img src="/assets/hello.jpg">`,
+		&RenderOptions{Enable: []string{TransformRetinaImages}})
+	assert.NoError(t, err)
+	assert.Equal(t, "<p><img data-rjs=\"2\" src=\"/assets/hello.jpg\"></p>\n", rendered)
+}
+
+func TestTransformImagesToSrcset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srcset")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"both.png", "both@2x.png", "only-1x.png"} {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+
+	var warnings []string
+	options := &RenderOptions{
+		ImageDir: dir,
+		ImageURL: "/assets/",
+		Warn:     func(message string) { warnings = append(warnings, message) },
+	}
+
+	assert.Equal(t,
+		`<img src="/assets/both.png" srcset="/assets/both.png 1x, /assets/both@2x.png 2x" alt="">`,
+		mustTransform(t, transformImagesToSrcset, `<img src="/assets/both.png" alt="">`, options),
+	)
+	assert.Nil(t, warnings)
+
+	// A missing high-DPI variant is a warning rather than an error
+	assert.Equal(t,
+		`<img src="/assets/only-1x.png">`,
+		mustTransform(t, transformImagesToSrcset, `<img src="/assets/only-1x.png">`, options),
+	)
+	assert.Equal(t, []string{"Image /assets/only-1x.png has no high-DPI variant (expected " +
+		filepath.Join(dir, "only-1x@2x.png") + ")"}, warnings)
+
+	// SVGs, images from elsewhere, and images with a srcset are left alone
+	for _, img := range []string{
+		`<img src="/assets/diagram.svg">`,
+		`<img src="https://example.com/both.png">`,
+		`<img src="/assets/both.png" srcset="/assets/both.png 1x">`,
+	} {
+		assert.Equal(t, img, mustTransform(t, transformImagesToSrcset, img, options))
+	}
+
+	// Without an image directory there's nothing to check against
+	assert.Equal(t,
+		`<img src="/assets/both.png">`,
+		mustTransform(t, transformImagesToSrcset, `<img src="/assets/both.png">`, nil),
+	)
+}
+
+func TestTransformImagesToSrcsetWithVariants(t *testing.T) {
+	options := &RenderOptions{
+		ImageVariants: map[string][]*ImageVariant{
+			"/assets/photo.jpg": {
+				{Density: 1, Height: 300, URL: "/assets/photo.jpg", Width: 400},
+				{Density: 2, Height: 600, URL: "/assets/photo@2x.jpg", Width: 800},
+			},
+			"/assets/wide.jpg": {
+				{Density: 1, Height: 500, URL: "/assets/wide.jpg", Width: 1000},
+				{Density: 2, Height: 1000, URL: "/assets/wide@2x.jpg", Width: 2000},
+				{Height: 250, URL: "/assets/wide-500w.jpg", Width: 500},
+			},
+		},
+	}
+
+	assert.Equal(t,
+		`<img src="/assets/photo.jpg" srcset="/assets/photo.jpg 1x, /assets/photo@2x.jpg 2x">`,
+		mustTransform(t, transformImagesToSrcset, `<img src="/assets/photo.jpg">`, options),
+	)
+
+	// Width descriptors are used for everything when there are any
+	assert.Equal(t,
+		`<img src="/assets/wide.jpg" srcset="/assets/wide-500w.jpg 500w, /assets/wide.jpg 1000w, /assets/wide@2x.jpg 2000w">`,
+		mustTransform(t, transformImagesToSrcset, `<img src="/assets/wide.jpg">`, options),
+	)
+
+	// Figures get their dimensions and link from variants
+	rendered, err := Render(`!fig src="/assets/photo.jpg"`, options)
+	assert.NoError(t, err)
+	assert.Contains(t, rendered, `<a href="/assets/photo@2x.jpg"><img src="/assets/photo.jpg" `+
+		`srcset="/assets/photo.jpg 1x, /assets/photo@2x.jpg 2x" alt="" width="400" height="300" class="overflowing"></a>`)
+}
+
+func TestTransformAssetURLs(t *testing.T) {
+	var warnings []string
+	options := &RenderOptions{
+		AssetURLs: map[string]string{
+			"/assets/hello.jpg":    "/assets/hello.1a2b3c4d5e.jpg",
+			"/assets/hello@2x.jpg": "/assets/hello@2x.5e4d3c2b1a.jpg",
+		},
+		ImageURL: "/assets/",
+		Warn:     func(message string) { warnings = append(warnings, message) },
+	}
+
+	assert.Equal(t,
+		`<img src="/assets/hello.1a2b3c4d5e.jpg" srcset="/assets/hello.1a2b3c4d5e.jpg 1x, /assets/hello@2x.5e4d3c2b1a.jpg 2x">`,
+		mustTransform(t, transformAssetURLs,
+			`<img src="/assets/hello.jpg" srcset="/assets/hello.jpg 1x, /assets/hello@2x.jpg 2x">`, options),
+	)
+
+	assert.Equal(t,
+		`<a href="/assets/hello.1a2b3c4d5e.jpg">Hello</a> <a href="/articles/hello">Hello</a>`,
+		mustTransform(t, transformAssetURLs,
+			`<a href="/assets/hello.jpg">Hello</a> <a href="/articles/hello">Hello</a>`, options),
+	)
+
+	// Retina.JS is pointed at the fingerprinted "@2x" variant
+	assert.Equal(t,
+		`<img data-rjs="/assets/hello@2x.5e4d3c2b1a.jpg" src="/assets/hello.1a2b3c4d5e.jpg">`,
+		mustTransform(t, transformAssetURLs, `<img data-rjs="2" src="/assets/hello.jpg">`, options),
+	)
+
+	// Assets that don't exist are left alone with a warning
+	assert.Equal(t,
+		`<img src="/assets/missing.jpg">`,
+		mustTransform(t, transformAssetURLs, `<img src="/assets/missing.jpg">`, options),
+	)
+	assert.Equal(t, []string{"Asset /assets/missing.jpg doesn't exist"}, warnings)
+
+	// Nothing changes without any asset URLs
 	assert.Equal(t,
 		`<img src="/assets/hello.jpg">`,
-		transformImagesToRetina(
-			`<img src="/assets/hello.jpg">`,
-			&RenderOptions{NoRetina: true},
-		),
+		mustTransform(t, transformAssetURLs, `<img src="/assets/hello.jpg">`, nil),
+	)
+}
+
+func TestTransformURLsToAbsolute(t *testing.T) {
+	options := &RenderOptions{
+		AbsoluteURLs: true,
+		BaseURL:      "https://example.com/articles/hello",
+	}
+
+	// Root-relative
+	assert.Equal(t,
+		`<img src="https://example.com/assets/hello.jpg">`,
+		mustTransform(t, transformURLsToAbsolute, `<img src="/assets/hello.jpg">`, options),
+	)
+	assert.Equal(t,
+		`<a href="https://example.com/articles/other">Other</a>`,
+		mustTransform(t, transformURLsToAbsolute, `<a href="/articles/other">Other</a>`, options),
+	)
+
+	// Every candidate in a srcset
+	assert.Equal(t,
+		`<img src="https://example.com/assets/hello.jpg" srcset="https://example.com/assets/hello.jpg 1x, https://example.com/assets/hello@2x.jpg 2x">`,
+		mustTransform(t, transformURLsToAbsolute,
+			`<img src="/assets/hello.jpg" srcset="/assets/hello.jpg 1x, /assets/hello@2x.jpg 2x">`, options),
+	)
+
+	// Document-relative
+	assert.Equal(t,
+		`<img src="https://example.com/articles/hello.jpg">`,
+		mustTransform(t, transformURLsToAbsolute, `<img src="hello.jpg">`, options),
+	)
+
+	// Fragments resolve to the document itself
+	assert.Equal(t,
+		`<a href="https://example.com/articles/hello#footnote-1">1</a>`,
+		mustTransform(t, transformURLsToAbsolute, `<a href="#footnote-1">1</a>`, options),
+	)
+
+	// Other attributes are preserved
+	assert.Equal(t,
+		`<img class="overflowing" data-rjs="2" src="https://example.com/assets/hello.jpg">`,
+		mustTransform(t, transformURLsToAbsolute, `<img class="overflowing" data-rjs="2" src="/assets/hello.jpg">`, options),
+	)
+
+	// Already absolute URLs are left alone
+	assert.Equal(t,
+		`<a href="https://example.org/">Hello</a>`,
+		mustTransform(t, transformURLsToAbsolute, `<a href="https://example.org/">Hello</a>`, options),
+	)
+	assert.Equal(t,
+		`<a href="mailto:hello@example.com">Hello</a>`,
+		mustTransform(t, transformURLsToAbsolute, `<a href="mailto:hello@example.com">Hello</a>`, options),
 	)
+
+	// Other markup isn't touched
+	assert.Equal(t,
+		"<p>Hello <em>there</em>.</p>\n",
+		mustTransform(t, transformURLsToAbsolute, "<p>Hello <em>there</em>.</p>\n", options),
+	)
+
+	// Nothing happens unless the option is set.
+	assert.Equal(t,
+		`<img src="/assets/hello.jpg">`,
+		mustTransform(t, transformURLsToAbsolute, `<img src="/assets/hello.jpg">`, nil),
+	)
+
+	// A base URL that isn't absolute is an error
+	_, err := transformURLsToAbsolute(`<img src="/assets/hello.jpg">`,
+		&RenderOptions{AbsoluteURLs: true, BaseURL: "/articles/hello"})
+	assert.Equal(t, `BaseURL should be an absolute URL, but was "/articles/hello"`, err.Error())
+}
+
+func TestRenderAbsoluteURLs(t *testing.T) {
+	options := &RenderOptions{
+		AbsoluteURLs: true,
+		BaseURL:      "https://example.com/articles/hello",
+	}
+
+	// Figures
+	rendered, err := Render(`!fig src="/assets/fig.svg" caption="Caption."`, options)
+	assert.NoError(t, err)
+	assert.Equal(t, `<figure>
+  <p><a href="https://example.com/assets/fig.svg"><img src="https://example.com/assets/fig.svg" alt="" class="overflowing"></a></p>
+  <figcaption><span class="figure-number">Figure 1:</span> Caption.</figcaption>
+</figure>
+`, rendered)
+
+	// Footnotes
+	rendered, err = Render("Reference [^1].\n\n[^1]: Footnote.", options)
+	assert.NoError(t, err)
+	assert.Contains(t, rendered,
+		`<a href="https://example.com/articles/hello#footnote-1">1</a>`)
+	assert.Contains(t, rendered,
+		`<a href="https://example.com/articles/hello#footnote-1-source">1</a>`)
+}
+
+// Runs a transform that's expected to succeed and returns its result.
+func mustTransform(t *testing.T, f TransformFunc, source string, options *RenderOptions) string {
+	transformed, err := f(source, options)
+	assert.NoError(t, err)
+	return transformed
 }
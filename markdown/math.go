@@ -0,0 +1,326 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/brandur/singularity/mathml"
+)
+
+// Replaces TeX math in the source with MathML so that it can be typeset
+// without any JavaScript. Math follows the same rules as Pandoc:
+//
+//	Inline math like $e^{i\pi} = -1$ sits within a line.
+//
+//	$$
+//	\sum_{i=1}^n i = \frac{n(n+1)}{2}
+//	$$
+//
+// Inline math has to start with a non-space character and end with one, and
+// the closing dollar can't be followed by a digit, so prose like "between $5
+// and $10" is left alone. Display math may span lines, and is rendered as a
+// block of its own when it makes up a whole paragraph. A literal dollar sign
+// can be written as "\$".
+//
+// Math in code blocks, code spans, and raw HTML blocks is left alone, and so
+// are the URLs of links and images, autolinks, and inline HTML.
+func transformMath(source string, options *RenderOptions) (string, error) {
+	lines := strings.Split(source, "\n")
+
+	var out []string
+	prose := 0
+
+	// Converts the run of prose lines since the last literal one.
+	flush := func(end int) error {
+		if prose == end {
+			return nil
+		}
+
+		converted, err := convertMath(strings.Join(lines[prose:end], "\n"), prose+1)
+		if err != nil {
+			return err
+		}
+
+		out = append(out, converted)
+		return nil
+	}
+
+	for i, literal := range literalLines(lines) {
+		if !literal {
+			continue
+		}
+
+		err := flush(i)
+		if err != nil {
+			return "", err
+		}
+
+		out = append(out, lines[i])
+		prose = i + 1
+	}
+
+	err := flush(len(lines))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(out, "\n"), nil
+}
+
+// Matches an autolink like <https://example.com> or <me@example.com>, an HTML
+// tag, or an HTML comment at the start of a string.
+var inlineHTMLRE = regexp.MustCompile(`^(?:<[a-zA-Z][a-zA-Z0-9+.\-]{1,31}:[^<>\s]*>|` +
+	`<[^<>\s@]+@[^<>\s]+>|</?[a-zA-Z][a-zA-Z0-9\-]*(?:\s[^<>]*)?/?>|(?s:<!--.*?-->))`)
+
+// Matches the start of a link reference definition like "[label]: url" up to
+// the end of its URL. Footnote definitions aren't matched.
+var linkDefinitionRE = regexp.MustCompile(`^ {0,3}\[[^\]^][^\]]*\]:[ \t]*\S+`)
+
+// Converts the math in a run of prose whose first line is at firstLine in the
+// original source.
+func convertMath(s string, firstLine int) (string, error) {
+	var b bytes.Buffer
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], `\\`):
+			b.WriteString(`\\`)
+			i++
+
+		case strings.HasPrefix(s[i:], `\$`):
+			b.WriteByte('$')
+			i++
+
+		case s[i] == '`':
+			// An unclosed run of backticks is just text.
+			n := countRun(s, i, '`')
+			end := findCodeSpanEnd(s, i+n, n)
+			if end == -1 {
+				end = i + n
+			}
+			b.WriteString(s[i:end])
+			i = end - 1
+
+		case (i == 0 || s[i-1] == '\n') && linkDefinitionRE.MatchString(s[i:]):
+			definition := linkDefinitionRE.FindString(s[i:])
+			b.WriteString(definition)
+			i += len(definition) - 1
+
+		case strings.HasPrefix(s[i:], "]("):
+			// The URL of a link or image, up to the parenthesis that closes
+			// it. One that's never closed isn't a URL.
+			end := findLinkDestinationEnd(s, i+2)
+			if end == -1 {
+				b.WriteByte(s[i])
+				continue
+			}
+			b.WriteString(s[i:end])
+			i = end - 1
+
+		case s[i] == '<' && inlineHTMLRE.MatchString(s[i:]):
+			html := inlineHTMLRE.FindString(s[i:])
+			b.WriteString(html)
+			i += len(html) - 1
+
+		case strings.HasPrefix(s[i:], "$$"):
+			start := i + 2
+			end := strings.Index(s[start:], "$$")
+			if end == -1 {
+				return "", &Error{Line: lineAt(s, i, firstLine),
+					Message: "Display math is never closed with $$"}
+			}
+			end += start
+
+			block := isParagraphStart(s, i) && isParagraphEnd(s, end+2)
+			html, err := renderMath(s, start, end, firstLine, true)
+			if err != nil {
+				return "", err
+			}
+
+			b.WriteString(mathPlaceholder(html, strings.Count(s[i:end+2], "\n")))
+
+			// Blackfriday only recognizes a comment as a block when it's
+			// followed by a newline.
+			if block && end+2 == len(s) {
+				b.WriteString("\n")
+			}
+
+			i = end + 1
+
+		case s[i] == '$':
+			end := findInlineMathEnd(s, i+1)
+			if end == -1 {
+				b.WriteByte('$')
+				continue
+			}
+
+			html, err := renderMath(s, i+1, end, firstLine, false)
+			if err != nil {
+				return "", err
+			}
+
+			b.WriteString(mathPlaceholder(html, strings.Count(s[i:end], "\n")))
+			i = end
+
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String(), nil
+}
+
+// Counts the run of a character starting at i.
+func countRun(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+// Finds the end of a code span opened by n backticks, which is closed by a
+// run of exactly as many. Returns the index just after the closing run, or -1
+// if the span is never closed.
+func findCodeSpanEnd(s string, start, n int) int {
+	for i := start; i < len(s); {
+		if s[i] != '`' {
+			i++
+			continue
+		}
+
+		run := countRun(s, i, '`')
+		if run == n {
+			return i + n
+		}
+		i += run
+	}
+	return -1
+}
+
+// Finds the parenthesis that closes a link's destination and title starting
+// at start, which like Blackfriday is the first one that isn't escaped.
+// Returns the index just after it, or -1 if there isn't one before the end of
+// the paragraph.
+func findLinkDestinationEnd(s string, start int) int {
+	for i := start; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+
+		case strings.HasPrefix(s[i:], "\n\n"):
+			return -1
+
+		case s[i] == ')':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// Finds the closing dollar of inline math whose content starts at start.
+// Returns -1 if there isn't one, in which case the opening dollar is just
+// text.
+func findInlineMathEnd(s string, start int) int {
+	if start >= len(s) || isSpace(s[start]) || s[start] == '$' {
+		return -1
+	}
+
+	for i := start; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			// Skips escapes like \$ and \\
+			i++
+
+		case strings.HasPrefix(s[i:], "\n\n"):
+			// Inline math can't span paragraphs.
+			return -1
+
+		case s[i] == '$':
+			if isSpace(s[i-1]) || (i+1 < len(s) && isDigit(s[i+1])) {
+				continue
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+// Checks whether the position is at the start of a paragraph, with nothing
+// but whitespace before it on its line and a blank line (or the start of the
+// source) before that.
+func isParagraphStart(s string, i int) bool {
+	lineStart := strings.LastIndex(s[:i], "\n") + 1
+	if strings.TrimSpace(s[lineStart:i]) != "" {
+		return false
+	}
+	if lineStart == 0 {
+		return true
+	}
+
+	previousStart := strings.LastIndex(s[:lineStart-1], "\n") + 1
+	return strings.TrimSpace(s[previousStart:lineStart-1]) == ""
+}
+
+// Checks whether the position is at the end of a paragraph, with nothing but
+// whitespace after it on its line and a blank line (or the end of the source)
+// after that.
+func isParagraphEnd(s string, i int) bool {
+	lineEnd := strings.Index(s[i:], "\n")
+	if lineEnd == -1 {
+		return strings.TrimSpace(s[i:]) == ""
+	}
+	lineEnd += i
+	if strings.TrimSpace(s[i:lineEnd]) != "" {
+		return false
+	}
+
+	nextEnd := strings.Index(s[lineEnd+1:], "\n")
+	if nextEnd == -1 {
+		return strings.TrimSpace(s[lineEnd+1:]) == ""
+	}
+	return strings.TrimSpace(s[lineEnd+1:lineEnd+1+nextEnd]) == ""
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+// Gets the line in the original source of a position in a run of prose.
+func lineAt(s string, i, firstLine int) int {
+	return firstLine + strings.Count(s[:i], "\n")
+}
+
+// Wraps rendered math in a placeholder. The placeholder is given the same
+// number of lines as the math that it replaces so that later transforms still
+// report problems on the right lines. Newlines are ignored when the
+// placeholder is decoded.
+func mathPlaceholder(html string, newlines int) string {
+	placeholder := directivePlaceholder(html)
+	return placeholder[:len(placeholder)-len(directivePlaceholderSuffix)] +
+		strings.Repeat("\n", newlines) + directivePlaceholderSuffix
+}
+
+// Renders the math between start and end, turning any syntax error into an
+// *Error pointing at the line and column where it was found.
+func renderMath(s string, start, end, firstLine int, display bool) (string, error) {
+	html, err := mathml.Render(s[start:end], display)
+	if err != nil {
+		mathErr, ok := err.(*mathml.Error)
+		if !ok {
+			return "", err
+		}
+
+		i := start + mathErr.Offset
+		column := i - strings.LastIndex(s[:i], "\n")
+		return "", &Error{Line: lineAt(s, i, firstLine), Message: fmt.Sprintf(
+			"Error in math: %v (column %v)", mathErr.Message, column)}
+	}
+	return html, nil
+}
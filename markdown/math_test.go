@@ -0,0 +1,90 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestRenderMath(t *testing.T) {
+	rendered, err := Render(`Euler: $e^{i\pi} = -1$.`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `<p>Euler: <math xmlns="http://www.w3.org/1998/Math/MathML"><semantics>`+
+		`<mrow><msup><mi>e</mi><mrow><mi>i</mi><mi>π</mi></mrow></msup><mo>=</mo><mo>−</mo><mn>1</mn></mrow>`+
+		`<annotation encoding="application/x-tex">e^{i\pi} = -1</annotation></semantics></math>.</p>`+"\n", rendered)
+
+	// Display math in a paragraph of its own isn't wrapped in one
+	rendered, err = Render("Sum:\n\n$$\n\\sum_i i\n$$\n\nDone.", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `<p>Sum:</p>
+
+<math xmlns="http://www.w3.org/1998/Math/MathML" display="block"><semantics>`+
+		`<mrow><munder><mo>∑</mo><mi>i</mi></munder><mi>i</mi></mrow>`+
+		`<annotation encoding="application/x-tex">
+\sum_i i
+</annotation></semantics></math>
+
+<p>Done.</p>
+`, rendered)
+
+	// Including at the end of the document
+	rendered, err = Render("$$x$$", nil)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(rendered, `<math `), rendered)
+
+	// Math in the text of a link is still rendered
+	rendered, err = Render("[$x$](/x) and $y$ < 1 and $z$ > 0.", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(rendered, "<math "), rendered)
+	assert.Contains(t, rendered, `<a href="/x"><math `)
+
+	// Display math within a paragraph stays inline
+	rendered, err = Render("Where $$x$$ is.", nil)
+	assert.NoError(t, err)
+	assert.Contains(t, rendered, `<p>Where <math xmlns="http://www.w3.org/1998/Math/MathML" display="block">`)
+}
+
+func TestRenderMathLeftAlone(t *testing.T) {
+	testCases := []struct {
+		source   string
+		expected string
+	}{
+		{`Between $5 and $10.`, "<p>Between $5 and $10.</p>\n"},
+		{`From $ x $.`, "<p>From $ x $.</p>\n"},
+		{`Costs \$x\$.`, "<p>Costs $x$.</p>\n"},
+		{"Code `$x$` and ``a ` $y$``.", "<p>Code <code>$x$</code> and <code>a ` $y$</code>.</p>\n"},
+		{"```\n$x$\n```", "<pre><code>$x$\n</code></pre>\n"},
+		{"Split $x\n\ny$.", "<p>Split $x</p>\n\n<p>y$.</p>\n"},
+		{"Code:\n\n    x=$a$b\n    printf \\$HOME", "<p>Code:</p>\n\n<pre><code>x=$a$b\nprintf \\$HOME\n</code></pre>\n"},
+		{"- Item:\n\n        x=$a$b", "<ul>\n<li><p>Item:</p>\n\n<pre><code>x=$a$b\n</code></pre></li>\n</ul>\n"},
+		{"<pre>$x$</pre>\n", "<pre>$x$</pre>\n"},
+		{"<div>\n\\$x\\$\n</div>\n\nAfter.", "<div>\n\\$x\\$\n</div>\n\n<p>After.</p>\n"},
+		{"[a](http://x.com/$a$b)", `<p><a href="http://x.com/$a$b">a</a></p>` + "\n"},
+		{"![a](/$a$\\(b\\).png \"$t$\")", `<p><img src="/$a$(b).png" alt="a" title="$t$" /></p>` + "\n"},
+		{"[a][x]\n\n[x]: http://x.com/$a$b", `<p><a href="http://x.com/$a$b">a</a></p>` + "\n"},
+		{"<http://x.com/$a$b>", `<p><a href="http://x.com/$a$b">http://x.com/$a$b</a></p>` + "\n"},
+		{`A <span title="$a$b">c</span>.`, `<p>A <span title="$a$b">c</span>.</p>` + "\n"},
+	}
+
+	for _, testCase := range testCases {
+		rendered, err := Render(testCase.source, nil)
+		assert.NoError(t, err, testCase.source)
+		assert.Equal(t, testCase.expected, rendered, testCase.source)
+	}
+}
+
+func TestRenderMathErrors(t *testing.T) {
+	_, err := Render("Text.\n\nSee $x^2^3$.", nil)
+	assert.Equal(t, `line 3: Error in math: Double superscript (column 9)`, err.Error())
+
+	_, err = Render("$$\n\\frac{1}\n$$", nil)
+	assert.Equal(t, `line 2: Error in math: Missing argument for \frac (column 9)`, err.Error())
+
+	_, err = Render("Text.\n\n$$\nx", nil)
+	assert.Equal(t, `line 3: Display math is never closed with $$`, err.Error())
+
+	// Lines after multi-line math are still reported correctly
+	_, err = Render("$$\nx\n$$\n\n!fig", nil)
+	assert.Equal(t, `line 5: Directive !fig is missing required attribute "src"`, err.Error())
+}
@@ -0,0 +1,254 @@
+package markdown
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Names of the transforms in the default pipeline. They can be used to
+// enable or disable transforms through RenderOptions, or to order new
+// transforms relative to them.
+const (
+	TransformAbsoluteURLs  = "absolute-urls"
+	TransformAnchorAliases = "anchor-aliases"
+	TransformAssetURLs     = "asset-urls"
+	TransformDirectives    = "directives"
+	TransformMath          = "math"
+	TransformRetinaImages  = "retina-images"
+	TransformSpacingDivs   = "spacing-divs"
+	TransformSrcset        = "srcset"
+	TransformWikiLinks     = "wiki-links"
+)
+
+// Stage is the point in rendering at which a transform runs.
+type Stage int
+
+// The stages of a render pipeline.
+const (
+	// PreRender transforms run on Markdown source before it's rendered.
+	PreRender Stage = iota
+
+	// PostRender transforms run on HTML after Markdown has been rendered.
+	PostRender
+)
+
+// String returns a human-readable name for the stage.
+func (s Stage) String() string {
+	switch s {
+	case PreRender:
+		return "pre-render"
+	case PostRender:
+		return "post-render"
+	}
+	return fmt.Sprintf("Stage(%d)", int(s))
+}
+
+// TransformFunc transforms a document. It receives Markdown source for
+// pre-render transforms and HTML for post-render transforms.
+//
+// Problems in the document should be returned as an error rather than
+// producing bad output. Use *Error for problems that can be tied to a line in
+// Markdown source.
+type TransformFunc func(source string, options *RenderOptions) (string, error)
+
+// Transform is a named step in a render pipeline.
+type Transform struct {
+	// Disabled leaves the transform out of renders unless it's named in
+	// RenderOptions.Enable.
+	Disabled bool
+
+	// Func performs the transform.
+	Func TransformFunc
+
+	// Name uniquely identifies the transform within a pipeline.
+	Name string
+
+	// Order determines when the transform runs relative to others in the same
+	// stage. Transforms run in ascending order, and those with the same order
+	// run in the order that they were registered. Transforms in the default
+	// pipeline are spaced 100 apart to leave room between them.
+	Order int
+
+	// Stage is the point in rendering at which the transform runs.
+	Stage Stage
+}
+
+// Pipeline renders Markdown to HTML along with a customizable set of
+// transforms that run before and after the Markdown itself is rendered.
+//
+// Transforms should all be registered before a pipeline is used, after which
+// it's safe to render with it concurrently.
+type Pipeline struct {
+	directives map[string]*DirectiveHandler
+	transforms []*Transform
+}
+
+// NewPipeline initializes a pipeline containing the default transforms. The
+// default transforms may be disabled per call through RenderOptions.
+func NewPipeline() *Pipeline {
+	p := &Pipeline{directives: make(map[string]*DirectiveHandler)}
+
+	// Transforms and directives are copied so that changes to one pipeline
+	// can't affect any other.
+	for _, t := range defaultTransforms {
+		t := *t
+		p.transforms = append(p.transforms, &t)
+	}
+
+	for name, handler := range defaultDirectives {
+		p.directives[name] = handler
+	}
+
+	// Directives are looked up in the pipeline's own registry.
+	p.transforms = append(p.transforms, &Transform{
+		Name: TransformDirectives, Func: p.transformDirectives, Order: 100, Stage: PreRender,
+	})
+
+	return p
+}
+
+// The transforms of the default pipeline.
+var defaultTransforms = []*Transform{
+	{Name: TransformMath, Func: transformMath, Order: 50, Stage: PreRender},
+	{Name: TransformWikiLinks, Func: transformWikiLinks, Order: 75, Stage: PreRender},
+
+	{Name: TransformSpacingDivs, Func: addSpacingDivs, Order: 100, Stage: PostRender},
+	{Name: TransformAnchorAliases, Func: transformAnchorAliases, Order: 200, Stage: PostRender},
+	{Name: TransformSrcset, Func: transformImagesToSrcset, Order: 300, Stage: PostRender},
+	{Name: TransformRetinaImages, Func: transformImagesToRetina, Order: 350, Stage: PostRender, Disabled: true},
+	{Name: TransformAssetURLs, Func: transformAssetURLs, Order: 375, Stage: PostRender},
+	{Name: TransformAbsoluteURLs, Func: transformURLsToAbsolute, Order: 400, Stage: PostRender},
+}
+
+// Used by Render.
+var defaultPipeline = NewPipeline()
+
+// Register adds a transform to the pipeline. Names must be unique.
+func (p *Pipeline) Register(t *Transform) error {
+	if t.Name == "" {
+		return fmt.Errorf("Transform must have a name")
+	}
+
+	if t.Func == nil {
+		return fmt.Errorf("Transform %q must have a function", t.Name)
+	}
+
+	if t.Stage != PreRender && t.Stage != PostRender {
+		return fmt.Errorf("Transform %q has an unknown stage: %v", t.Name, t.Stage)
+	}
+
+	if p.lookup(t.Name) != nil {
+		return fmt.Errorf("Transform %q is already registered", t.Name)
+	}
+
+	p.transforms = append(p.transforms, t)
+	return nil
+}
+
+// Render renders Markdown to HTML while applying the pipeline's transforms.
+//
+// Problems in the source like references to undefined footnotes are returned
+// as an *Error.
+func (p *Pipeline) Render(source string, options *RenderOptions) (string, error) {
+	enabled, err := p.enabled(options)
+	if err != nil {
+		return "", err
+	}
+
+	source, err = p.runStage(PreRender, enabled, source, options)
+	if err != nil {
+		return "", err
+	}
+
+	source, err = renderMarkdown(source, options)
+	if err != nil {
+		return "", err
+	}
+
+	return p.runStage(PostRender, enabled, source, options)
+}
+
+// Transforms returns the names of the transforms that run in the given stage
+// in the order that they run, including any that are disabled by default.
+func (p *Pipeline) Transforms(stage Stage) []string {
+	var names []string
+	for _, t := range p.ordered(stage) {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// Decides which transforms are enabled for a render based on their defaults
+// and any overrides in options. Naming a transform that doesn't exist is an
+// error so that typos don't go unnoticed.
+func (p *Pipeline) enabled(options *RenderOptions) (map[string]bool, error) {
+	enabled := make(map[string]bool)
+	for _, t := range p.transforms {
+		enabled[t.Name] = !t.Disabled
+	}
+
+	if options == nil {
+		return enabled, nil
+	}
+
+	for _, name := range options.Enable {
+		if _, ok := enabled[name]; !ok {
+			return nil, fmt.Errorf("Can't enable unknown transform %q", name)
+		}
+		enabled[name] = true
+	}
+
+	for _, name := range options.Disable {
+		if _, ok := enabled[name]; !ok {
+			return nil, fmt.Errorf("Can't disable unknown transform %q", name)
+		}
+		enabled[name] = false
+	}
+
+	return enabled, nil
+}
+
+func (p *Pipeline) lookup(name string) *Transform {
+	for _, t := range p.transforms {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// Gets the transforms of a stage sorted by the order in which they run.
+func (p *Pipeline) ordered(stage Stage) []*Transform {
+	var transforms []*Transform
+	for _, t := range p.transforms {
+		if t.Stage == stage {
+			transforms = append(transforms, t)
+		}
+	}
+
+	sort.SliceStable(transforms, func(i, j int) bool {
+		return transforms[i].Order < transforms[j].Order
+	})
+
+	return transforms
+}
+
+func (p *Pipeline) runStage(stage Stage, enabled map[string]bool, source string, options *RenderOptions) (string, error) {
+	var err error
+	for _, t := range p.ordered(stage) {
+		if !enabled[t.Name] {
+			continue
+		}
+
+		source, err = t.Func(source, options)
+		if err != nil {
+			// Errors tied to a line are left as they are so that callers can
+			// map the line back to a file.
+			if _, ok := err.(*Error); ok {
+				return "", err
+			}
+			return "", fmt.Errorf("Error in %v transform %q: %v", stage, t.Name, err)
+		}
+	}
+	return source, nil
+}
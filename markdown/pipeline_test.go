@@ -0,0 +1,141 @@
+package markdown
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestPipelineDefault(t *testing.T) {
+	p := NewPipeline()
+
+	assert.Equal(t,
+		[]string{TransformMath, TransformWikiLinks, TransformDirectives},
+		p.Transforms(PreRender))
+	assert.Equal(t,
+		[]string{TransformSpacingDivs, TransformAnchorAliases, TransformSrcset, TransformRetinaImages,
+			TransformAssetURLs, TransformAbsoluteURLs},
+		p.Transforms(PostRender))
+
+	// The default pipeline is the one used by Render
+	rendered, err := p.Render("**strong**", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "<p><strong>strong</strong></p>\n", rendered)
+}
+
+func TestPipelineRegister(t *testing.T) {
+	p := NewPipeline()
+
+	err := p.Register(&Transform{
+		Name:  "shout",
+		Func:  func(s string, _ *RenderOptions) (string, error) { return strings.ToUpper(s), nil },
+		Order: 150,
+		Stage: PreRender,
+	})
+	assert.NoError(t, err)
+
+	err = p.Register(&Transform{
+		Name:  "wrap",
+		Func:  func(s string, _ *RenderOptions) (string, error) { return "<div>" + s + "</div>", nil },
+		Order: 1000,
+		Stage: PostRender,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t,
+		[]string{TransformMath, TransformWikiLinks, TransformDirectives, "shout"},
+		p.Transforms(PreRender))
+
+	rendered, err := p.Render("hello", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "<div><p>HELLO</p>\n</div>", rendered)
+
+	// Registering doesn't affect other pipelines
+	rendered, err = Render("hello", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "<p>hello</p>\n", rendered)
+
+	err = p.Register(&Transform{Name: "shout", Func: transformMath})
+	assert.Equal(t, `Transform "shout" is already registered`, err.Error())
+
+	err = p.Register(&Transform{Name: "nothing"})
+	assert.Equal(t, `Transform "nothing" must have a function`, err.Error())
+
+	err = p.Register(&Transform{Func: transformMath})
+	assert.Equal(t, "Transform must have a name", err.Error())
+}
+
+func TestPipelineEnableDisable(t *testing.T) {
+	p := NewPipeline()
+
+	err := p.Register(&Transform{
+		Disabled: true,
+		Name:     "shout",
+		Func:     func(s string, _ *RenderOptions) (string, error) { return strings.ToUpper(s), nil },
+		Stage:    PostRender,
+	})
+	assert.NoError(t, err)
+
+	// Disabled by default
+	rendered, err := p.Render("hello", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "<p>hello</p>\n", rendered)
+
+	rendered, err = p.Render("hello", &RenderOptions{Enable: []string{"shout"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "<P>HELLO</P>\n", rendered)
+
+	// Disable takes precedence
+	rendered, err = p.Render("hello", &RenderOptions{
+		Disable: []string{"shout"},
+		Enable:  []string{"shout"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "<p>hello</p>\n", rendered)
+
+	// Default transforms can be enabled and disabled too
+	rendered, err = p.Render("<img src=\"a.png\">", &RenderOptions{
+		Enable: []string{TransformRetinaImages},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "<p><img data-rjs=\"2\" src=\"a.png\"></p>\n", rendered)
+
+	rendered, err = p.Render("## A\n\n## B", &RenderOptions{
+		Disable: []string{TransformSpacingDivs},
+	})
+	assert.NoError(t, err)
+	assert.NotContains(t, rendered, "ring")
+
+	_, err = p.Render("hello", &RenderOptions{Enable: []string{"whisper"}})
+	assert.Equal(t, `Can't enable unknown transform "whisper"`, err.Error())
+
+	_, err = p.Render("hello", &RenderOptions{Disable: []string{"whisper"}})
+	assert.Equal(t, `Can't disable unknown transform "whisper"`, err.Error())
+}
+
+func TestPipelineErrors(t *testing.T) {
+	p := NewPipeline()
+
+	err := p.Register(&Transform{
+		Name:  "fail",
+		Func:  func(s string, _ *RenderOptions) (string, error) { return "", fmt.Errorf("bad HTML") },
+		Stage: PostRender,
+	})
+	assert.NoError(t, err)
+
+	err = p.Register(&Transform{
+		Name:  "fail-on-line",
+		Func:  func(s string, _ *RenderOptions) (string, error) { return "", &Error{Line: 3, Message: "bad"} },
+		Stage: PreRender,
+	})
+	assert.NoError(t, err)
+
+	// Errors tied to a line are returned unchanged
+	_, err = p.Render("hello", nil)
+	assert.Equal(t, &Error{Line: 3, Message: "bad"}, err)
+
+	_, err = p.Render("hello", &RenderOptions{Disable: []string{"fail-on-line"}})
+	assert.Equal(t, `Error in post-render transform "fail": bad HTML`, err.Error())
+}
@@ -0,0 +1,857 @@
+// Package mathml converts a practical subset of TeX math to MathML so that
+// formulas can be typeset by browsers without any JavaScript.
+//
+// Supported are identifiers, numbers and operators; groups; superscripts and
+// subscripts; fractions and roots; Greek letters and common symbols; named
+// functions like \sin; big operators like \sum with limits; accents; text;
+// font styles like \mathbf and \mathbb; stretchy delimiters with \left and
+// \right; spacing; and the matrix, pmatrix, bmatrix, vmatrix, and cases
+// environments.
+package mathml
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Error is a syntax error in TeX source.
+type Error struct {
+	// Message describes the problem.
+	Message string
+
+	// Offset is the byte offset in the source at which the problem was found.
+	Offset int
+}
+
+// Error returns the error's message along with its offset.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v (at offset %v)", e.Message, e.Offset)
+}
+
+// Render converts TeX source to a MathML <math> element. Display math is
+// rendered as a block with big operators taking their limits above and below
+// them. The source is included as an annotation so that it's preserved when
+// formulas are copied.
+func Render(tex string, display bool) (string, error) {
+	p := &parser{display: display, src: tex}
+
+	atoms, err := p.parseSequence(endOfInput)
+	if err != nil {
+		return "", err
+	}
+
+	var attrs string
+	if display {
+		attrs = ` display="block"`
+	}
+
+	return fmt.Sprintf(`<math xmlns="http://www.w3.org/1998/Math/MathML"%s>`+
+		`<semantics>%s<annotation encoding="application/x-tex">%s</annotation></semantics>`+
+		`</math>`, attrs, row(atoms), html.EscapeString(tex)), nil
+}
+
+//
+// Parser
+//
+
+// What ends a sequence of atoms.
+type terminator int
+
+const (
+	endOfInput terminator = iota
+	endOfGroup
+	endOfLeft
+	endOfEnvironment
+	endOfOptional
+)
+
+// The message of errors produced when the source ends unexpectedly. Callers
+// that know what was left open replace these with something more useful.
+const messageEndOfInput = "Unexpected end of input"
+
+// An atom is a piece of rendered MathML that's a single element, and so can
+// be used as the base or script of another.
+type atom struct {
+	// Whether this is a big operator like \sum, which takes its limits above
+	// and below it in display math.
+	bigOperator bool
+
+	markup string
+}
+
+type parser struct {
+	display bool
+	pos     int
+	src     string
+
+	// A font style from a command like \mathbf that letters and numbers are
+	// currently being rendered in.
+	style string
+}
+
+// Parses atoms until the given terminator, which is left for the caller to
+// consume.
+func (p *parser) parseSequence(until terminator) ([]*atom, error) {
+	var atoms []*atom
+	for {
+		p.skipSpace()
+
+		if p.pos >= len(p.src) {
+			if until == endOfInput {
+				return atoms, nil
+			}
+			return nil, p.errorf(len(p.src), messageEndOfInput)
+		}
+
+		switch c := p.src[p.pos]; {
+		case c == '}':
+			if until == endOfGroup {
+				return atoms, nil
+			}
+			return nil, p.errorf(p.pos, "Unexpected }")
+
+		case c == ']' && until == endOfOptional:
+			return atoms, nil
+
+		case c == '&' || strings.HasPrefix(p.src[p.pos:], `\\`):
+			if until == endOfEnvironment {
+				return atoms, nil
+			}
+			if c == '&' {
+				return nil, p.errorf(p.pos, "& can only be used in an environment like matrix")
+			}
+			return nil, p.errorf(p.pos, `\\ can only be used in an environment like matrix`)
+
+		case c == '^' || c == '_':
+			// A script without a base is attached to an empty one.
+			atoms = append(atoms, &atom{markup: "<mrow></mrow>"})
+			err := p.parseScripts(atoms[len(atoms)-1])
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if p.peekCommand(`\right`) {
+			if until == endOfLeft {
+				return atoms, nil
+			}
+			return nil, p.errorf(p.pos, `\right without a matching \left`)
+		}
+
+		if p.peekCommand(`\end`) {
+			if until == endOfEnvironment {
+				return atoms, nil
+			}
+			return nil, p.errorf(p.pos, `\end without a matching \begin`)
+		}
+
+		a, err := p.parseAtom()
+		if err != nil {
+			return nil, err
+		}
+		if a == nil {
+			continue
+		}
+
+		err = p.parseScripts(a)
+		if err != nil {
+			return nil, err
+		}
+
+		atoms = append(atoms, a)
+	}
+}
+
+// Parses a single atom. Returns nil for things that don't produce any output.
+func (p *parser) parseAtom() (*atom, error) {
+	start := p.pos
+	c := p.src[p.pos]
+
+	switch {
+	case c == '{':
+		p.pos++
+		atoms, err := p.parseSequence(endOfGroup)
+		if err != nil {
+			if e, ok := err.(*Error); ok && e.Message == messageEndOfInput {
+				return nil, p.errorf(start, "Unclosed {")
+			}
+			return nil, err
+		}
+		p.pos++
+		return &atom{markup: row(atoms)}, nil
+
+	case c == '\\':
+		return p.parseCommand()
+
+	case c >= '0' && c <= '9' || c == '.' && p.pos+1 < len(p.src) && isDigit(p.src[p.pos+1]):
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos]) ||
+			p.src[p.pos] == '.' && p.pos+1 < len(p.src) && isDigit(p.src[p.pos+1])) {
+			p.pos++
+		}
+		return &atom{markup: element("mn", "", p.styled(p.src[start:p.pos]))}, nil
+
+	case c == '~':
+		p.pos++
+		return &atom{markup: `<mspace width="0.3333em"></mspace>`}, nil
+
+	case c == '#' || c == '%' || c == '$':
+		return nil, p.errorf(start, "Unsupported character %c", c)
+	}
+
+	r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+	p.pos += size
+
+	if unicode.IsLetter(r) {
+		return &atom{markup: element("mi", p.letterAttrs(), p.styled(string(r)))}, nil
+	}
+
+	if op, ok := operators[r]; ok {
+		return &atom{markup: element("mo", "", op)}, nil
+	}
+
+	return &atom{markup: element("mo", "", string(r))}, nil
+}
+
+// Parses a command starting with a backslash.
+func (p *parser) parseCommand() (*atom, error) {
+	start := p.pos
+	name := p.readCommand()
+
+	if name == `\` {
+		return nil, p.errorf(start, `Expected a command name after \`)
+	}
+
+	if s, ok := symbols[name]; ok {
+		return &atom{markup: element(s.element, s.attrs, s.text), bigOperator: s.bigOperator}, nil
+	}
+
+	if width, ok := spaces[name]; ok {
+		return &atom{markup: fmt.Sprintf(`<mspace width="%s"></mspace>`, width)}, nil
+	}
+
+	if accent, ok := accents[name]; ok {
+		base, err := p.parseArgument(name)
+		if err != nil {
+			return nil, err
+		}
+		return &atom{markup: fmt.Sprintf(`<mover accent="true">%s<mo>%s</mo></mover>`,
+			base.markup, accent)}, nil
+	}
+
+	if _, ok := styles[name]; ok {
+		outer := p.style
+		p.style = name
+		defer func() { p.style = outer }()
+
+		return p.parseArgument(name)
+	}
+
+	switch name {
+	case `\begin`:
+		return p.parseEnvironment(start)
+
+	case `\frac`:
+		numerator, err := p.parseArgument(name)
+		if err != nil {
+			return nil, err
+		}
+		denominator, err := p.parseArgument(name)
+		if err != nil {
+			return nil, err
+		}
+		return &atom{markup: "<mfrac>" + numerator.markup + denominator.markup + "</mfrac>"}, nil
+
+	case `\left`:
+		return p.parseLeft(start)
+
+	case `\operatorname`, `\text`:
+		text, err := p.readText(name)
+		if err != nil {
+			return nil, err
+		}
+		if name == `\text` {
+			return &atom{markup: element("mtext", "", text)}, nil
+		}
+		return &atom{markup: element("mi", "", text)}, nil
+
+	case `\sqrt`:
+		var index *atom
+		p.skipSpace()
+		if p.pos < len(p.src) && p.src[p.pos] == '[' {
+			optionStart := p.pos
+			p.pos++
+			atoms, err := p.parseSequence(endOfOptional)
+			if err != nil {
+				if e, ok := err.(*Error); ok && e.Message == messageEndOfInput {
+					return nil, p.errorf(optionStart, `Unclosed [ in \sqrt`)
+				}
+				return nil, err
+			}
+			p.pos++
+			index = &atom{markup: row(atoms)}
+		}
+
+		radicand, err := p.parseArgument(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if index != nil {
+			return &atom{markup: "<mroot>" + radicand.markup + index.markup + "</mroot>"}, nil
+		}
+		return &atom{markup: "<msqrt>" + radicand.markup + "</msqrt>"}, nil
+	}
+
+	return nil, p.errorf(start, "Unknown command %v", name)
+}
+
+// Parses an environment like \begin{pmatrix} a & b \\ c & d \end{pmatrix}.
+func (p *parser) parseEnvironment(start int) (*atom, error) {
+	name, err := p.readText(`\begin`)
+	if err != nil {
+		return nil, err
+	}
+
+	env, ok := environments[name]
+	if !ok {
+		var names []string
+		for name := range environments {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return nil, p.errorf(start, "Unknown environment %v (known environments are %v)",
+			name, strings.Join(names, ", "))
+	}
+
+	var rows [][]string
+	var cells []string
+	for {
+		atoms, err := p.parseSequence(endOfEnvironment)
+		if err != nil {
+			if e, ok := err.(*Error); ok && e.Message == messageEndOfInput {
+				return nil, p.errorf(start, `\begin{%v} without a matching \end{%v}`, name, name)
+			}
+			return nil, err
+		}
+		cells = append(cells, row(atoms))
+
+		switch {
+		case p.src[p.pos] == '&':
+			p.pos++
+
+		case strings.HasPrefix(p.src[p.pos:], `\\`):
+			p.pos += 2
+			rows = append(rows, cells)
+			cells = nil
+
+		default:
+			endStart := p.pos
+			p.readCommand()
+			end, err := p.readText(`\end`)
+			if err != nil {
+				return nil, err
+			}
+			if end != name {
+				return nil, p.errorf(endStart, `\begin{%v} ended by \end{%v}`, name, end)
+			}
+
+			// A trailing \\ doesn't start another row.
+			if len(cells) > 1 || cells[0] != "<mrow></mrow>" || len(rows) == 0 {
+				rows = append(rows, cells)
+			}
+
+			var b bytes.Buffer
+			b.WriteString("<mtable")
+			if env.columnAlign != "" {
+				b.WriteString(fmt.Sprintf(` columnalign="%s"`, env.columnAlign))
+			}
+			b.WriteString(">")
+			for _, cells := range rows {
+				b.WriteString("<mtr>")
+				for _, cell := range cells {
+					b.WriteString("<mtd>" + cell + "</mtd>")
+				}
+				b.WriteString("</mtr>")
+			}
+			b.WriteString("</mtable>")
+
+			table := b.String()
+			if env.left != "" || env.right != "" {
+				table = "<mrow>" + fence(env.left) + table + fence(env.right) + "</mrow>"
+			}
+			return &atom{markup: table}, nil
+		}
+	}
+}
+
+// Parses stretchy delimiters around an expression like \left( x \right).
+func (p *parser) parseLeft(start int) (*atom, error) {
+	left, err := p.readDelimiter(`\left`)
+	if err != nil {
+		return nil, err
+	}
+
+	atoms, err := p.parseSequence(endOfLeft)
+	if err != nil {
+		if e, ok := err.(*Error); ok && e.Message == messageEndOfInput {
+			return nil, p.errorf(start, `\left without a matching \right`)
+		}
+		return nil, err
+	}
+	p.readCommand()
+
+	right, err := p.readDelimiter(`\right`)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.WriteString("<mrow>")
+	b.WriteString(fence(left))
+	for _, a := range atoms {
+		b.WriteString(a.markup)
+	}
+	b.WriteString(fence(right))
+	b.WriteString("</mrow>")
+	return &atom{markup: b.String()}, nil
+}
+
+// Parses the required argument of a command, which is either a group or a
+// single atom.
+func (p *parser) parseArgument(command string) (*atom, error) {
+	// Errors point just after the command rather than at whatever follows
+	// it, which might be on another line.
+	start := p.pos
+
+	p.skipSpace()
+	if p.pos >= len(p.src) || p.src[p.pos] == '}' || p.src[p.pos] == '^' || p.src[p.pos] == '_' {
+		return nil, p.errorf(start, "Missing argument for %v", command)
+	}
+
+	// Like in TeX, an argument that isn't in braces is a single character,
+	// so \frac12 is one half.
+	if isDigit(p.src[p.pos]) {
+		p.pos++
+		return &atom{markup: element("mn", "", p.styled(p.src[p.pos-1:p.pos]))}, nil
+	}
+
+	a, err := p.parseAtom()
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		return &atom{markup: "<mrow></mrow>"}, nil
+	}
+	return a, nil
+}
+
+// Parses any superscript and subscript following an atom and attaches them
+// to it.
+func (p *parser) parseScripts(base *atom) error {
+	var sub, sup *atom
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			break
+		}
+
+		c := p.src[p.pos]
+		if c != '^' && c != '_' {
+			break
+		}
+
+		start := p.pos
+		p.pos++
+
+		script, err := p.parseArgument(string(c))
+		if err != nil {
+			return err
+		}
+
+		if c == '^' {
+			if sup != nil {
+				return p.errorf(start, "Double superscript")
+			}
+			sup = script
+		} else {
+			if sub != nil {
+				return p.errorf(start, "Double subscript")
+			}
+			sub = script
+		}
+	}
+
+	under, over, both := "msub", "msup", "msubsup"
+	if base.bigOperator && p.display {
+		under, over, both = "munder", "mover", "munderover"
+	}
+
+	switch {
+	case sub != nil && sup != nil:
+		base.markup = "<" + both + ">" + base.markup + sub.markup + sup.markup + "</" + both + ">"
+	case sub != nil:
+		base.markup = "<" + under + ">" + base.markup + sub.markup + "</" + under + ">"
+	case sup != nil:
+		base.markup = "<" + over + ">" + base.markup + sup.markup + "</" + over + ">"
+	default:
+		return nil
+	}
+
+	base.bigOperator = false
+	return nil
+}
+
+// Checks whether the source at the current position is the given command,
+// and not merely another command that starts with the same letters.
+func (p *parser) peekCommand(command string) bool {
+	if !strings.HasPrefix(p.src[p.pos:], command) {
+		return false
+	}
+	end := p.pos + len(command)
+	return end >= len(p.src) || !isLetter(p.src[end])
+}
+
+// Reads a command name including its backslash. Names are either letters or
+// a single other character like in `\,`.
+func (p *parser) readCommand() string {
+	start := p.pos
+	p.pos++
+
+	if p.pos < len(p.src) && isLetter(p.src[p.pos]) {
+		for p.pos < len(p.src) && isLetter(p.src[p.pos]) {
+			p.pos++
+		}
+	} else if p.pos < len(p.src) {
+		_, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.pos += size
+	}
+
+	return p.src[start:p.pos]
+}
+
+// Reads a delimiter following \left or \right.
+func (p *parser) readDelimiter(command string) (string, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return "", p.errorf(p.pos, "Missing delimiter after %v", command)
+	}
+
+	start := p.pos
+	if p.src[p.pos] == '\\' {
+		name := p.readCommand()
+		if delimiter, ok := delimiters[name]; ok {
+			return delimiter, nil
+		}
+		return "", p.errorf(start, "Unknown delimiter %v after %v", name, command)
+	}
+
+	r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+	p.pos += size
+	if delimiter, ok := delimiters[string(r)]; ok {
+		return delimiter, nil
+	}
+	return "", p.errorf(start, "Unknown delimiter %c after %v", r, command)
+}
+
+// Reads the literal text in braces following a command like \text.
+func (p *parser) readText(command string) (string, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) || p.src[p.pos] != '{' {
+		return "", p.errorf(p.pos, "Expected { after %v", command)
+	}
+
+	start := p.pos
+	depth := 0
+	for i := p.pos; i < len(p.src); i++ {
+		switch p.src[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				p.pos = i + 1
+				return p.src[start+1 : i], nil
+			}
+		}
+	}
+
+	return "", p.errorf(start, "Unclosed {")
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t' ||
+		p.src[p.pos] == '\n' || p.src[p.pos] == '\r') {
+		p.pos++
+	}
+}
+
+func (p *parser) errorf(offset int, format string, args ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, args...), Offset: offset}
+}
+
+// Attributes for a letter identifier. Single letters are italic by default,
+// which \mathrm turns off.
+func (p *parser) letterAttrs() string {
+	if p.style == `\mathrm` {
+		return ` mathvariant="normal"`
+	}
+	return ""
+}
+
+// Applies the current font style to letters and numbers. Bold, double-struck,
+// and script styles are produced with Unicode's mathematical alphanumeric
+// symbols because browsers don't support them otherwise.
+func (p *parser) styled(s string) string {
+	style, ok := styles[p.style]
+	if !ok || style == nil {
+		return s
+	}
+
+	var b bytes.Buffer
+	for _, r := range s {
+		b.WriteRune(style(r))
+	}
+	return b.String()
+}
+
+//
+// Symbols
+//
+
+type symbol struct {
+	attrs       string
+	bigOperator bool
+	element     string
+	text        string
+}
+
+// Commands that produce a single symbol.
+var symbols = map[string]*symbol{}
+
+func init() {
+	for name, text := range map[string]string{
+		`\alpha`: "α", `\beta`: "β", `\gamma`: "γ", `\delta`: "δ", `\epsilon`: "ϵ",
+		`\varepsilon`: "ε", `\zeta`: "ζ", `\eta`: "η", `\theta`: "θ", `\vartheta`: "ϑ",
+		`\iota`: "ι", `\kappa`: "κ", `\lambda`: "λ", `\mu`: "μ", `\nu`: "ν", `\xi`: "ξ",
+		`\pi`: "π", `\varpi`: "ϖ", `\rho`: "ρ", `\varrho`: "ϱ", `\sigma`: "σ",
+		`\varsigma`: "ς", `\tau`: "τ", `\upsilon`: "υ", `\phi`: "ϕ", `\varphi`: "φ",
+		`\chi`: "χ", `\psi`: "ψ", `\omega`: "ω", `\ell`: "ℓ", `\hbar`: "ℏ",
+		`\infty`: "∞", `\partial`: "∂", `\nabla`: "∇", `\emptyset`: "∅",
+		`\aleph`: "ℵ",
+	} {
+		symbols[name] = &symbol{element: "mi", text: text}
+	}
+
+	// Uppercase Greek letters are upright.
+	for name, text := range map[string]string{
+		`\Gamma`: "Γ", `\Delta`: "Δ", `\Theta`: "Θ", `\Lambda`: "Λ", `\Xi`: "Ξ",
+		`\Pi`: "Π", `\Sigma`: "Σ", `\Upsilon`: "Υ", `\Phi`: "Φ", `\Psi`: "Ψ",
+		`\Omega`: "Ω",
+	} {
+		symbols[name] = &symbol{attrs: ` mathvariant="normal"`, element: "mi", text: text}
+	}
+
+	for name, text := range map[string]string{
+		`\times`: "×", `\cdot`: "⋅", `\div`: "÷", `\pm`: "±", `\mp`: "∓", `\ast`: "∗",
+		`\circ`: "∘", `\bullet`: "∙", `\leq`: "≤", `\le`: "≤", `\geq`: "≥", `\ge`: "≥",
+		`\neq`: "≠", `\ne`: "≠", `\approx`: "≈", `\equiv`: "≡", `\sim`: "∼",
+		`\simeq`: "≃", `\cong`: "≅", `\propto`: "∝", `\ll`: "≪", `\gg`: "≫",
+		`\in`: "∈", `\notin`: "∉", `\ni`: "∋", `\subset`: "⊂", `\subseteq`: "⊆",
+		`\supset`: "⊃", `\supseteq`: "⊇", `\cup`: "∪", `\cap`: "∩", `\setminus`: "∖",
+		`\land`: "∧", `\wedge`: "∧", `\lor`: "∨", `\vee`: "∨", `\neg`: "¬", `\lnot`: "¬",
+		`\forall`: "∀", `\exists`: "∃", `\to`: "→", `\rightarrow`: "→",
+		`\leftarrow`: "←", `\gets`: "←", `\leftrightarrow`: "↔", `\Rightarrow`: "⇒",
+		`\Leftarrow`: "⇐", `\Leftrightarrow`: "⇔", `\implies`: "⟹", `\iff`: "⟺",
+		`\mapsto`: "↦", `\mid`: "∣", `\parallel`: "∥", `\perp`: "⊥",
+		`\ldots`: "…", `\cdots`: "⋯", `\vdots`: "⋮", `\ddots`: "⋱", `\dots`: "…",
+		`\langle`: "⟨", `\rangle`: "⟩", `\lfloor`: "⌊", `\rfloor`: "⌋",
+		`\lceil`: "⌈", `\rceil`: "⌉", `\{`: "{", `\}`: "}", `\|`: "‖",
+		`\backslash`: "\\", `\%`: "%", `\$`: "$", `\#`: "#", `\&`: "&", `\_`: "_",
+		`\prime`: "′",
+	} {
+		symbols[name] = &symbol{element: "mo", text: text}
+	}
+
+	for name, text := range map[string]string{
+		`\sum`: "∑", `\prod`: "∏", `\coprod`: "∐", `\bigcup`: "⋃", `\bigcap`: "⋂",
+	} {
+		symbols[name] = &symbol{bigOperator: true, element: "mo", text: text}
+	}
+
+	// Integrals keep their limits to the side even in display math.
+	for name, text := range map[string]string{
+		`\int`: "∫", `\iint`: "∬", `\iiint`: "∭", `\oint`: "∮",
+	} {
+		symbols[name] = &symbol{element: "mo", text: text}
+	}
+
+	for _, name := range []string{
+		"arccos", "arcsin", "arctan", "cos", "cosh", "cot", "csc", "deg", "det",
+		"dim", "exp", "gcd", "hom", "ker", "lg", "ln", "log", "sec", "sin", "sinh",
+		"tan", "tanh",
+	} {
+		symbols[`\`+name] = &symbol{element: "mi", text: name}
+	}
+
+	// Functions that take their limits underneath like big operators.
+	for _, name := range []string{"inf", "lim", "max", "min", "sup"} {
+		symbols[`\`+name] = &symbol{bigOperator: true, element: "mi", text: name}
+	}
+}
+
+// Accents placed over their argument.
+var accents = map[string]string{
+	`\bar`:       "¯",
+	`\dot`:       "˙",
+	`\ddot`:      "¨",
+	`\hat`:       "^",
+	`\overline`:  "‾",
+	`\tilde`:     "~",
+	`\vec`:       "→",
+	`\widehat`:   "^",
+	`\widetilde`: "~",
+}
+
+// Delimiters that can follow \left and \right. An empty string is an
+// invisible delimiter.
+var delimiters = map[string]string{
+	"(": "(", ")": ")", "[": "[", "]": "]", "|": "|", "/": "/", ".": "",
+	`\{`: "{", `\}`: "}", `\|`: "‖", `\langle`: "⟨", `\rangle`: "⟩",
+	`\lfloor`: "⌊", `\rfloor`: "⌋", `\lceil`: "⌈", `\rceil`: "⌉",
+}
+
+type environment struct {
+	columnAlign string
+	left        string
+	right       string
+}
+
+var environments = map[string]*environment{
+	"bmatrix": {left: "[", right: "]"},
+	"cases":   {columnAlign: "left", left: "{"},
+	"matrix":  {},
+	"pmatrix": {left: "(", right: ")"},
+	"vmatrix": {left: "|", right: "|"},
+}
+
+// Operators that are written differently in TeX and MathML.
+var operators = map[rune]string{
+	'-':  "−",
+	'*':  "∗",
+	'\'': "′",
+}
+
+// Spacing commands and their widths.
+var spaces = map[string]string{
+	`\!`:     "-0.1667em",
+	`\,`:     "0.1667em",
+	`\:`:     "0.2222em",
+	`\>`:     "0.2222em",
+	`\;`:     "0.2778em",
+	`\ `:     "0.3333em",
+	`\quad`:  "1em",
+	`\qquad`: "2em",
+}
+
+// Font style commands and functions that map characters to their styled
+// equivalents. A nil function leaves characters alone and is handled
+// elsewhere.
+var styles = map[string]func(rune) rune{
+	`\mathbb`:  doubleStruck,
+	`\mathbf`:  bold,
+	`\mathcal`: script,
+	`\mathrm`:  nil,
+}
+
+func bold(r rune) rune {
+	switch {
+	case r >= 'A' && r <= 'Z':
+		return 0x1D400 + r - 'A'
+	case r >= 'a' && r <= 'z':
+		return 0x1D41A + r - 'a'
+	case r >= '0' && r <= '9':
+		return 0x1D7CE + r - '0'
+	}
+	return r
+}
+
+// Letters that were in Unicode before the rest of the mathematical
+// alphanumerics, and so aren't in the same block.
+var doubleStruckExceptions = map[rune]rune{
+	'C': 'ℂ', 'H': 'ℍ', 'N': 'ℕ', 'P': 'ℙ', 'Q': 'ℚ', 'R': 'ℝ', 'Z': 'ℤ',
+}
+
+func doubleStruck(r rune) rune {
+	if exception, ok := doubleStruckExceptions[r]; ok {
+		return exception
+	}
+	switch {
+	case r >= 'A' && r <= 'Z':
+		return 0x1D538 + r - 'A'
+	case r >= 'a' && r <= 'z':
+		return 0x1D552 + r - 'a'
+	case r >= '0' && r <= '9':
+		return 0x1D7D8 + r - '0'
+	}
+	return r
+}
+
+var scriptExceptions = map[rune]rune{
+	'B': 'ℬ', 'E': 'ℰ', 'F': 'ℱ', 'H': 'ℋ', 'I': 'ℐ', 'L': 'ℒ', 'M': 'ℳ', 'R': 'ℛ',
+}
+
+func script(r rune) rune {
+	if exception, ok := scriptExceptions[r]; ok {
+		return exception
+	}
+	if r >= 'A' && r <= 'Z' {
+		return 0x1D49C + r - 'A'
+	}
+	return r
+}
+
+//
+// Helpers
+//
+
+func element(name, attrs, text string) string {
+	return "<" + name + attrs + ">" + html.EscapeString(text) + "</" + name + ">"
+}
+
+// Produces a stretchy delimiter, or nothing for an invisible one.
+func fence(delimiter string) string {
+	if delimiter == "" {
+		return ""
+	}
+	return `<mo fence="true" stretchy="true">` + html.EscapeString(delimiter) + `</mo>`
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// Combines atoms into a single element.
+func row(atoms []*atom) string {
+	if len(atoms) == 1 {
+		return atoms[0].markup
+	}
+
+	var b bytes.Buffer
+	b.WriteString("<mrow>")
+	for _, a := range atoms {
+		b.WriteString(a.markup)
+	}
+	b.WriteString("</mrow>")
+	return b.String()
+}
@@ -0,0 +1,127 @@
+package mathml
+
+import (
+	"strings"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	rendered, err := Render("x^2", false)
+	assert.NoError(t, err)
+	assert.Equal(t, `<math xmlns="http://www.w3.org/1998/Math/MathML">`+
+		`<semantics><msup><mi>x</mi><mn>2</mn></msup>`+
+		`<annotation encoding="application/x-tex">x^2</annotation></semantics></math>`, rendered)
+
+	rendered, err = Render("a < b", true)
+	assert.NoError(t, err)
+	assert.Equal(t, `<math xmlns="http://www.w3.org/1998/Math/MathML" display="block">`+
+		`<semantics><mrow><mi>a</mi><mo>&lt;</mo><mi>b</mi></mrow>`+
+		`<annotation encoding="application/x-tex">a &lt; b</annotation></semantics></math>`, rendered)
+}
+
+func TestRenderExpressions(t *testing.T) {
+	testCases := []struct {
+		tex      string
+		display  bool
+		expected string
+	}{
+		// Identifiers, numbers, and operators
+		{`2x - 3.14`, false, `<mrow><mn>2</mn><mi>x</mi><mo>−</mo><mn>3.14</mn></mrow>`},
+		{`f'(x)`, false, `<mrow><mi>f</mi><mo>′</mo><mo>(</mo><mi>x</mi><mo>)</mo></mrow>`},
+
+		// Scripts
+		{`x_i^2`, false, `<msubsup><mi>x</mi><mi>i</mi><mn>2</mn></msubsup>`},
+		{`x^23`, false, `<mrow><msup><mi>x</mi><mn>2</mn></msup><mn>3</mn></mrow>`},
+		{`x^{2n}`, false, `<msup><mi>x</mi><mrow><mn>2</mn><mi>n</mi></mrow></msup>`},
+		{`{}_1`, false, `<msub><mrow></mrow><mn>1</mn></msub>`},
+
+		// Fractions and roots
+		{`\frac{1}{2}`, false, `<mfrac><mn>1</mn><mn>2</mn></mfrac>`},
+		{`\frac12`, false, `<mfrac><mn>1</mn><mn>2</mn></mfrac>`},
+		{`\sqrt{x}`, false, `<msqrt><mi>x</mi></msqrt>`},
+		{`\sqrt[3]{x}`, false, `<mroot><mi>x</mi><mn>3</mn></mroot>`},
+
+		// Symbols
+		{`\alpha \leq \Omega`, false, `<mrow><mi>α</mi><mo>≤</mo><mi mathvariant="normal">Ω</mi></mrow>`},
+		{`\sin x`, false, `<mrow><mi>sin</mi><mi>x</mi></mrow>`},
+
+		// Big operators take limits underneath only in display math
+		{`\sum_{i=1}^n i`, false,
+			`<mrow><msubsup><mo>∑</mo><mrow><mi>i</mi><mo>=</mo><mn>1</mn></mrow><mi>n</mi></msubsup><mi>i</mi></mrow>`},
+		{`\sum_{i=1}^n i`, true,
+			`<mrow><munderover><mo>∑</mo><mrow><mi>i</mi><mo>=</mo><mn>1</mn></mrow><mi>n</mi></munderover><mi>i</mi></mrow>`},
+		{`\lim_{x \to 0}`, true, `<munder><mi>lim</mi><mrow><mi>x</mi><mo>→</mo><mn>0</mn></mrow></munder>`},
+		{`\int_0^1`, true, `<msubsup><mo>∫</mo><mn>0</mn><mn>1</mn></msubsup>`},
+
+		// Accents, text, and styles
+		{`\vec{v}`, false, `<mover accent="true"><mi>v</mi><mo>→</mo></mover>`},
+		{`\text{if } x`, false, `<mrow><mtext>if </mtext><mi>x</mi></mrow>`},
+		{`\mathbb{R}^n`, false, `<msup><mi>ℝ</mi><mi>n</mi></msup>`},
+		{`\mathbf{v1}`, false, `<mrow><mi>𝐯</mi><mn>𝟏</mn></mrow>`},
+		{`\mathcal{L}`, false, `<mi>ℒ</mi>`},
+		{`\mathrm{d}x`, false, `<mrow><mi mathvariant="normal">d</mi><mi>x</mi></mrow>`},
+		{`\operatorname{argmax}`, false, `<mi>argmax</mi>`},
+
+		// Delimiters and spacing
+		{`\left( \frac{a}{b} \right)`, false,
+			`<mrow><mo fence="true" stretchy="true">(</mo><mfrac><mi>a</mi><mi>b</mi></mfrac><mo fence="true" stretchy="true">)</mo></mrow>`},
+		{`\left. x \right|`, false, `<mrow><mi>x</mi><mo fence="true" stretchy="true">|</mo></mrow>`},
+		{`a\,b`, false, `<mrow><mi>a</mi><mspace width="0.1667em"></mspace><mi>b</mi></mrow>`},
+
+		// Environments
+		{`\begin{pmatrix} a & b \\ c & d \end{pmatrix}`, false,
+			`<mrow><mo fence="true" stretchy="true">(</mo><mtable>` +
+				`<mtr><mtd><mi>a</mi></mtd><mtd><mi>b</mi></mtd></mtr>` +
+				`<mtr><mtd><mi>c</mi></mtd><mtd><mi>d</mi></mtd></mtr>` +
+				`</mtable><mo fence="true" stretchy="true">)</mo></mrow>`},
+		{`\begin{cases} 1 & x > 0 \\ 0 & \text{otherwise} \\ \end{cases}`, false,
+			`<mrow><mo fence="true" stretchy="true">{</mo><mtable columnalign="left">` +
+				`<mtr><mtd><mn>1</mn></mtd><mtd><mrow><mi>x</mi><mo>&gt;</mo><mn>0</mn></mrow></mtd></mtr>` +
+				`<mtr><mtd><mn>0</mn></mtd><mtd><mtext>otherwise</mtext></mtd></mtr>` +
+				`</mtable></mrow>`},
+	}
+
+	for _, testCase := range testCases {
+		rendered, err := Render(testCase.tex, testCase.display)
+		assert.NoError(t, err, testCase.tex)
+
+		// Strip the surrounding <math> and annotation to compare only the
+		// expression itself.
+		start := strings.Index(rendered, "<semantics>") + len("<semantics>")
+		end := strings.Index(rendered, "<annotation")
+		assert.Equal(t, testCase.expected, rendered[start:end], testCase.tex)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	testCases := []struct {
+		tex      string
+		expected string
+	}{
+		{`x^2^3`, `Double superscript (at offset 3)`},
+		{`x_1_2`, `Double subscript (at offset 3)`},
+		{`\frac{1}{2`, `Unclosed { (at offset 8)`},
+		{`x}`, `Unexpected } (at offset 1)`},
+		{`\foo + 1`, `Unknown command \foo (at offset 0)`},
+		{`\frac{1}`, `Missing argument for \frac (at offset 8)`},
+		{`x^`, `Missing argument for ^ (at offset 2)`},
+		{`\left( x`, `\left without a matching \right (at offset 0)`},
+		{`x \right)`, `\right without a matching \left (at offset 2)`},
+		{`\left< x \right>`, `Unknown delimiter < after \left (at offset 5)`},
+		{`a & b`, `& can only be used in an environment like matrix (at offset 2)`},
+		{`\begin{matrix} a`, `\begin{matrix} without a matching \end{matrix} (at offset 0)`},
+		{`\begin{matrix} a \end{pmatrix}`, `\begin{matrix} ended by \end{pmatrix} (at offset 17)`},
+		{`\begin{align} a \end{align}`,
+			`Unknown environment align (known environments are bmatrix, cases, matrix, pmatrix, vmatrix) (at offset 0)`},
+		{`\text x`, `Expected { after \text (at offset 6)`},
+		{`100%`, `Unsupported character % (at offset 3)`},
+	}
+
+	for _, testCase := range testCases {
+		_, err := Render(testCase.tex, false)
+		assert.Error(t, err, testCase.tex)
+		assert.Equal(t, testCase.expected, err.Error(), testCase.tex)
+	}
+}
@@ -0,0 +1,141 @@
+package minify
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/brandur/singularity/sourcemap"
+)
+
+// Characters that whitespace can be removed after in CSS. The newline is the
+// one that follows a kept comment.
+const cssTrimAfter = "{};,>~:(\n"
+
+// Characters that whitespace can be removed before in CSS. Whitespace before
+// a colon is kept because "a :hover" isn't the same selector as "a:hover",
+// and whitespace before an opening parenthesis because "and (" in a media
+// query would otherwise become a function.
+const cssTrimBefore = "{};,>~!)"
+
+// CSS minifies a stylesheet by removing comments and unnecessary whitespace,
+// along with the semicolon after the last declaration in a block. Comments
+// that start with "/*!", which are conventionally licenses, are kept.
+//
+// Strings and unquoted URLs are copied verbatim. Strings and comments that
+// are never closed are an error.
+func CSS(source string) (string, error) {
+	minified, _, err := CSSWithSourceMap(source, "")
+	return minified, err
+}
+
+// CSSWithSourceMap minifies a stylesheet like CSS does, but also produces a
+// source map tying each part of the minified output back to the line of the
+// source that it came from. name is the name given to the source in the map.
+func CSSWithSourceMap(source, name string) (string, *sourcemap.Map, error) {
+	b := newMappedBuffer(source, name)
+	space := false
+
+	// Writes a pending space unless it's next to a character that doesn't
+	// need one.
+	flushSpace := func(next byte) {
+		if space && b.Len() > 0 && !strings.ContainsRune(cssTrimAfter, rune(b.Bytes()[b.Len()-1])) &&
+			!strings.ContainsRune(cssTrimBefore, rune(next)) {
+			b.WriteByte(' ')
+		}
+		space = false
+	}
+
+	for i := 0; i < len(source); {
+		c := source[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			space = true
+			i++
+
+		case strings.HasPrefix(source[i:], "/*"):
+			end := strings.Index(source[i+2:], "*/")
+			if end == -1 {
+				return "", nil, cssError(source, i, "Comment is never closed")
+			}
+			comment := source[i : i+2+end+2]
+			i += len(comment)
+
+			if strings.HasPrefix(comment, "/*!") {
+				if b.Len() > 0 {
+					b.WriteByte('\n')
+				}
+				b.mark(i - len(comment))
+				b.WriteString(comment)
+				b.WriteByte('\n')
+				space = false
+			} else {
+				space = true
+			}
+
+		case c == '"' || c == '\'':
+			end, err := scanCSSString(source, i)
+			if err != nil {
+				return "", nil, err
+			}
+			flushSpace(c)
+			b.mark(i)
+			b.WriteString(source[i:end])
+			i = end
+
+		case strings.HasPrefix(source[i:], "url(") && isUnquotedURL(source[i+4:]):
+			end := strings.IndexByte(source[i:], ')')
+			if end == -1 {
+				return "", nil, cssError(source, i, "URL is never closed")
+			}
+			flushSpace(c)
+			b.mark(i)
+			b.WriteString(source[i : i+end+1])
+			i += end + 1
+
+		case c == '}':
+			space = false
+			if b.Len() > 0 && b.Bytes()[b.Len()-1] == ';' {
+				b.Truncate(b.Len() - 1)
+			}
+			b.mark(i)
+			b.WriteByte(c)
+			i++
+
+		default:
+			flushSpace(c)
+			b.mark(i)
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	return b.String(), b.sourceMap, nil
+}
+
+// Produces an error pointing at the line of a position in source.
+func cssError(source string, i int, message string) error {
+	return fmt.Errorf("line %v: %v", strings.Count(source[:i], "\n")+1, message)
+}
+
+// Checks whether the contents of a url() aren't a quoted string.
+func isUnquotedURL(s string) bool {
+	s = strings.TrimLeft(s, " \t\n\r\f")
+	return s != "" && s[0] != '"' && s[0] != '\''
+}
+
+// Finds the end of the quoted string starting at i.
+func scanCSSString(source string, i int) (int, error) {
+	quote := source[i]
+	for end := i + 1; end < len(source); end++ {
+		switch source[end] {
+		case '\\':
+			end++
+		case '\n':
+			return 0, cssError(source, i, "String is never closed")
+		case quote:
+			return end + 1, nil
+		}
+	}
+	return 0, cssError(source, i, "String is never closed")
+}
@@ -0,0 +1,71 @@
+package minify
+
+import (
+	"testing"
+
+	"github.com/brandur/singularity/sourcemap"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestCSS(t *testing.T) {
+	assert.Equal(t,
+		`html a:hover,html .toc>ol{border-bottom:0;color:rgba(255,255,255,0.6)}`+
+			`.cite:before{content:"\2014\00a0"}`+
+			`@media handheld,only screen and (max-width:650px){html .container{flex-direction:column}}`,
+		mustCSS(t, `/* main.sass */
+
+html a:hover, html .toc >ol {
+  border-bottom: 0;
+  color: rgba(255, 255, 255, 0.6);
+}
+
+.cite:before {
+  content: "\2014\00a0";
+}
+
+@media handheld, only screen and (max-width: 650px) {
+  html .container {
+    flex-direction: column;
+  }
+}
+`))
+
+	// Spaces that change meaning are kept
+	assert.Equal(t, `a :hover{width:calc(100% - 10px)}`,
+		mustCSS(t, "a :hover {\n  width: calc(100% - 10px);\n}"))
+
+	// Strings, URLs, and license comments are left alone
+	assert.Equal(t, "/*! License */\n.a{background:url(//example.com/a  b.png);font-family:'a  b'}",
+		mustCSS(t, "/*! License */\n.a {\n  background: url(//example.com/a  b.png);\n  font-family: 'a  b';\n}"))
+}
+
+func TestCSSErrors(t *testing.T) {
+	_, err := CSS(".a {\n  content: \"unclosed\n}")
+	assert.Equal(t, "line 2: String is never closed", err.Error())
+
+	_, err = CSS("/* unclosed")
+	assert.Equal(t, "line 1: Comment is never closed", err.Error())
+}
+
+func TestCSSWithSourceMap(t *testing.T) {
+	minified, sourceMap, err := CSSWithSourceMap("a {\n  color: red;\n}\n", "app.css")
+	assert.NoError(t, err)
+	assert.Equal(t, "a{color:red}", minified)
+
+	// The mapping for the dropped semicolon goes with it
+	assert.Equal(t, []*sourcemap.Mapping{
+		{GeneratedLine: 0, GeneratedColumn: 0, Source: "app.css", SourceLine: 0, SourceColumn: 0},
+		{GeneratedLine: 0, GeneratedColumn: 2, Source: "app.css", SourceLine: 1, SourceColumn: 2},
+		{GeneratedLine: 0, GeneratedColumn: 11, Source: "app.css", SourceLine: 2, SourceColumn: 0},
+	}, sourceMap.Mappings)
+}
+
+//
+// Helpers
+//
+
+func mustCSS(t *testing.T, source string) string {
+	minified, err := CSS(source)
+	assert.NoError(t, err)
+	return minified
+}
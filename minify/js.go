@@ -0,0 +1,420 @@
+package minify
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/brandur/singularity/sourcemap"
+)
+
+// Kinds of JavaScript tokens.
+const (
+	jsPunctuator = iota
+	jsRegexp
+	jsString
+	jsWord
+)
+
+// A token of JavaScript. Words are identifiers, keywords, and numbers.
+// Strings include template literals.
+type jsToken struct {
+	kind int
+	text string
+}
+
+// Punctuators, longest first so that the longest one at a position matches.
+var jsPunctuators = []string{
+	">>>=",
+	"...", "===", "!==", "**=", "<<=", ">>=", ">>>", "&&=", "||=", "??=",
+	"=>", "==", "!=", "<=", ">=", "&&", "||", "??", "?.", "++", "--", "+=",
+	"-=", "*=", "/=", "%=", "&=", "|=", "^=", "**", "<<", ">>",
+}
+
+// Keywords after which a newline always ends the statement, so the newline
+// can't be removed.
+var jsRestrictedWords = map[string]bool{
+	"break":    true,
+	"continue": true,
+	"return":   true,
+	"throw":    true,
+	"yield":    true,
+}
+
+// Keywords after which a slash starts a regular expression rather than being
+// division.
+var jsRegexpWords = map[string]bool{
+	"await":      true,
+	"case":       true,
+	"delete":     true,
+	"do":         true,
+	"else":       true,
+	"in":         true,
+	"instanceof": true,
+	"new":        true,
+	"of":         true,
+	"return":     true,
+	"throw":      true,
+	"typeof":     true,
+	"void":       true,
+	"yield":      true,
+}
+
+// Punctuators that can start an expression statement. A newline before one
+// may be ending the previous statement, so it can't be removed.
+var jsStatementStarts = map[string]bool{
+	"!":   true,
+	"(":   true,
+	"+":   true,
+	"++":  true,
+	"-":   true,
+	"--":  true,
+	"...": true,
+	"[":   true,
+	"{":   true,
+	"~":   true,
+}
+
+// JS minifies JavaScript by removing comments and whitespace. Comments that
+// start with "/*!", which are conventionally licenses, are kept.
+//
+// Statements don't have to end in semicolons, so newlines are only removed
+// where automatic semicolon insertion couldn't apply: after a token that
+// can't end a statement, or before one that can't start one. Names aren't
+// shortened and code isn't otherwise rewritten, so the result always behaves
+// the same as the original.
+//
+// Strings, template literals, comments, and regular expressions that are
+// never closed are an error.
+func JS(source string) (string, error) {
+	minified, _, err := JSWithSourceMap(source, "")
+	return minified, err
+}
+
+// JSWithSourceMap minifies JavaScript like JS does, but also produces a source
+// map tying each part of the minified output back to the line of the source
+// that it came from. name is the name given to the source in the map.
+func JSWithSourceMap(source, name string) (string, *sourcemap.Map, error) {
+	b := newMappedBuffer(source, name)
+	var prev *jsToken
+	var newline, space bool
+
+	for i := 0; i < len(source); {
+		c := source[i]
+
+		switch {
+		case c == '\n' || c == '\r':
+			newline = true
+			i++
+			continue
+
+		case c == ' ' || c == '\t' || c == '\f' || c == '\v':
+			space = true
+			i++
+			continue
+
+		case strings.HasPrefix(source[i:], "//"):
+			end := strings.IndexAny(source[i:], "\r\n")
+			if end == -1 {
+				end = len(source) - i
+			}
+			i += end
+			continue
+
+		case strings.HasPrefix(source[i:], "/*"):
+			end := strings.Index(source[i+2:], "*/")
+			if end == -1 {
+				return "", nil, jsError(source, i, "Comment is never closed")
+			}
+			comment := source[i : i+2+end+2]
+			i += len(comment)
+
+			if strings.HasPrefix(comment, "/*!") {
+				if b.Len() > 0 {
+					b.WriteByte('\n')
+				}
+				b.mark(i - len(comment))
+				b.WriteString(comment)
+				newline = true
+				continue
+			}
+
+			// A comment containing a newline ends a statement just like a
+			// newline does.
+			if strings.ContainsAny(comment, "\r\n") {
+				newline = true
+			} else {
+				space = true
+			}
+			continue
+		}
+
+		token, end, err := scanJSToken(source, i, prev)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if prev != nil {
+			switch {
+			case newline && jsNeedsNewline(prev, token):
+				b.WriteByte('\n')
+			case (newline || space) && jsNeedsSpace(prev, token):
+				b.WriteByte(' ')
+			}
+		} else if newline && b.Len() > 0 {
+			// After a kept comment
+			b.WriteByte('\n')
+		}
+
+		b.mark(i)
+		b.WriteString(token.text)
+		i = end
+		prev = token
+		newline, space = false, false
+	}
+
+	return b.String(), b.sourceMap, nil
+}
+
+// Produces an error pointing at the line of a position in source.
+func jsError(source string, i int, message string) error {
+	return fmt.Errorf("line %v: %v", strings.Count(source[:i], "\n")+1, message)
+}
+
+// Checks whether a newline between two tokens has to be kept because removing
+// it could change where automatic semicolon insertion ends a statement.
+func jsNeedsNewline(prev, next *jsToken) bool {
+	// A statement is ended before a closing brace regardless.
+	if next.kind == jsPunctuator && (next.text == "}" || next.text == ";") {
+		return false
+	}
+
+	if prev.kind == jsWord && jsRestrictedWords[prev.text] {
+		return true
+	}
+
+	if next.kind == jsPunctuator && (next.text == "++" || next.text == "--") {
+		return true
+	}
+
+	// A statement can't end just after an operator or an opening bracket.
+	if prev.kind == jsPunctuator {
+		switch prev.text {
+		case ")", "]", "}", "++", "--":
+		default:
+			return false
+		}
+	}
+
+	// Nor can the next one start with a token like "." or "=".
+	if next.kind == jsPunctuator && !jsStatementStarts[next.text] {
+		return false
+	}
+
+	return true
+}
+
+// Checks whether whitespace between two tokens has to be kept as a space
+// because without it they'd run together into something else.
+func jsNeedsSpace(prev, next *jsToken) bool {
+	last := prev.text[len(prev.text)-1]
+	first := next.text[0]
+
+	switch {
+	case isJSWordCharacter(last) && isJSWordCharacter(first):
+		return true
+
+	// Flags would run into a following word
+	case prev.kind == jsRegexp && isJSWordCharacter(first):
+		return true
+
+	// "1 .toString()" isn't the same as "1.toString()"
+	case prev.kind == jsWord && isDigit(prev.text[0]) && first == '.':
+		return true
+
+	// "a + +b", "a - -b", and "a / /re/" aren't "a++b", "a--b", or a comment
+	case last == '+' && first == '+',
+		last == '-' && first == '-',
+		last == '/' && (first == '/' || first == '*'):
+		return true
+
+	// Neither "<!" nor "->" should be able to start an HTML-like comment
+	case last == '<' && first == '!',
+		last == '-' && first == '>':
+		return true
+	}
+
+	return false
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// Checks whether a byte can be part of an identifier, keyword, or number.
+// Bytes of non-ASCII characters are all considered part of one.
+func isJSWordCharacter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || isDigit(c) ||
+		c == '_' || c == '$' || c == '\\' || c >= 0x80
+}
+
+// Checks whether a slash after the given token starts a regular expression
+// rather than being division.
+func jsSlashStartsRegexp(prev *jsToken) bool {
+	if prev == nil {
+		return true
+	}
+
+	switch prev.kind {
+	case jsPunctuator:
+		return prev.text != ")" && prev.text != "]"
+	case jsWord:
+		return jsRegexpWords[prev.text]
+	}
+	return false
+}
+
+// Scans the token starting at i, returning it along with the position just
+// after it. The previous token is needed to tell a regular expression from
+// division.
+func scanJSToken(source string, i int, prev *jsToken) (*jsToken, int, error) {
+	c := source[i]
+
+	switch {
+	case isJSWordCharacter(c):
+		end := i + 1
+		for end < len(source) && isJSWordCharacter(source[end]) {
+			end++
+		}
+		return &jsToken{jsWord, source[i:end]}, end, nil
+
+	case c == '"' || c == '\'':
+		end, err := scanJSString(source, i)
+		if err != nil {
+			return nil, 0, err
+		}
+		return &jsToken{jsString, source[i:end]}, end, nil
+
+	case c == '`':
+		end, err := scanJSTemplate(source, i)
+		if err != nil {
+			return nil, 0, err
+		}
+		return &jsToken{jsString, source[i:end]}, end, nil
+
+	case c == '/' && jsSlashStartsRegexp(prev):
+		end, err := scanJSRegexp(source, i)
+		if err != nil {
+			return nil, 0, err
+		}
+		return &jsToken{jsRegexp, source[i:end]}, end, nil
+	}
+
+	for _, punctuator := range jsPunctuators {
+		if strings.HasPrefix(source[i:], punctuator) {
+			return &jsToken{jsPunctuator, punctuator}, i + len(punctuator), nil
+		}
+	}
+	return &jsToken{jsPunctuator, source[i : i+1]}, i + 1, nil
+}
+
+// Finds the end of the regular expression starting at i, including its
+// flags.
+func scanJSRegexp(source string, i int) (int, error) {
+	inClass := false
+	for end := i + 1; end < len(source); end++ {
+		switch source[end] {
+		case '\\':
+			end++
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '\n', '\r':
+			return 0, jsError(source, i, "Regular expression is never closed")
+		case '/':
+			if inClass {
+				continue
+			}
+			end++
+			for end < len(source) && isJSWordCharacter(source[end]) {
+				end++
+			}
+			return end, nil
+		}
+	}
+	return 0, jsError(source, i, "Regular expression is never closed")
+}
+
+// Finds the end of the single or double quoted string starting at i.
+func scanJSString(source string, i int) (int, error) {
+	quote := source[i]
+	for end := i + 1; end < len(source); end++ {
+		switch source[end] {
+		case '\\':
+			// Also skips escaped newlines, which continue the string
+			end++
+		case '\n', '\r':
+			return 0, jsError(source, i, "String is never closed")
+		case quote:
+			return end + 1, nil
+		}
+	}
+	return 0, jsError(source, i, "String is never closed")
+}
+
+// Finds the end of the template literal starting at i.
+func scanJSTemplate(source string, i int) (int, error) {
+	for end := i + 1; end < len(source); end++ {
+		switch {
+		case source[end] == '\\':
+			end++
+
+		case source[end] == '`':
+			return end + 1, nil
+
+		case strings.HasPrefix(source[end:], "${"):
+			substitutionEnd, err := scanJSSubstitution(source, end+2)
+			if err != nil {
+				return 0, err
+			}
+			end = substitutionEnd - 1
+		}
+	}
+	return 0, jsError(source, i, "Template literal is never closed")
+}
+
+// Finds the end of a substitution in a template literal whose expression
+// starts at i, returning the position just after its closing brace. Braces
+// are matched, taking strings and nested templates into account.
+func scanJSSubstitution(source string, i int) (int, error) {
+	depth := 0
+	for end := i; end < len(source); {
+		var err error
+		switch source[end] {
+		case '"', '\'':
+			end, err = scanJSString(source, end)
+			if err != nil {
+				return 0, err
+			}
+			continue
+
+		case '`':
+			end, err = scanJSTemplate(source, end)
+			if err != nil {
+				return 0, err
+			}
+			continue
+
+		case '{':
+			depth++
+
+		case '}':
+			if depth == 0 {
+				return end + 1, nil
+			}
+			depth--
+		}
+		end++
+	}
+	return 0, jsError(source, i, "Template substitution is never closed")
+}
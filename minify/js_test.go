@@ -0,0 +1,98 @@
+package minify
+
+import (
+	"testing"
+
+	"github.com/brandur/singularity/sourcemap"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestJS(t *testing.T) {
+	assert.Equal(t, `function isInView(el){return el.getBoundingClientRect().top<=0}
+window.addEventListener('load',e=>activate())`, mustJS(t, `
+/**
+ * Comments are removed.
+ */
+function isInView(el) {
+  return el.getBoundingClientRect().top <= 0 // Including these
+}
+
+window.addEventListener('load', e => activate())
+`))
+
+	// Newlines that automatic semicolon insertion may rely on are kept
+	assert.Equal(t, "const a=1\nlet b=a\n++b\nconst c=a+b\n[1].forEach(f)", mustJS(t, `
+const a = 1
+let b = a
+++b
+const c = a +
+  b
+[1].forEach(f)
+`))
+
+	// Including after restricted keywords
+	assert.Equal(t, "function f(){return\n42}", mustJS(t, "function f() {\n  return\n    42\n}"))
+
+	// But not where a statement can't end or start
+	assert.Equal(t, "const h=a.toString()\nif(i==-1){return}", mustJS(t, `
+const h = a
+  .toString()
+if (i == -1) {
+  return
+}
+`))
+
+	// Spaces that keep tokens apart are kept
+	assert.Equal(t, "let e=a- -b,g=a+ +b,s=1 .toString(),t=typeof x\nfor(const x of xs)y/ /re/.exec(x)",
+		mustJS(t, "let e = a - -b, g = a + +b, s = 1 .toString(), t = typeof x\nfor (const x of xs) y / /re/.exec(x)"))
+
+	// Strings, templates, and regular expressions are left alone
+	assert.Equal(t,
+		"const s=\"a  // b\",t=`x ${ a + `y${ b }` } {z}`,re=/a\\/[/] b/g",
+		mustJS(t, "const s = \"a  // b\", t = `x ${ a + `y${ b }` } {z}`, re = /a\\/[/] b/g"))
+
+	// As are comments that are conventionally licenses
+	assert.Equal(t, "/*! License */\nvar a=1", mustJS(t, "/*! License */\nvar a = 1"))
+}
+
+func TestJSErrors(t *testing.T) {
+	_, err := JS("var a = 1\nvar s = 'unclosed\n")
+	assert.Equal(t, "line 2: String is never closed", err.Error())
+
+	_, err = JS("var t = `unclosed ${ a }")
+	assert.Equal(t, "line 1: Template literal is never closed", err.Error())
+
+	_, err = JS("/* unclosed")
+	assert.Equal(t, "line 1: Comment is never closed", err.Error())
+
+	_, err = JS("var re = /unclosed\n")
+	assert.Equal(t, "line 1: Regular expression is never closed", err.Error())
+}
+
+func TestJSWithSourceMap(t *testing.T) {
+	minified, sourceMap, err := JSWithSourceMap(
+		"const a = 1\n\nfunction f() {\n  return a\n}\n", "app.js")
+	assert.NoError(t, err)
+	assert.Equal(t, "const a=1\nfunction f(){return a}", minified)
+
+	// Each part of the output is mapped to the line of the source it started
+	// on
+	assert.Equal(t, "app.js", sourceMap.File)
+	assert.Equal(t, []string{"app.js"}, sourceMap.Sources)
+	assert.Equal(t, []*sourcemap.Mapping{
+		{GeneratedLine: 0, GeneratedColumn: 0, Source: "app.js", SourceLine: 0, SourceColumn: 0},
+		{GeneratedLine: 1, GeneratedColumn: 0, Source: "app.js", SourceLine: 2, SourceColumn: 0},
+		{GeneratedLine: 1, GeneratedColumn: 13, Source: "app.js", SourceLine: 3, SourceColumn: 2},
+		{GeneratedLine: 1, GeneratedColumn: 21, Source: "app.js", SourceLine: 4, SourceColumn: 0},
+	}, sourceMap.Mappings)
+}
+
+//
+// Helpers
+//
+
+func mustJS(t *testing.T, source string) string {
+	minified, err := JS(source)
+	assert.NoError(t, err)
+	return minified
+}
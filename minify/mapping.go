@@ -0,0 +1,109 @@
+package minify
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/brandur/singularity/sourcemap"
+)
+
+// A buffer for minified output that keeps track of where in the source each
+// part of it came from. Mappings are kept at the granularity of lines of the
+// source: one is only added when output from a new line of the source
+// starts, or when the output itself starts a new line.
+type mappedBuffer struct {
+	bytes.Buffer
+
+	// The current position in the output.
+	column, line int
+
+	// Offsets in the source at which each of its lines start.
+	lineStarts []int
+
+	name      string
+	sourceMap *sourcemap.Map
+}
+
+func newMappedBuffer(source, name string) *mappedBuffer {
+	b := &mappedBuffer{
+		lineStarts: []int{0},
+		name:       name,
+		sourceMap:  sourcemap.New(name),
+	}
+	b.sourceMap.AddSource(name, source)
+
+	for i := 0; i < len(source); i++ {
+		if source[i] == '\n' {
+			b.lineStarts = append(b.lineStarts, i+1)
+		}
+	}
+
+	return b
+}
+
+// Records that what's written next came from position i of the source.
+func (b *mappedBuffer) mark(i int) {
+	line := sort.Search(len(b.lineStarts), func(k int) bool { return b.lineStarts[k] > i }) - 1
+
+	mappings := b.sourceMap.Mappings
+	if len(mappings) > 0 {
+		last := mappings[len(mappings)-1]
+
+		if last.GeneratedLine == b.line && last.SourceLine == line {
+			return
+		}
+
+		// Nothing was written for the last position marked
+		if last.GeneratedLine == b.line && last.GeneratedColumn == b.column {
+			b.sourceMap.Mappings = mappings[:len(mappings)-1]
+		}
+	}
+
+	b.sourceMap.Add(&sourcemap.Mapping{
+		GeneratedColumn: b.column,
+		GeneratedLine:   b.line,
+		Source:          b.name,
+		SourceColumn:    i - b.lineStarts[line],
+		SourceLine:      line,
+	})
+}
+
+// Truncate discards all but the first n bytes of the output, which must all
+// be on the current line, along with any mappings for them.
+func (b *mappedBuffer) Truncate(n int) {
+	b.column -= b.Len() - n
+	b.Buffer.Truncate(n)
+
+	mappings := b.sourceMap.Mappings
+	for len(mappings) > 0 {
+		last := mappings[len(mappings)-1]
+		if last.GeneratedLine != b.line || last.GeneratedColumn < b.column {
+			break
+		}
+		mappings = mappings[:len(mappings)-1]
+	}
+	b.sourceMap.Mappings = mappings
+}
+
+// WriteByte writes a byte of output.
+func (b *mappedBuffer) WriteByte(c byte) error {
+	if c == '\n' {
+		b.line++
+		b.column = 0
+	} else {
+		b.column++
+	}
+	return b.Buffer.WriteByte(c)
+}
+
+// WriteString writes a string of output.
+func (b *mappedBuffer) WriteString(s string) (int, error) {
+	if newlines := strings.Count(s, "\n"); newlines > 0 {
+		b.line += newlines
+		b.column = len(s) - strings.LastIndexByte(s, '\n') - 1
+	} else {
+		b.column += len(s)
+	}
+	return b.Buffer.WriteString(s)
+}
@@ -9,16 +9,31 @@ import (
 )
 
 const (
-	// Release is the asset version of the site. Bump when any assets are
-	// updated to blow away any browser caches.
-	Release = "10"
-)
+	// AnchorsManifest is the location of the manifest that records the
+	// anchors of every article as of the last build. It's checked in so that
+	// every build can verify that no anchors have disappeared.
+	AnchorsManifest = ContentDir + "/anchors.json"
+
+	// BundlesManifest is the location of the manifest that declares the
+	// bundles of scripts and stylesheets that are compiled for layouts to
+	// include.
+	BundlesManifest = ContentDir + "/bundles.yaml"
+
+	// CacheDir is the location of files that are expensive to generate and
+	// which are kept between builds, like image variants.
+	CacheDir = "./.cache"
 
-const (
 	// ContentDir is the location of the site's content (articles, fragments,
 	// assets, etc.).
 	ContentDir = "./content"
 
+	// ImageCacheDir is where generated variants of images are cached.
+	ImageCacheDir = CacheDir + "/images"
+
+	// ImageOriginalsDir is the location of high resolution images from
+	// which smaller variants are generated by the build.
+	ImageOriginalsDir = ContentDir + "/images/originals"
+
 	// LayoutsDir is the location of site layouts.
 	LayoutsDir = "./layouts"
 
@@ -32,8 +47,9 @@ const (
 // A list of all directories that are in the built static site.
 var outputDirs = []string{
 	".",
+	"archive",
+	"articles",
 	"assets",
-	"assets/" + Release,
 	"fonts",
 }
 
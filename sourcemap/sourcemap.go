@@ -0,0 +1,298 @@
+package sourcemap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Map is a source map, which ties positions in a generated file like a
+// bundle of scripts back to the files that it was generated from. It's
+// encoded to and decoded from JSON in the format of version 3 of the source
+// map specification.
+type Map struct {
+	// File is the name of the generated file.
+	File string
+
+	// Mappings are the positions in the generated file that are tied to a
+	// position in a source, in the order of their generated positions.
+	Mappings []*Mapping
+
+	// Sources are the names of the files that the generated file came from.
+	Sources []string
+
+	// SourcesContent are the contents of each of Sources, which are included
+	// in the map so that it's usable without serving the sources.
+	SourcesContent []string
+}
+
+// Mapping ties a position in a generated file to one in a source. Lines and
+// columns start at 0. A mapping without a source marks the start of generated
+// output that didn't come from any source, like a wrapper added around a
+// file.
+type Mapping struct {
+	// GeneratedColumn is the column of the position in the generated file.
+	GeneratedColumn int
+
+	// GeneratedLine is the line of the position in the generated file.
+	GeneratedLine int
+
+	// Source is the name of the source, or empty if the generated output
+	// didn't come from one.
+	Source string
+
+	// SourceColumn is the column of the position in the source.
+	SourceColumn int
+
+	// SourceLine is the line of the position in the source.
+	SourceLine int
+}
+
+// The characters of base64, which are used to encode mappings.
+const base64Characters = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// The version 3 format of a source map.
+type encodedMap struct {
+	File           string   `json:"file"`
+	Mappings       string   `json:"mappings"`
+	Names          []string `json:"names"`
+	Sources        []string `json:"sources"`
+	SourcesContent []string `json:"sourcesContent,omitempty"`
+	Version        int      `json:"version"`
+}
+
+// New initializes an empty source map for the named generated file.
+func New(file string) *Map {
+	return &Map{File: file}
+}
+
+// Compose produces a source map for a file that was generated from another
+// generated file, like a bundle that was minified after being concatenated.
+// outer maps positions in the file to positions in the intermediate file,
+// and inner maps those back to the original sources.
+//
+// Positions in the file are tied to the position that the nearest mapping at
+// or before them in the intermediate file points to, so the result is only as
+// precise as inner is.
+func Compose(outer, inner *Map) *Map {
+	composed := New(outer.File)
+	composed.Sources = inner.Sources
+	composed.SourcesContent = inner.SourcesContent
+
+	for _, mapping := range outer.Mappings {
+		var original *Mapping
+		if mapping.Source != "" {
+			original = inner.Lookup(mapping.SourceLine, mapping.SourceColumn)
+		}
+
+		if original == nil || original.Source == "" {
+			composed.Add(&Mapping{
+				GeneratedColumn: mapping.GeneratedColumn,
+				GeneratedLine:   mapping.GeneratedLine,
+			})
+			continue
+		}
+
+		composed.Add(&Mapping{
+			GeneratedColumn: mapping.GeneratedColumn,
+			GeneratedLine:   mapping.GeneratedLine,
+			Source:          original.Source,
+			SourceColumn:    original.SourceColumn,
+			SourceLine:      original.SourceLine,
+		})
+	}
+
+	return composed
+}
+
+// Decode decodes a source map from JSON.
+func Decode(data []byte) (*Map, error) {
+	var encoded encodedMap
+	err := json.Unmarshal(data, &encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	if encoded.Version != 3 {
+		return nil, fmt.Errorf("Unsupported source map version %v", encoded.Version)
+	}
+
+	m := &Map{
+		File:           encoded.File,
+		Sources:        encoded.Sources,
+		SourcesContent: encoded.SourcesContent,
+	}
+
+	var source, sourceLine, sourceColumn int
+	for line, segments := range strings.Split(encoded.Mappings, ";") {
+		column := 0
+		for _, segment := range strings.Split(segments, ",") {
+			if segment == "" {
+				continue
+			}
+
+			fields, err := decodeVLQs(segment)
+			if err != nil {
+				return nil, err
+			}
+
+			column += fields[0]
+			mapping := &Mapping{GeneratedColumn: column, GeneratedLine: line}
+
+			switch len(fields) {
+			case 1:
+			case 4, 5:
+				source += fields[1]
+				sourceLine += fields[2]
+				sourceColumn += fields[3]
+
+				if source < 0 || source >= len(m.Sources) {
+					return nil, fmt.Errorf("Mapping refers to unknown source %v", source)
+				}
+				mapping.Source = m.Sources[source]
+				mapping.SourceLine = sourceLine
+				mapping.SourceColumn = sourceColumn
+			default:
+				return nil, fmt.Errorf("Mapping segment %q has %v fields", segment, len(fields))
+			}
+
+			m.Mappings = append(m.Mappings, mapping)
+		}
+	}
+
+	return m, nil
+}
+
+// Add adds a mapping. Mappings need to be added in the order of their
+// generated positions.
+func (m *Map) Add(mapping *Mapping) {
+	m.Mappings = append(m.Mappings, mapping)
+}
+
+// AddSource adds a source along with its contents.
+func (m *Map) AddSource(name, content string) {
+	m.Sources = append(m.Sources, name)
+	m.SourcesContent = append(m.SourcesContent, content)
+}
+
+// Encode encodes the source map as JSON.
+func (m *Map) Encode() ([]byte, error) {
+	indexes := make(map[string]int)
+	for i, source := range m.Sources {
+		indexes[source] = i
+	}
+
+	var b bytes.Buffer
+	var line, column, source, sourceLine, sourceColumn int
+	for i, mapping := range m.Mappings {
+		for line < mapping.GeneratedLine {
+			b.WriteByte(';')
+			line++
+			column = 0
+		}
+		if i > 0 && m.Mappings[i-1].GeneratedLine == mapping.GeneratedLine {
+			b.WriteByte(',')
+		}
+
+		encodeVLQ(&b, mapping.GeneratedColumn-column)
+		column = mapping.GeneratedColumn
+
+		if mapping.Source == "" {
+			continue
+		}
+
+		index, ok := indexes[mapping.Source]
+		if !ok {
+			return nil, fmt.Errorf("Mapping refers to unknown source %q", mapping.Source)
+		}
+
+		encodeVLQ(&b, index-source)
+		encodeVLQ(&b, mapping.SourceLine-sourceLine)
+		encodeVLQ(&b, mapping.SourceColumn-sourceColumn)
+		source, sourceLine, sourceColumn = index, mapping.SourceLine, mapping.SourceColumn
+	}
+
+	return json.Marshal(&encodedMap{
+		File:           m.File,
+		Mappings:       b.String(),
+		Names:          []string{},
+		Sources:        m.Sources,
+		SourcesContent: m.SourcesContent,
+		Version:        3,
+	})
+}
+
+// Lookup finds the mapping that covers a position in the generated file,
+// which is the last one at or before it on the same line. Returns nil if
+// there isn't one.
+func (m *Map) Lookup(line, column int) *Mapping {
+	i := sort.Search(len(m.Mappings), func(i int) bool {
+		mapping := m.Mappings[i]
+		return mapping.GeneratedLine > line ||
+			mapping.GeneratedLine == line && mapping.GeneratedColumn > column
+	})
+
+	if i == 0 || m.Mappings[i-1].GeneratedLine != line {
+		return nil
+	}
+	return m.Mappings[i-1]
+}
+
+// Decodes a segment of base64 VLQs into the values of its fields.
+func decodeVLQs(segment string) ([]int, error) {
+	var values []int
+	value, shift := 0, uint(0)
+
+	for i := 0; i < len(segment); i++ {
+		digit := strings.IndexByte(base64Characters, segment[i])
+		if digit == -1 {
+			return nil, fmt.Errorf("Mapping segment %q has invalid character %q", segment, segment[i])
+		}
+
+		value += (digit & 0x1f) << shift
+		if digit&0x20 != 0 {
+			shift += 5
+			continue
+		}
+
+		// The sign is kept in the lowest bit
+		if value&1 == 1 {
+			values = append(values, -(value >> 1))
+		} else {
+			values = append(values, value>>1)
+		}
+		value, shift = 0, 0
+	}
+
+	if shift != 0 {
+		return nil, fmt.Errorf("Mapping segment %q ends partway through a value", segment)
+	}
+
+	return values, nil
+}
+
+// Encodes a value as a base64 VLQ, which holds five bits in each digit along
+// with a bit saying whether more digits follow. The sign is kept in the
+// lowest bit of the first digit.
+func encodeVLQ(b *bytes.Buffer, value int) {
+	if value < 0 {
+		value = (-value << 1) | 1
+	} else {
+		value <<= 1
+	}
+
+	for {
+		digit := value & 0x1f
+		value >>= 5
+		if value > 0 {
+			digit |= 0x20
+		}
+		b.WriteByte(base64Characters[digit])
+
+		if value == 0 {
+			break
+		}
+	}
+}
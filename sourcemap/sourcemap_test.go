@@ -0,0 +1,114 @@
+package sourcemap
+
+import (
+	"bytes"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestCompose(t *testing.T) {
+	// A bundle of two files, the second of which starts on line 2
+	inner := New("app.js")
+	inner.AddSource("a.js", "a()\nb()")
+	inner.AddSource("b.js", "c()")
+	inner.Add(&Mapping{GeneratedLine: 0, Source: "a.js", SourceLine: 0})
+	inner.Add(&Mapping{GeneratedLine: 1, Source: "a.js", SourceLine: 1})
+	inner.Add(&Mapping{GeneratedLine: 3, Source: "b.js", SourceLine: 0})
+
+	// Which is then minified onto one line
+	outer := New("app.js")
+	outer.Add(&Mapping{GeneratedColumn: 0, Source: "app.js", SourceLine: 0})
+	outer.Add(&Mapping{GeneratedColumn: 4, Source: "app.js", SourceLine: 1, SourceColumn: 2})
+	outer.Add(&Mapping{GeneratedColumn: 8, Source: "app.js", SourceLine: 2})
+	outer.Add(&Mapping{GeneratedColumn: 10, Source: "app.js", SourceLine: 3})
+
+	composed := Compose(outer, inner)
+	assert.Equal(t, "app.js", composed.File)
+	assert.Equal(t, []string{"a.js", "b.js"}, composed.Sources)
+	assert.Equal(t, []*Mapping{
+		{GeneratedColumn: 0, Source: "a.js", SourceLine: 0},
+		{GeneratedColumn: 4, Source: "a.js", SourceLine: 1},
+
+		// Line 2 of the bundle isn't mapped to anything
+		{GeneratedColumn: 8},
+
+		{GeneratedColumn: 10, Source: "b.js", SourceLine: 0},
+	}, composed.Mappings)
+}
+
+func TestEncodeAndDecode(t *testing.T) {
+	m := New("app.js")
+	m.AddSource("a.js", "a")
+	m.AddSource("b.js", "b")
+	m.Add(&Mapping{Source: "a.js"})
+	m.Add(&Mapping{GeneratedColumn: 5})
+	m.Add(&Mapping{GeneratedLine: 2, GeneratedColumn: 2, Source: "b.js", SourceLine: 3, SourceColumn: 1})
+
+	data, err := m.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"file":"app.js","mappings":"AAAA,K;;ECGC","names":[],`+
+		`"sources":["a.js","b.js"],"sourcesContent":["a","b"],"version":3}`, string(data))
+
+	decoded, err := Decode(data)
+	assert.NoError(t, err)
+	assert.Equal(t, m, decoded)
+
+	// Mappings are only allowed to refer to a known source
+	m.Add(&Mapping{GeneratedLine: 3, Source: "c.js"})
+	_, err = m.Encode()
+	assert.Equal(t, `Mapping refers to unknown source "c.js"`, err.Error())
+
+	_, err = Decode([]byte(`{"mappings":"AAAA","sources":["a.js"],"version":2}`))
+	assert.Equal(t, "Unsupported source map version 2", err.Error())
+
+	_, err = Decode([]byte(`{"mappings":"AAA","sources":["a.js"],"version":3}`))
+	assert.Equal(t, `Mapping segment "AAA" has 3 fields`, err.Error())
+
+	_, err = Decode([]byte(`{"mappings":"ACAA","sources":["a.js"],"version":3}`))
+	assert.Equal(t, "Mapping refers to unknown source 1", err.Error())
+}
+
+func TestLookup(t *testing.T) {
+	m := New("app.js")
+	m.Add(&Mapping{GeneratedLine: 0, GeneratedColumn: 2, Source: "a.js", SourceLine: 0})
+	m.Add(&Mapping{GeneratedLine: 0, GeneratedColumn: 6, Source: "a.js", SourceLine: 1})
+	m.Add(&Mapping{GeneratedLine: 2, GeneratedColumn: 0, Source: "a.js", SourceLine: 2})
+
+	assert.Nil(t, m.Lookup(0, 1))
+	assert.Equal(t, 0, m.Lookup(0, 2).SourceLine)
+	assert.Equal(t, 0, m.Lookup(0, 5).SourceLine)
+	assert.Equal(t, 1, m.Lookup(0, 100).SourceLine)
+	assert.Nil(t, m.Lookup(1, 0))
+	assert.Equal(t, 2, m.Lookup(2, 4).SourceLine)
+	assert.Nil(t, m.Lookup(3, 0))
+}
+
+func TestVLQ(t *testing.T) {
+	assert.Equal(t, "A", encodeVLQString(0))
+	assert.Equal(t, "C", encodeVLQString(1))
+	assert.Equal(t, "D", encodeVLQString(-1))
+	assert.Equal(t, "gB", encodeVLQString(16))
+	assert.Equal(t, "2H", encodeVLQString(123))
+	assert.Equal(t, "jrqJ", encodeVLQString(-152753))
+
+	values, err := decodeVLQs("ACDgB2HjrqJ")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 1, -1, 16, 123, -152753}, values)
+
+	_, err = decodeVLQs("g")
+	assert.Equal(t, `Mapping segment "g" ends partway through a value`, err.Error())
+
+	_, err = decodeVLQs("A*")
+	assert.Equal(t, `Mapping segment "A*" has invalid character '*'`, err.Error())
+}
+
+//
+// Helpers
+//
+
+func encodeVLQString(value int) string {
+	var b bytes.Buffer
+	encodeVLQ(&b, value)
+	return b.String()
+}
@@ -1,9 +1,83 @@
 package templatehelpers
 
 import (
+	"fmt"
 	"html/template"
+	"strings"
+	"time"
+
+	"github.com/brandur/singularity/assets"
 )
 
+// Assets is the manifest that the asset helper looks up the fingerprinted
+// names of assets in. It needs to be set before rendering any template that
+// uses the helper.
+var Assets *assets.Manifest
+
+// Bundles are the bundles of scripts and stylesheets that the bundle helper
+// includes. They need to be set along with Assets before rendering any
+// template that uses the helper.
+var Bundles map[string]*assets.Bundle
+
 // FuncMap is a set of helper functions to make available in templates for the
 // project.
-var FuncMap = template.FuncMap{}
+var FuncMap = template.FuncMap{
+	"FormatTime": formatTime,
+	"asset":      assetURL,
+	"bundle":     bundleTags,
+}
+
+// Gets the URL of the fingerprinted version of an asset like "app.css" so
+// that it can be cached forever. An asset that's not in the manifest is an
+// error so that broken links fail the build.
+func assetURL(name string) (string, error) {
+	if Assets == nil {
+		return "", fmt.Errorf("No asset manifest to look up %q in", name)
+	}
+	return Assets.URL(name)
+}
+
+// Produces the tags that load the named bundles along with any that they
+// require, in the order that they need to be loaded. All stylesheets come
+// before any scripts. An unknown bundle is an error.
+func bundleTags(names ...string) (template.HTML, error) {
+	resolved, err := assets.ResolveBundles(Bundles, names...)
+	if err != nil {
+		return "", err
+	}
+
+	var tags []string
+
+	for _, bundle := range resolved {
+		if !bundle.HasStylesheets() {
+			continue
+		}
+
+		url, err := assetURL(bundle.Name + ".css")
+		if err != nil {
+			return "", err
+		}
+		tags = append(tags, fmt.Sprintf(`<link rel="stylesheet" href="%v">`,
+			template.HTMLEscapeString(url)))
+	}
+
+	for _, bundle := range resolved {
+		if !bundle.HasJavascripts() {
+			continue
+		}
+
+		url, err := assetURL(bundle.Name + ".js")
+		if err != nil {
+			return "", err
+		}
+		tags = append(tags, fmt.Sprintf(`<script src="%v"></script>`,
+			template.HTMLEscapeString(url)))
+	}
+
+	return template.HTML(strings.Join(tags, "\n")), nil
+}
+
+// Formats a time in a human-readable long form like "October 1, 2017".
+func formatTime(t time.Time) string {
+	return t.Format("January 2, 2006")
+}
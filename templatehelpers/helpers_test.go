@@ -2,8 +2,56 @@ package templatehelpers
 
 import (
 	"testing"
+	"time"
+
+	"github.com/brandur/singularity/assets"
+	assert "github.com/stretchr/testify/require"
 )
 
-// No helpers to test for now.
-func TestNothing(t *testing.T) {
+func TestFormatTime(t *testing.T) {
+	assert.Equal(t, "October 1, 2017",
+		formatTime(time.Date(2017, 10, 1, 12, 34, 56, 0, time.UTC)))
+}
+
+func TestAssetURL(t *testing.T) {
+	_, err := assetURL("app.css")
+	assert.Equal(t, `No asset manifest to look up "app.css" in`, err.Error())
+
+	Assets = assets.NewManifest("/assets/")
+	defer func() { Assets = nil }()
+
+	fingerprinted := Assets.Add("app.css", []byte("body {}"))
+
+	url, err := assetURL("app.css")
+	assert.NoError(t, err)
+	assert.Equal(t, "/assets/"+fingerprinted, url)
+
+	_, err = assetURL("app.js")
+	assert.Equal(t, `Unknown asset "app.js"`, err.Error())
+}
+
+func TestBundleTags(t *testing.T) {
+	Assets = assets.NewManifest("/assets/")
+	Bundles = map[string]*assets.Bundle{
+		"app":     {Name: "app", Stylesheets: []string{"main.sass"}},
+		"article": {Name: "article", Javascripts: []string{"toc.js"}, Requires: []string{"app"}},
+		"gallery": {Name: "gallery", Javascripts: []string{"gallery.js"}, Stylesheets: []string{"gallery.css"}, Requires: []string{"app"}},
+	}
+	defer func() { Assets, Bundles = nil, nil }()
+
+	app := Assets.Add("app.css", []byte("body {}"))
+	article := Assets.Add("article.js", []byte("toc()"))
+	galleryCSS := Assets.Add("gallery.css", []byte(".gallery {}"))
+	galleryJS := Assets.Add("gallery.js", []byte("gallery()"))
+
+	// Required bundles come first and are only included once
+	html, err := bundleTags("article", "gallery")
+	assert.NoError(t, err)
+	assert.Equal(t, `<link rel="stylesheet" href="/assets/`+app+`">
+<link rel="stylesheet" href="/assets/`+galleryCSS+`">
+<script src="/assets/`+article+`"></script>
+<script src="/assets/`+galleryJS+`"></script>`, string(html))
+
+	_, err = bundleTags("missing")
+	assert.Equal(t, `Unknown bundle "missing"`, err.Error())
 }
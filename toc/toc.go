@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"golang.org/x/net/html"
 )
@@ -28,7 +29,7 @@ func Render(content string) (string, error) {
 			return "", fmt.Errorf("Couldn't extract header level: %v", err.Error())
 		}
 
-		headers = append(headers, &header{level, "#" + match[2], match[4]})
+		headers = append(headers, &header{level, "#" + match[2], plainText(match[4])})
 	}
 
 	node := buildTree(headers)
@@ -121,6 +122,21 @@ func buildTree(headers []*header) *html.Node {
 	return topNode
 }
 
+// Extracts the text from a header's HTML with any markup like code or emphasis
+// removed and entities decoded, so that it can go into a text node.
+func plainText(s string) string {
+	var b bytes.Buffer
+	tokenizer := html.NewTokenizer(strings.NewReader(s))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return b.String()
+		case html.TextToken:
+			b.Write(tokenizer.Text())
+		}
+	}
+}
+
 func renderTree(node *html.Node) (string, error) {
 	var b bytes.Buffer
 	err := html.Render(&b, node)
@@ -213,6 +213,15 @@ func TestRender(t *testing.T) {
 	assert.Equal(t, expected, rendered)
 }
 
+func TestRenderInlineMarkup(t *testing.T) {
+	content := `<h2 id="h-a"><a href="#h-a">Use <code>go</code> &amp; <em>now</em></a></h2>`
+	expected := `<ol><li><a href="#h-a">Use go &amp; now</a></li></ol>`
+
+	rendered, err := Render(content)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, rendered)
+}
+
 func TestRenderEmpty(t *testing.T) {
 	rendered, err := Render("hello")
 	assert.NoError(t, err)